@@ -0,0 +1,143 @@
+package editor
+
+import "unicode"
+
+// action is a command that keys can be bound to in the keymaps, and can
+// only be bound in its modes. Motions move the cursor, and an operator
+// waits for a motion to tell it what text to work on.
+type action struct {
+	name        string
+	description string
+	modes       []string
+	run         func(e *Editor)
+
+	motion   bool
+	operator bool
+}
+
+var (
+	normalOnly  = []string{"normal"}
+	visualOnly  = []string{"visual"}
+	insertOnly  = []string{"insert"}
+	normalModes = []string{"normal", "visual"}
+	textModes   = []string{"normal", "insert", "visual"}
+)
+
+// actions lists every action, in the order the help shows them.
+var actions = []action{
+	{name: "insert", description: "Enter insert mode", modes: normalOnly, run: (*Editor).startInsert},
+	{name: "leave-insert", description: "Leave insert mode", modes: insertOnly, run: (*Editor).stopInsert},
+	{name: "clear", description: "Clear search highlight and chosen register", modes: normalOnly, run: (*Editor).clearState},
+	{name: "save", description: "Save file", modes: normalModes, run: func(e *Editor) { e.save() }},
+	{name: "quit", description: "Quit editor, asking about unsaved changes", modes: normalOnly, run: (*Editor).confirmQuit},
+	{name: "quit-now", description: "Quit without saving", modes: normalOnly, run: (*Editor).quit},
+	{name: "help", description: "Show this help", modes: normalOnly, run: (*Editor).openHelp},
+	{name: "paste", description: "Paste copied text at the cursor", modes: normalOnly, run: (*Editor).paste},
+	{name: "undo", description: "Undo last change", modes: normalOnly, run: func(e *Editor) { e.Buffer().Undo() }},
+	{name: "redo", description: "Redo last undone change", modes: normalOnly, run: func(e *Editor) { e.Buffer().Redo() }},
+	{name: "undo-tree", description: "Browse undo history tree", modes: normalOnly, run: (*Editor).openUndoTree},
+	{name: "line-endings", description: "Toggle line endings LF/CRLF", modes: normalOnly, run: (*Editor).toggleLineEnding},
+	{name: "encoding", description: "Reopen or save in another encoding", modes: normalOnly, run: (*Editor).openEncodingSelector},
+	{name: "search-forward", description: "Search forward as you type", modes: normalOnly, run: func(e *Editor) { e.openSearch(false) }},
+	{name: "search-backward", description: "Search backward as you type", modes: normalOnly, run: func(e *Editor) { e.openSearch(true) }},
+	{name: "search-next", description: "Next match of the last search", modes: normalOnly, run: func(e *Editor) { e.repeatSearch(false) }},
+	{name: "search-previous", description: "Previous match of the last search", modes: normalOnly, run: func(e *Editor) { e.repeatSearch(true) }},
+	{name: "command-line", description: "Command line, on the selected lines in visual mode", modes: normalModes, run: (*Editor).openCommandLine},
+	{name: "file-browser", description: "Open file browser", modes: normalOnly, run: (*Editor).openFileBrowser},
+	{name: "buffers", description: "List open buffers to switch to", modes: normalOnly, run: (*Editor).openBuffers},
+	{name: "next-buffer", description: "Next buffer, or the count'th after it", modes: normalOnly, run: func(e *Editor) { e.cycleBuffer(max(e.count, 1)) }},
+	{name: "previous-buffer", description: "Previous buffer, or the count'th before it", modes: normalOnly, run: func(e *Editor) { e.cycleBuffer(-max(e.count, 1)) }},
+	{name: "theme", description: "Choose theme", modes: normalModes, run: (*Editor).openThemeSelector},
+	{name: "register", description: "Choose the register for the next copy, delete or paste", modes: normalModes, run: func(e *Editor) { e.choosingRegister = true }},
+	{name: "registers", description: "Paste from the registers popup", modes: normalOnly, run: (*Editor).openRegisters},
+	{name: "record-macro", description: "Record keys into the macro named next, or stop recording", modes: normalOnly, run: (*Editor).recordMacroAction},
+	{name: "play-macro", description: "Play the macro named next, or the last one with @", modes: normalOnly, run: (*Editor).playMacroAction},
+
+	{name: "split-window", description: "Split the window, one above the other", modes: normalOnly, run: func(e *Editor) { e.splitWindow(false) }},
+	{name: "vsplit-window", description: "Split the window, side by side", modes: normalOnly, run: func(e *Editor) { e.splitWindow(true) }},
+	{name: "next-window", description: "Focus the next window", modes: normalOnly, run: func(e *Editor) { e.cycleWindow(max(e.count, 1)) }},
+	{name: "previous-window", description: "Focus the previous window", modes: normalOnly, run: func(e *Editor) { e.cycleWindow(-max(e.count, 1)) }},
+	{name: "window-left", description: "Focus the window to the left", modes: normalOnly, run: func(e *Editor) { e.focusNeighbor(-1, 0, max(e.count, 1)) }},
+	{name: "window-down", description: "Focus the window below", modes: normalOnly, run: func(e *Editor) { e.focusNeighbor(0, 1, max(e.count, 1)) }},
+	{name: "window-up", description: "Focus the window above", modes: normalOnly, run: func(e *Editor) { e.focusNeighbor(0, -1, max(e.count, 1)) }},
+	{name: "window-right", description: "Focus the window to the right", modes: normalOnly, run: func(e *Editor) { e.focusNeighbor(1, 0, max(e.count, 1)) }},
+	{name: "close-window", description: "Close the window", modes: normalOnly, run: func(e *Editor) { e.closeWindow() }},
+	{name: "only-window", description: "Close every other window", modes: normalOnly, run: (*Editor).onlyWindow},
+	{name: "taller-window", description: "Make the window a line taller, or count lines", modes: normalOnly, run: func(e *Editor) { e.resizeWindow(false, max(e.count, 1)) }},
+	{name: "shorter-window", description: "Make the window a line shorter, or count lines", modes: normalOnly, run: func(e *Editor) { e.resizeWindow(false, -max(e.count, 1)) }},
+	{name: "wider-window", description: "Make the window a column wider, or count columns", modes: normalOnly, run: func(e *Editor) { e.resizeWindow(true, max(e.count, 1)) }},
+	{name: "narrower-window", description: "Make the window a column narrower, or count columns", modes: normalOnly, run: func(e *Editor) { e.resizeWindow(true, -max(e.count, 1)) }},
+	{name: "equalize-windows", description: "Make all windows the same size", modes: normalOnly, run: (*Editor).equalizeWindows},
+	{name: "new-tab", description: "Open a tab page showing the buffer", modes: normalOnly, run: (*Editor).newTabWithBuffer},
+	{name: "window-to-tab", description: "Move the window to a tab page of its own", modes: normalOnly, run: (*Editor).moveWindowToTab},
+	{name: "close-tab", description: "Close the tab page", modes: normalOnly, run: func(e *Editor) { e.closeTab() }},
+	{name: "next-tab", description: "Show the next tab page, or tab page count", modes: normalOnly, run: (*Editor).nextTabAction},
+	{name: "previous-tab", description: "Show the previous tab page, or count back", modes: normalOnly, run: func(e *Editor) { e.cycleTab(-max(e.count, 1)) }},
+	{name: "move-tab-left", description: "Move the tab page left, or count places", modes: normalOnly, run: func(e *Editor) { e.moveTab(e.tab - max(e.count, 1)) }},
+	{name: "move-tab-right", description: "Move the tab page right, or count places", modes: normalOnly, run: func(e *Editor) { e.moveTab(e.tab + max(e.count, 1)) }},
+
+	{name: "delete", description: "Delete over a motion, or lines when doubled", modes: normalOnly, run: operatorAction("delete"), operator: true},
+	{name: "change", description: "Change over a motion, or lines when doubled", modes: normalOnly, run: operatorAction("change"), operator: true},
+	{name: "copy", description: "Copy over a motion, or lines when doubled", modes: normalOnly, run: operatorAction("copy"), operator: true},
+
+	{name: "left", description: "Move cursor left", modes: textModes, run: moveAction("left"), motion: true},
+	{name: "right", description: "Move cursor right", modes: textModes, run: moveAction("right"), motion: true},
+	{name: "up", description: "Move cursor up", modes: textModes, run: moveAction("up"), motion: true},
+	{name: "down", description: "Move cursor down", modes: textModes, run: moveAction("down"), motion: true},
+	{name: "page-up", description: "Move up by quarter page", modes: textModes, run: moveAction("page-up"), motion: true},
+	{name: "page-down", description: "Move down by quarter page", modes: textModes, run: moveAction("page-down"), motion: true},
+	{name: "line-start", description: "Move to start of line", modes: textModes, run: moveAction("line-start"), motion: true},
+	{name: "first-character", description: "Move to first character of line that is not blank", modes: textModes, run: moveAction("first-character"), motion: true},
+	{name: "line-end", description: "Move to end of line", modes: textModes, run: moveAction("line-end"), motion: true},
+	{name: "word-forward", description: "Next word start", modes: textModes, run: moveAction("word-forward"), motion: true},
+	{name: "word-backward", description: "Previous word start", modes: textModes, run: moveAction("word-backward"), motion: true},
+	{name: "word-end", description: "End of word", modes: textModes, run: moveAction("word-end"), motion: true},
+	{name: "paragraph-forward", description: "Next paragraph", modes: textModes, run: moveAction("paragraph-forward"), motion: true},
+	{name: "paragraph-backward", description: "Previous paragraph", modes: textModes, run: moveAction("paragraph-backward"), motion: true},
+	{name: "first-line", description: "First line, or line N with a count", modes: textModes, run: moveAction("first-line"), motion: true},
+	{name: "last-line", description: "Last line, or line N with a count", modes: textModes, run: moveAction("last-line"), motion: true},
+	{name: "matching-bracket", description: "Matching bracket", modes: textModes, run: moveAction("matching-bracket"), motion: true},
+	{name: "find-char", description: "Find the next key typed, forward on the line", modes: textModes, run: findCharAction(characterFind{}), motion: true},
+	{name: "find-char-backward", description: "Find the next key typed, backward on the line", modes: textModes, run: findCharAction(characterFind{backward: true}), motion: true},
+	{name: "till-char", description: "Move to just before the next key typed on the line", modes: textModes, run: findCharAction(characterFind{till: true}), motion: true},
+	{name: "till-char-backward", description: "Move to just after the next key typed, backward", modes: textModes, run: findCharAction(characterFind{backward: true, till: true}), motion: true},
+	{name: "repeat-find", description: "Repeat last character find", modes: textModes, run: moveAction("repeat-find"), motion: true},
+	{name: "repeat-find-reverse", description: "Repeat last character find in reverse", modes: textModes, run: moveAction("repeat-find-reverse"), motion: true},
+
+	{name: "newline", description: "Insert new line", modes: insertOnly, run: func(e *Editor) { e.Buffer().InsertNewLine() }},
+	{name: "delete-back", description: "Delete character", modes: insertOnly, run: func(e *Editor) { e.Buffer().DeleteCharacter() }},
+
+	{name: "select", description: "Select characters", modes: normalModes, run: func(e *Editor) { e.startSelection(EditVisual) }},
+	{name: "select-lines", description: "Select whole lines", modes: normalModes, run: func(e *Editor) { e.startSelection(EditVisualLine) }},
+	{name: "select-block", description: "Select a rectangular block", modes: normalModes, run: func(e *Editor) { e.startSelection(EditVisualBlock) }},
+	{name: "leave-selection", description: "Leave the selection", modes: visualOnly, run: (*Editor).endSelection},
+	{name: "copy-selection", description: "Copy selection", modes: visualOnly, run: (*Editor).copySelection},
+	{name: "change-selection", description: "Change selection", modes: visualOnly, run: (*Editor).changeSelection},
+	{name: "delete-selection", description: "Delete selection", modes: visualOnly, run: (*Editor).deleteSelection},
+	{name: "indent", description: "Indent selected lines", modes: visualOnly, run: func(e *Editor) { e.indentSelection(false) }},
+	{name: "outdent", description: "Outdent selected lines", modes: visualOnly, run: func(e *Editor) { e.indentSelection(true) }},
+	{name: "toggle-case", description: "Toggle case of selection", modes: visualOnly, run: func(e *Editor) { e.changeSelectionCase(toggleCase) }},
+	{name: "lower-case", description: "Lower case selection", modes: visualOnly, run: func(e *Editor) { e.changeSelectionCase(unicode.ToLower) }},
+	{name: "upper-case", description: "Upper case selection", modes: visualOnly, run: func(e *Editor) { e.changeSelectionCase(unicode.ToUpper) }},
+	{name: "other-end", description: "Move to other end of selection", modes: visualOnly, run: (*Editor).swapSelectionEnds},
+
+	{name: "browser-up", description: "Previous entry", modes: []string{"browser"}, run: func(e *Editor) { e.fileBrowser.MoveUp() }},
+	{name: "browser-down", description: "Next entry", modes: []string{"browser"}, run: func(e *Editor) { e.fileBrowser.MoveDown() }},
+	{name: "browser-open", description: "Open file or directory", modes: []string{"browser"}, run: (*Editor).openBrowserEntry},
+	{name: "browser-close", description: "Close file browser", modes: []string{"browser"}, run: func(e *Editor) { e.mode = ModeEditor }},
+
+	{name: "theme-previous", description: "Preview previous theme", modes: []string{"theme"}, run: func(e *Editor) { e.moveThemeCursor(-1) }},
+	{name: "theme-next", description: "Preview next theme", modes: []string{"theme"}, run: func(e *Editor) { e.moveThemeCursor(1) }},
+	{name: "theme-apply", description: "Apply and save theme", modes: []string{"theme"}, run: (*Editor).applyTheme},
+	{name: "theme-cancel", description: "Restore previous theme", modes: []string{"theme"}, run: (*Editor).cancelTheme},
+}
+
+// findAction returns the action called name, or nil.
+func findAction(name string) *action {
+	for i := range actions {
+		if actions[i].name == name {
+			return &actions[i]
+		}
+	}
+	return nil
+}
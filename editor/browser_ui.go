@@ -1,13 +1,12 @@
 package editor
 
-/*
-#include "termbox2.h"
-*/
-import "C"
+import (
+	"fmt"
+	"strings"
+)
 
-func showFileBrowser() {
-	w := int(C.tb_width())
-	h := int(C.tb_height())
+func (e *Editor) showFileBrowser() {
+	w, h := e.screen.Size()
 
 	pw := w - 20
 	ph := h - 6
@@ -15,20 +14,20 @@ func showFileBrowser() {
 	x := (w - pw) / 2
 	y := (h - ph) / 2
 
-	drawPopupFrame(x, y, pw, ph, "File Browser")
+	e.drawPopupFrame(x, y, pw, ph, "File Browser")
 
-	displayPath := fileBrowser.CurrentPath
+	displayPath := e.fileBrowser.CurrentPath
 	if len(displayPath) > pw-6 {
 		displayPath = "..." + displayPath[len(displayPath)-(pw-9):]
 	}
-	printCell(x+2, y+1, C.TB_WHITE, C.TB_BLACK, displayPath)
+	e.printCell(x+2, y+1, ColorWhite, ColorBlack, displayPath)
 
 	visibleEntries := ph - 4
-	startIdx := fileBrowser.Scroll
-	endIdx := min(startIdx+visibleEntries, len(fileBrowser.Entries))
+	startIdx := e.fileBrowser.Scroll
+	endIdx := min(startIdx+visibleEntries, len(e.fileBrowser.Entries))
 
 	for i := startIdx; i < endIdx; i++ {
-		entry := fileBrowser.Entries[i]
+		entry := e.fileBrowser.Entries[i]
 		displayName := entry.Name
 		if entry.IsDir {
 			displayName = "[" + displayName + "]"
@@ -38,21 +37,19 @@ func showFileBrowser() {
 			displayName = displayName[:pw-9] + "..."
 		}
 
-		var fg, bg C.uintattr_t = C.TB_WHITE, C.TB_BLACK
+		var fg, bg Attribute = ColorWhite, ColorBlack
 
-		if i == fileBrowser.Cursor {
-			fg = C.TB_BLACK
-			bg = C.TB_WHITE
+		if i == e.fileBrowser.Cursor {
+			fg = ColorBlack
+			bg = ColorWhite
 		}
 
-		printCell(x+2, y+2+(i-startIdx), fg, bg, displayName)
+		e.printCell(x+2, y+2+(i-startIdx), fg, bg, displayName)
 	}
 
-	footerText := "[↑/↓] Navigate  [Enter] Select  [Esc] Close"
+	footerText := e.popupFooter("browser", "browser-up", "browser-down", "browser-open", "browser-close")
 	footerX := x + (pw-len(footerText))/2
-	printCell(footerX, y+ph-2, C.TB_BLUE, C.TB_BLACK, footerText)
-
-	C.tb_present()
+	e.printCell(footerX, y+ph-2, ColorBlue, ColorBlack, footerText)
 }
 
 type themeEntry struct {
@@ -67,9 +64,42 @@ var themeSelector = struct {
 
 var previousThemeKey string
 
-func showThemeSelector() {
-	w := int(C.tb_width())
-	h := int(C.tb_height())
+// openThemeSelector lists the themes other than the current one, previewing
+// the one the cursor is on.
+func (e *Editor) openThemeSelector() {
+	themeSelector.Entries = nil
+	for key, theme := range Themes {
+		if theme.Name != CurrentTheme.Name {
+			themeSelector.Entries = append(themeSelector.Entries, themeEntry{
+				Key:  key,
+				Name: theme.Name,
+			})
+		}
+	}
+	previousThemeKey = ""
+	if editSettings != nil && editSettings.Theme != "" {
+		previousThemeKey = editSettings.Theme
+	} else {
+		previousThemeKey = GetCurrentThemeKey()
+	}
+
+	themeSelector.Cursor = 0
+	for i, entry := range themeSelector.Entries {
+		if entry.Key == previousThemeKey {
+			themeSelector.Cursor = i
+			break
+		}
+	}
+
+	if len(themeSelector.Entries) > 0 {
+		SetTheme(themeSelector.Entries[themeSelector.Cursor].Key)
+	}
+
+	e.mode = ModeThemeSelector
+}
+
+func (e *Editor) showThemeSelector() {
+	w, h := e.screen.Size()
 
 	pw := 60
 	ph := 8 + len(themeSelector.Entries)
@@ -99,80 +129,91 @@ func showThemeSelector() {
 		}
 	}
 
-	drawPopupFrame(x, y, pw, ph, "Select Theme")
+	e.drawPopupFrame(x, y, pw, ph, "Select Theme")
 
 	for i, entry := range themeSelector.Entries {
 		displayName := entry.Name
 		if len(displayName) > pw-6 {
 			displayName = displayName[:pw-9] + "..."
 		}
-		var fg, bg C.uintattr_t = C.TB_WHITE, C.TB_BLACK
+		var fg, bg Attribute = ColorWhite, ColorBlack
 		if i == themeSelector.Cursor {
-			fg, bg = C.TB_BLACK, C.TB_WHITE
+			fg, bg = ColorBlack, ColorWhite
 		}
-		printCell(x+2, y+2+i, fg, bg, displayName)
+		e.printCell(x+2, y+2+i, fg, bg, displayName)
 	}
 
-	footerText := "[↑/↓] Navigate  [Enter] Select  [Esc] Close"
+	footerText := e.popupFooter("theme", "theme-previous", "theme-next", "theme-apply", "theme-cancel")
 	footerX := x + (pw-len(footerText))/2
-	printCell(footerX, y+ph-2, C.TB_BLUE, C.TB_BLACK, footerText)
+	e.printCell(footerX, y+ph-2, ColorBlue, ColorBlack, footerText)
+}
 
-	C.tb_present()
+func (e *Editor) processThemeSelectorEvent(event Event) {
+	if act, _, _ := e.keyAction("theme", event); act != nil {
+		act.run(e)
+	}
 }
 
-func processThemeSelectorEvent(event C.struct_tb_event) {
-	switch event.key {
-	case C.TB_KEY_ESC:
-		if previousThemeKey != "" {
-			SetTheme(previousThemeKey)
-		}
-		previousThemeKey = ""
-		currentMode = ModeEditor
-	case C.TB_KEY_ARROW_UP:
-		if themeSelector.Cursor > 0 {
-			themeSelector.Cursor--
-			SetTheme(themeSelector.Entries[themeSelector.Cursor].Key)
-		}
-	case C.TB_KEY_ARROW_DOWN:
-		if themeSelector.Cursor < len(themeSelector.Entries)-1 {
-			themeSelector.Cursor++
-			SetTheme(themeSelector.Entries[themeSelector.Cursor].Key)
-		}
-	case C.TB_KEY_ENTER:
-		entry := themeSelector.Entries[themeSelector.Cursor]
-		SetThemeAndSave(entry.Key)
-		previousThemeKey = ""
-		currentMode = ModeEditor
+// moveThemeCursor moves the theme selector's cursor by delta and previews
+// the theme it lands on.
+func (e *Editor) moveThemeCursor(delta int) {
+	cursor := themeSelector.Cursor + delta
+	if cursor < 0 || cursor >= len(themeSelector.Entries) {
+		return
 	}
+	themeSelector.Cursor = cursor
+	SetTheme(themeSelector.Entries[cursor].Key)
 }
-func processFileBrowserEvent(event C.struct_tb_event) {
-	switch event.key {
-	case C.TB_KEY_ESC:
-		currentMode = ModeEditor
-	case C.TB_KEY_ARROW_UP:
-		fileBrowser.MoveUp()
-	case C.TB_KEY_ARROW_DOWN:
-		fileBrowser.MoveDown()
-	case C.TB_KEY_ENTER:
-		if selectedPath, isDir, err := fileBrowser.Enter(); err == nil {
-			if !isDir {
-				currentMode = ModeEditor
-				saveCurrentFileIfModified()
-				sourceFile = selectedPath
-				readFile(sourceFile)
-				currentRow = 0
-				currentColumn = 0
-				offsetRow = 0
-				offsetColumn = 0
-			}
+
+func (e *Editor) applyTheme() {
+	if len(themeSelector.Entries) > 0 {
+		SetThemeAndSave(themeSelector.Entries[themeSelector.Cursor].Key)
+	}
+	previousThemeKey = ""
+	e.mode = ModeEditor
+}
+
+func (e *Editor) cancelTheme() {
+	if previousThemeKey != "" {
+		SetTheme(previousThemeKey)
+	}
+	previousThemeKey = ""
+	e.mode = ModeEditor
+}
+
+func (e *Editor) openFileBrowser() {
+	if e.fileBrowser == nil {
+		e.fileBrowser = NewFileBrowser()
+	} else {
+		e.fileBrowser.RefreshEntries()
+	}
+	e.mode = ModeFileBrowser
+}
+
+func (e *Editor) processFileBrowserEvent(event Event) {
+	if act, _, _ := e.keyAction("browser", event); act != nil {
+		act.run(e)
+	}
+}
+
+// openBrowserEntry enters the directory under the file browser's cursor,
+// or opens the file in a buffer of its own.
+func (e *Editor) openBrowserEntry() {
+	if selectedPath, isDir, err := e.fileBrowser.Enter(); err == nil {
+		if !isDir {
+			e.mode = ModeEditor
+			e.Open(selectedPath)
 		}
 	}
 }
 
-func saveCurrentFileIfModified() {
-	if modified {
-		writeFile(sourceFile)
+// popupFooter returns the footer of the file browser or theme selector,
+// naming the keys its actions are bound to in mode.
+func (e *Editor) popupFooter(mode, up, down, open, closing string) string {
+	keys := func(name string) string {
+		return strings.Join(e.boundKeys(mode, name), "/")
 	}
+	return fmt.Sprintf("[%s/%s] Navigate  [%s] Select  [%s] Close", keys(up), keys(down), keys(open), keys(closing))
 }
 
 func min(a, b int) int {
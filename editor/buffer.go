@@ -0,0 +1,472 @@
+package editor
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"unicode/utf8"
+)
+
+// Buffer holds the lines of a single file together with its cursor, the
+// modified flag and the path it was loaded from. It does not depend on the
+// terminal, so it can be driven directly from Go code.
+type Buffer struct {
+	Row      int
+	Column   int
+	Modified bool
+	Path     string
+	Format   FileFormat
+
+	// InvalidBytes counts bytes in the loaded file that were not valid
+	// UTF-8. They are preserved and written back unchanged.
+	InvalidBytes    int
+	firstInvalidRow int
+
+	lines   *lineStore
+	history undoHistory
+
+	// disk is the version of the file last read, written or accepted by
+	// the user. changes counts modifications of the buffer, including undo
+	// and redo, and swapChanges is its value when the swap file was last
+	// brought up to date. swapPath is the swap file the buffer wrote or
+	// took over, if any, and swapKept is set when the user kept one left
+	// by an earlier session, which the buffer must not overwrite.
+	disk        diskState
+	changes     int
+	swapChanges int
+	swapPath    string
+	swapKept    bool
+
+	// offsetRow and offsetColumn are how far a window had scrolled the
+	// buffer when it last stopped showing it. swapChecked is set once
+	// the editor has looked for a swap file left by an earlier session.
+	offsetRow, offsetColumn int
+	swapChecked             bool
+}
+
+// NewBuffer returns an empty buffer associated with path.
+func NewBuffer(path string) *Buffer {
+	return &Buffer{
+		Path:   path,
+		Format: defaultFormat,
+		lines:  newLineStore([][]byte{{}}),
+	}
+}
+
+// OpenBuffer reads path into a new buffer. A file that does not exist yet
+// yields an empty buffer that will be created on the first save.
+func OpenBuffer(path string) (*Buffer, error) {
+	b := NewBuffer(path)
+	err := b.readFile(path, detectEncoding)
+	return b, err
+}
+
+// LineCount returns the number of lines in the buffer.
+func (b *Buffer) LineCount() int {
+	return b.lines.count()
+}
+
+// Line returns the runes of the given row, or nil if it is out of range.
+// The slice is decoded afresh on every call and must not be modified.
+func (b *Buffer) Line(row int) []rune {
+	if row < 0 || row >= b.lines.count() {
+		return nil
+	}
+	line, _ := decodeLine(b.rawLine(row))
+	return line
+}
+
+// rawLine returns the bytes of row without its line ending.
+func (b *Buffer) rawLine(row int) []byte {
+	return bytes.TrimSuffix(b.lines.line(row), []byte("\r"))
+}
+
+// Close releases the file a large buffer reads its lines from and removes
+// the buffer's swap file. Unsaved changes are discarded.
+func (b *Buffer) Close() {
+	b.lines.close()
+	b.removeSwap()
+}
+
+// ErrChangedOnDisk is returned by Save when the file was changed by another
+// program since the buffer read it. AcceptDiskVersion lets the next Save
+// overwrite it.
+var ErrChangedOnDisk = errors.New("file has changed on disk")
+
+// undoHistoryError is returned by Save and SaveAs when the file was saved
+// but the undo history kept for it could not be, so the next session
+// cannot undo past the save.
+type undoHistoryError struct {
+	err error
+}
+
+func (e undoHistoryError) Error() string {
+	return "error saving undo history: " + e.err.Error()
+}
+
+func (e undoHistoryError) Unwrap() error {
+	return e.err
+}
+
+// SaveAs writes the buffer to path, which becomes the buffer's path if the
+// file is written.
+func (b *Buffer) SaveAs(path string) error {
+	oldPath := b.Path
+	b.Path = path
+	err := b.writeFile(path)
+	if err != nil && !errors.As(err, new(undoHistoryError)) {
+		b.Path = oldPath
+	}
+	return err
+}
+
+// Save writes the buffer back to its path.
+func (b *Buffer) Save() error {
+	change, err := b.diskChange()
+	if err != nil {
+		return err
+	}
+	if change == diskModified {
+		return ErrChangedOnDisk
+	}
+	return b.writeFile(b.Path)
+}
+
+// Files up to eagerLoadBytes are read into memory when opened. Larger
+// files are only scanned, and their lines read from disk as they are used,
+// unless they have to be converted from another encoding than UTF-8.
+const eagerLoadBytes = 8 << 20
+
+// readFile replaces the buffer with the contents of filename, decoded from
+// enc or from the encoding it appears to be in if enc is detectEncoding.
+func (b *Buffer) readFile(filename string, enc Encoding) error {
+	b.Path = filename
+	b.lines.close()
+	b.lines = newLineStore([][]byte{{}})
+	b.InvalidBytes = 0
+	b.firstInvalidRow = -1
+	b.history = undoHistory{}
+	b.disk = diskState{}
+	b.Format = defaultFormat
+
+	file, err := os.Open(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	var src *lineSource
+	if info.Size() > eagerLoadBytes {
+		src = &lineSource{file: file, size: info.Size(), modTime: info.ModTime()}
+	} else {
+		defer file.Close()
+	}
+
+	hasher := sha256.New()
+	reader := bufio.NewReader(io.TeeReader(file, hasher))
+	prefix, _ := reader.Peek(sniffBytes)
+	detect := enc == detectEncoding
+	if detect {
+		enc = sniffEncoding(prefix)
+	}
+	var offset int64
+	if bom := enc.bom(); bom != nil && bytes.HasPrefix(prefix, bom) {
+		reader.Discard(len(bom))
+		offset = int64(len(bom))
+	}
+	var input io.Reader = reader
+	if src == nil || enc != EncodingUTF8 {
+		data, err := io.ReadAll(reader)
+		if err != nil {
+			if src != nil {
+				src.file.Close()
+			}
+			return err
+		}
+		if detect && enc == EncodingUTF8 && src == nil && looksLatin1(data) {
+			enc = EncodingLatin1
+		}
+		if enc != EncodingUTF8 {
+			data = enc.decode(data)
+			if src != nil {
+				src.file.Close()
+				src = nil
+			}
+		}
+		input = bytes.NewReader(data)
+	}
+
+	row, lf, crlf := 0, 0, 0
+	terminated := false
+	lines, err := readLineStore(input, src, offset, func(line []byte, lineTerminated bool) {
+		terminated = lineTerminated
+		if terminated && bytes.HasSuffix(line, []byte("\r")) {
+			crlf++
+		} else if terminated {
+			lf++
+		}
+		if !utf8.Valid(line) {
+			_, invalid := decodeLine(line)
+			if b.firstInvalidRow < 0 {
+				b.firstInvalidRow = row
+			}
+			b.InvalidBytes += invalid
+		}
+		row++
+	})
+	if err != nil {
+		if src != nil {
+			src.file.Close()
+		}
+		return err
+	}
+	b.lines = lines
+	b.Format = FileFormat{
+		Encoding:     enc,
+		LineEnding:   LineEndingLF,
+		BOM:          offset > 0,
+		FinalNewline: terminated,
+	}
+	if crlf > lf {
+		b.Format.LineEnding = LineEndingCRLF
+	}
+	b.disk = diskState{
+		exists:  true,
+		modTime: info.ModTime(),
+		size:    info.Size(),
+		hash:    hex.EncodeToString(hasher.Sum(nil)),
+	}
+	b.loadUndoHistory(b.disk.hash)
+	return nil
+}
+
+// invalidBytesMessage describes the undecodable bytes found by readFile, or
+// returns "" if the file was valid UTF-8.
+func (b *Buffer) invalidBytesMessage() string {
+	if b.InvalidBytes == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d invalid UTF-8 bytes, first on line %d (kept as-is on save)", b.InvalidBytes, b.firstInvalidRow+1)
+}
+
+// writeFile saves the buffer to filename in its Format through
+// writeFileAtomic. On failure the file on disk is left as it was, unless it
+// had to be written in place, and the buffer stays modified. An
+// undoHistoryError means the file was saved but its undo history was not.
+func (b *Buffer) writeFile(filename string) error {
+	hasher := sha256.New()
+	enc := b.Format.Encoding
+	ending, _ := enc.encode(nil, b.Format.LineEnding.bytes())
+	err := writeFileAtomic(filename, func(w *bufio.Writer) error {
+		writer := io.MultiWriter(w, hasher)
+		if b.Format.BOM {
+			if _, err := writer.Write(enc.bom()); err != nil {
+				return err
+			}
+		}
+		row := 0
+		var encoded []byte
+		return b.lines.eachLine(func(line []byte) error {
+			row++
+			var ok bool
+			encoded, ok = enc.encode(encoded[:0], bytes.TrimSuffix(line, []byte("\r")))
+			if !ok {
+				return fmt.Errorf("line %d has characters that cannot be saved as %s", row, enc)
+			}
+			if row < b.LineCount() || b.Format.FinalNewline {
+				encoded = append(encoded, ending...)
+			}
+			_, err := writer.Write(encoded)
+			return err
+		})
+	}, b.lines.loadAll)
+	if err != nil {
+		return err
+	}
+	b.Modified = false
+	b.history.init()
+	b.history.saved = b.history.current
+	b.disk, _ = statDisk(filename)
+	b.disk.hash = hex.EncodeToString(hasher.Sum(nil))
+	b.removeSwap()
+	if err := b.saveUndoHistory(b.disk.hash); err != nil {
+		return undoHistoryError{err}
+	}
+	return nil
+}
+
+// InsertRune inserts ch at the cursor and advances the cursor past it.
+func (b *Buffer) InsertRune(ch rune) {
+	b.edit(func() {
+		line := b.Line(b.Row)
+		b.replaceLines(b.Row, 1, [][]rune{joinRunes(line[:b.Column], []rune{ch}, line[b.Column:])})
+		b.Column++
+	})
+}
+
+// InsertText inserts text at the cursor and moves the cursor past it. Line
+// breaks in text are \n.
+func (b *Buffer) InsertText(text string) {
+	if text == "" {
+		return
+	}
+	b.edit(func() {
+		line := b.Line(b.Row)
+		lines := splitRuneLines(text)
+		last := len(lines) - 1
+		column := len(lines[last])
+		lines[0] = joinRunes(line[:b.Column], lines[0])
+		lines[last] = joinRunes(lines[last], line[b.Column:])
+		b.replaceLines(b.Row, 1, lines)
+		if last == 0 {
+			b.Column += column
+		} else {
+			b.Row += last
+			b.Column = column
+		}
+	})
+}
+
+// DeleteCharacter removes the rune before the cursor, joining the current
+// line onto the previous one when the cursor is at the start of a line.
+func (b *Buffer) DeleteCharacter() {
+	if b.Column == 0 && b.Row == 0 {
+		return
+	}
+	b.edit(func() {
+		if b.Column > 0 {
+			line := b.Line(b.Row)
+			b.replaceLines(b.Row, 1, [][]rune{joinRunes(line[:b.Column-1], line[b.Column:])})
+			b.Column--
+		} else {
+			previous := b.Line(b.Row - 1)
+			b.replaceLines(b.Row-1, 2, [][]rune{joinRunes(previous, b.Line(b.Row))})
+			b.Row--
+			b.Column = len(previous)
+		}
+	})
+}
+
+// InsertNewLine splits the current line at the cursor and moves the cursor
+// to the start of the new line.
+func (b *Buffer) InsertNewLine() {
+	b.edit(func() {
+		line := b.Line(b.Row)
+		b.replaceLines(b.Row, 1, [][]rune{joinRunes(line[:b.Column]), joinRunes(line[b.Column:])})
+		b.Row++
+		b.Column = 0
+	})
+}
+
+// CopyLine returns a copy of the current line.
+func (b *Buffer) CopyLine() []rune {
+	if b.Row >= b.LineCount() {
+		return nil
+	}
+	return b.Line(b.Row)
+}
+
+// PasteLine inserts line above the cursor row. An empty line moves the
+// cursor to the next row before inserting.
+func (b *Buffer) PasteLine(line []rune) {
+	b.edit(func() {
+		if len(line) == 0 {
+			b.Row++
+			b.Column = 0
+		}
+		if b.Row > b.LineCount() {
+			b.Row = b.LineCount()
+		}
+		b.replaceLines(b.Row, 0, [][]rune{joinRunes(line)})
+	})
+}
+
+// DeleteLine removes the current line and returns its contents.
+func (b *Buffer) DeleteLine() []rune {
+	deleted := b.CopyLine()
+	if b.Row < b.LineCount() {
+		b.edit(func() {
+			if b.LineCount() == 1 {
+				b.replaceLines(b.Row, 1, [][]rune{{}})
+			} else {
+				b.replaceLines(b.Row, 1, nil)
+			}
+			if b.Row >= b.LineCount() && b.Row > 0 {
+				b.Row--
+			}
+			b.Column = 0
+		})
+	}
+	return deleted
+}
+
+// spliceLines replaces count lines starting at row without recording the
+// change. Callers other than undo and redo should use replaceLines.
+func (b *Buffer) spliceLines(row, count int, lines [][]rune) {
+	encoded := make([][]byte, len(lines))
+	for i, line := range lines {
+		encoded[i] = encodeLine(nil, line)
+	}
+	b.lines.replace(row, count, encoded)
+}
+
+// joinRunes returns a newly allocated concatenation of parts.
+func joinRunes(parts ...[]rune) []rune {
+	n := 0
+	for _, part := range parts {
+		n += len(part)
+	}
+	line := make([]rune, 0, n)
+	for _, part := range parts {
+		line = append(line, part...)
+	}
+	return line
+}
+
+func (b *Buffer) clampCursor() {
+	if b.Row >= b.LineCount() {
+		b.Row = b.LineCount() - 1
+	}
+	if b.Row < 0 {
+		b.Row = 0
+	}
+	if length := len(b.Line(b.Row)); b.Column > length {
+		b.Column = length
+	}
+}
+
+func (b *Buffer) runeIndexToDisplayCol(row int, runeIndex int, tabSize int) int {
+	line := b.Line(row)
+	col := 0
+	if runeIndex > len(line) {
+		runeIndex = len(line)
+	}
+	for i := 0; i < runeIndex; i++ {
+		col += runeDisplayWidth(line[i], tabSize)
+	}
+	return col
+}
+
+func (b *Buffer) displayColToRuneIndex(row int, displayCol int, tabSize int) int {
+	line := b.Line(row)
+	col := 0
+	for i := 0; i < len(line); i++ {
+		width := runeDisplayWidth(line[i], tabSize)
+		if col+width > displayCol {
+			return i
+		}
+		col += width
+	}
+	return len(line)
+}
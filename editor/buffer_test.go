@@ -0,0 +1,114 @@
+package editor
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+// newTestBuffer returns an untitled buffer holding text, with the cursor at
+// the start and no undo history.
+func newTestBuffer(text string) *Buffer {
+	lines := strings.Split(text, "\n")
+	encoded := make([][]byte, len(lines))
+	for i, line := range lines {
+		encoded[i] = []byte(line)
+	}
+	b := NewBuffer("untitled")
+	b.lines = newLineStore(encoded)
+	return b
+}
+
+func bufferText(b *Buffer) string {
+	lines := make([]string, b.LineCount())
+	for i := range lines {
+		lines[i] = string(b.Line(i))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestBufferEdits(t *testing.T) {
+	tests := []struct {
+		name        string
+		text        string
+		row, column int
+		edit        func(b *Buffer)
+		want        string
+		wantRow     int
+		wantColumn  int
+	}{
+		{"insert rune", "hllo", 0, 1, func(b *Buffer) { b.InsertRune('e') }, "hello", 0, 2},
+		{"insert wide rune", "ab", 0, 1, func(b *Buffer) { b.InsertRune('日') }, "a日b", 0, 2},
+		{"insert text", "one three", 0, 4, func(b *Buffer) { b.InsertText("two ") }, "one two three", 0, 8},
+		{"insert lines", "start end", 0, 6, func(b *Buffer) { b.InsertText("a\nb\nc ") }, "start a\nb\nc end", 2, 2},
+		{"delete character", "hello", 0, 5, func(b *Buffer) { b.DeleteCharacter() }, "hell", 0, 4},
+		{"delete joins lines", "one\ntwo", 1, 0, func(b *Buffer) { b.DeleteCharacter() }, "onetwo", 0, 3},
+		{"delete at start", "one", 0, 0, func(b *Buffer) { b.DeleteCharacter() }, "one", 0, 0},
+		{"new line", "onetwo", 0, 3, func(b *Buffer) { b.InsertNewLine() }, "one\ntwo", 1, 0},
+		{"delete line", "one\ntwo\nthree", 1, 2, func(b *Buffer) { b.DeleteLine() }, "one\nthree", 1, 0},
+		{"delete last line", "one\ntwo", 1, 0, func(b *Buffer) { b.DeleteLine() }, "one", 0, 0},
+		{"delete only line", "one", 0, 0, func(b *Buffer) { b.DeleteLine() }, "", 0, 0},
+		{"paste line", "one\nthree", 1, 0, func(b *Buffer) { b.PasteLine([]rune("two")) }, "one\ntwo\nthree", 1, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newTestBuffer(tt.text)
+			b.Row, b.Column = tt.row, tt.column
+			tt.edit(b)
+			if got := bufferText(b); got != tt.want {
+				t.Errorf("text = %q, want %q", got, tt.want)
+			}
+			if b.Row != tt.wantRow || b.Column != tt.wantColumn {
+				t.Errorf("cursor = %d,%d, want %d,%d", b.Row, b.Column, tt.wantRow, tt.wantColumn)
+			}
+			if modified := tt.want != tt.text; b.Modified != modified {
+				t.Errorf("Modified = %v, want %v", b.Modified, modified)
+			}
+		})
+	}
+}
+
+func TestBufferUndoRedo(t *testing.T) {
+	b := newTestBuffer("one\ntwo")
+	b.Row, b.Column = 0, 3
+	b.InsertText(" and")
+	b.Row, b.Column = 1, 3
+	b.InsertNewLine()
+	b.InsertText("three")
+	steps := []string{bufferText(b)}
+
+	b.BeginUndoGroup()
+	b.Row, b.Column = 0, 0
+	b.DeleteLine()
+	b.DeleteLine()
+	b.EndUndoGroup()
+	if got := bufferText(b); got != "three" {
+		t.Fatalf("text = %q, want %q", got, "three")
+	}
+
+	if !b.Undo() {
+		t.Fatal("Undo() = false")
+	}
+	if got := bufferText(b); got != steps[0] {
+		t.Fatalf("undoing a group: text = %q, want %q", got, steps[0])
+	}
+	var undone []string
+	for b.Undo() {
+		undone = append(undone, bufferText(b))
+	}
+	want := []string{"one and\ntwo\n", "one and\ntwo", "one\ntwo"}
+	if !slices.Equal(undone, want) {
+		t.Fatalf("undo steps = %q, want %q", undone, want)
+	}
+	if b.Modified {
+		t.Error("buffer is modified after undoing every change")
+	}
+	for b.Redo() {
+	}
+	if got := bufferText(b); got != "three" {
+		t.Errorf("after redoing everything: text = %q, want %q", got, "three")
+	}
+	if !b.Modified {
+		t.Error("buffer is not modified after redoing")
+	}
+}
@@ -0,0 +1,128 @@
+package editor
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// bufferNames returns the base names of the editor's buffers.
+func bufferNames(e *Editor) []string {
+	var names []string
+	for _, b := range e.buffers {
+		names = append(names, filepath.Base(b.Path))
+	}
+	return names
+}
+
+func checkBuffer(t *testing.T, e *Editor, after, want string) {
+	t.Helper()
+	if got := filepath.Base(e.Buffer().Path); got != want {
+		t.Errorf("after %s, editing %s, want %s", after, got, want)
+	}
+}
+
+func TestSwitchBuffers(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Chdir(t.TempDir())
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		if err := os.WriteFile(name, []byte(name+"\nsecond\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	e := NewEditor(NewMemoryScreen(80, 12))
+	for _, name := range []string{"a.txt", "b.txt", "c.txt", "./b.txt"} {
+		e.Open(name)
+	}
+	// The untitled buffer the editor starts with is replaced, and a file
+	// that is open already is not opened again.
+	if got, want := bufferNames(e), []string{"a.txt", "b.txt", "c.txt"}; !slices.Equal(got, want) {
+		t.Fatalf("buffers = %q, want %q", got, want)
+	}
+	checkBuffer(t, e, "opening b.txt again", "b.txt")
+
+	// Each buffer keeps its own cursor.
+	pressKey(e, KeyArrowDown)
+	pressKey(e, KeyCtrlN)
+	checkBuffer(t, e, "Ctrl+N", "c.txt")
+	pressKey(e, KeyCtrlN)
+	checkBuffer(t, e, "Ctrl+N at the last buffer", "a.txt")
+	pressKey(e, KeyCtrlP)
+	pressKey(e, KeyCtrlP)
+	checkBuffer(t, e, "Ctrl+P twice", "b.txt")
+	if b := e.Buffer(); b.Row != 1 {
+		t.Errorf("back in b.txt, cursor on row %d, want 1", b.Row)
+	}
+
+	for _, tt := range []struct {
+		command, want string
+	}{
+		{"b 1", "a.txt"},
+		{"b c.t", "c.txt"},
+		{"bn", "a.txt"},
+		{"bp", "c.txt"},
+	} {
+		if err := e.executeCommand(tt.command); err != nil {
+			t.Fatalf(":%s: %v", tt.command, err)
+		}
+		checkBuffer(t, e, ":"+tt.command, tt.want)
+	}
+	for _, command := range []string{"b 4", "b txt", "b z"} {
+		if err := e.executeCommand(command); err == nil {
+			t.Errorf(":%s did not fail", command)
+		}
+	}
+
+	// The buffers popup switches to the one chosen.
+	typeKeys(e, "B")
+	if e.mode != ModeBuffers {
+		t.Fatalf("mode = %v, want the buffers popup", e.mode)
+	}
+	pressKey(e, KeyArrowUp)
+	pressKey(e, KeyEnter)
+	checkBuffer(t, e, "choosing the second buffer", "b.txt")
+}
+
+func TestCloseBuffers(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Chdir(t.TempDir())
+	for _, name := range []string{"a.txt", "b.txt"} {
+		if err := os.WriteFile(name, []byte(name+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	e := NewEditor(NewMemoryScreen(80, 12))
+	e.Open("a.txt")
+	e.Open("b.txt")
+	e.Buffer().InsertRune('!')
+
+	// A buffer with unsaved changes is only closed once the user agrees.
+	if err := e.executeCommand("bd"); err != nil {
+		t.Fatal(err)
+	}
+	if e.mode != ModeUnsaved {
+		t.Fatalf("mode = %v, want the unsaved changes popup", e.mode)
+	}
+	pressKey(e, KeyEsc)
+	if got, want := bufferNames(e), []string{"a.txt", "b.txt"}; !slices.Equal(got, want) {
+		t.Fatalf("after cancelling, buffers = %q, want %q", got, want)
+	}
+	if err := e.executeCommand("bd!"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := bufferNames(e), []string{"a.txt"}; !slices.Equal(got, want) {
+		t.Fatalf("after :bd!, buffers = %q, want %q", got, want)
+	}
+	checkBuffer(t, e, ":bd!", "a.txt")
+	if data, _ := os.ReadFile("b.txt"); string(data) != "b.txt\n" {
+		t.Errorf("b.txt holds %q after closing it without saving", data)
+	}
+
+	// Closing the last buffer leaves an untitled one.
+	typeKeys(e, "B")
+	typeKeys(e, "d")
+	if got, want := bufferNames(e), []string{"untitled"}; !slices.Equal(got, want) {
+		t.Errorf("after closing the last buffer, buffers = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,286 @@
+package editor
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/mattn/go-runewidth"
+)
+
+// buffersView lists the open buffers, to switch to or close one of them.
+type buffersView struct {
+	cursor int
+}
+
+// openBuffer reads path into a new buffer and returns its index, or the
+// index of the buffer already holding it. An untitled buffer that was never
+// changed is replaced rather than kept beside it.
+func (e *Editor) openBuffer(path string) int {
+	if i := e.findBuffer(path); i >= 0 {
+		return i
+	}
+	b, err := OpenBuffer(path)
+	i := len(e.buffers)
+	if current := e.Buffer(); current.Path == "untitled" && !current.Modified && current.changes == 0 {
+		current.Close()
+		i = e.bufferIndex()
+		e.buffers[i] = b
+		for _, w := range e.allWindows() {
+			if w.buffer == current {
+				w.show(b)
+			}
+		}
+	} else {
+		e.buffers = append(e.buffers, b)
+	}
+	if err != nil {
+		e.setMessage("Error reading " + path + ": " + err.Error())
+	} else if msg := b.invalidBytesMessage(); msg != "" {
+		e.setMessage(msg)
+	}
+	return i
+}
+
+// bufferIndex returns the index of the buffer being edited.
+func (e *Editor) bufferIndex() int {
+	return slices.Index(e.buffers, e.Buffer())
+}
+
+// findBuffer returns the index of the buffer holding path, or -1.
+func (e *Editor) findBuffer(path string) int {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return -1
+	}
+	for i, b := range e.buffers {
+		if bufferPath, err := filepath.Abs(b.Path); err == nil && bufferPath == absPath {
+			return i
+		}
+	}
+	return -1
+}
+
+// switchBuffer shows the buffer at index i in the focused window. Each
+// buffer keeps its own cursor, scroll position and undo history.
+func (e *Editor) switchBuffer(i int) {
+	e.endSelection()
+	e.cancelCommand()
+	w := e.window
+	old := w.buffer
+	if e.buffers[i] != old {
+		e.hasLastSelection = false
+	}
+	old.offsetRow, old.offsetColumn = w.offsetRow, w.offsetColumn
+	w.show(e.buffers[i])
+	e.showBuffer()
+}
+
+// showBuffer is called when the focused window starts showing a buffer.
+// The first time a buffer is shown it is checked for a swap file left by an
+// earlier session, and it is checked for changes by other programs every
+// time.
+func (e *Editor) showBuffer() {
+	b := e.Buffer()
+	if !b.swapChecked {
+		b.swapChecked = true
+		if swap := b.findSwap(); swap != nil {
+			e.openRecovery(swap)
+			return
+		}
+	}
+	if e.mode == ModeEditor {
+		e.checkDisk()
+	}
+}
+
+// cycleBuffer switches to the buffer count places after the current one,
+// or before it if count is negative, wrapping around the list.
+func (e *Editor) cycleBuffer(count int) {
+	n := len(e.buffers)
+	e.switchBuffer(((e.bufferIndex()+count)%n + n) % n)
+}
+
+// closeBuffer closes the buffer at index i, asking first about unsaved
+// changes unless force is set. Closing the last buffer leaves an empty,
+// untitled one.
+func (e *Editor) closeBuffer(i int, force bool) {
+	b := e.buffers[i]
+	closing := func() {
+		i := slices.Index(e.buffers, b)
+		if i < 0 {
+			return
+		}
+		b.Close()
+		e.buffers = slices.Delete(e.buffers, i, i+1)
+		if len(e.buffers) == 0 {
+			e.buffers = []*Buffer{NewBuffer("untitled")}
+		}
+		// The windows showing it show the buffer that took its place.
+		next := e.buffers[min(i, len(e.buffers)-1)]
+		for _, w := range e.allWindows() {
+			if w.buffer == b {
+				w.show(next)
+			}
+		}
+		if e.Buffer() == next {
+			e.hasLastSelection = false
+			e.showBuffer()
+		}
+		e.setMessage("Closed " + b.Path)
+	}
+	if force {
+		closing()
+		return
+	}
+	e.confirmUnsaved("close", []*Buffer{b}, closing)
+}
+
+// unsavedBuffers returns the buffers with unsaved changes.
+func (e *Editor) unsavedBuffers() []*Buffer {
+	var unsaved []*Buffer
+	for _, b := range e.buffers {
+		if b.Modified {
+			unsaved = append(unsaved, b)
+		}
+	}
+	return unsaved
+}
+
+func (e *Editor) openBuffers() {
+	e.buffersView = buffersView{cursor: e.bufferIndex()}
+	e.mode = ModeBuffers
+}
+
+// bufferLabel returns how the buffer at index i is listed in the buffers
+// popup: its number, name, whether it is modified and its directory.
+func (e *Editor) bufferLabel(i int) string {
+	b := e.buffers[i]
+	current, modified := " ", " "
+	if b == e.Buffer() {
+		current = "%"
+	}
+	if b.Modified {
+		modified = "+"
+	}
+	return fmt.Sprintf("%2d %s%s %-24s %s", i+1, current, modified, filepath.Base(b.Path), filepath.Dir(b.Path))
+}
+
+func (e *Editor) showBuffers() {
+	w, h := e.screen.Size()
+	view := &e.buffersView
+
+	pw := 72
+	visible := min(len(e.buffers), max(h-8, 1))
+	ph := visible + 5
+	x := (w - pw) / 2
+	y := max((h-ph)/2, 0)
+
+	e.drawPopupFrame(x, y, pw, ph, "Buffers")
+
+	first := max(view.cursor-visible+1, 0)
+	for i := first; i < first+visible; i++ {
+		label := runewidth.FillRight(runewidth.Truncate(e.bufferLabel(i), pw-4, "…"), pw-4)
+		var fg, bg Attribute = ColorWhite, ColorBlack
+		if i == view.cursor {
+			fg, bg = ColorBlack, ColorWhite
+		}
+		e.printCell(x+2, y+2+i-first, fg, bg, label)
+	}
+
+	footerText := "[↑/↓] Navigate  [Enter] Switch  [d] Close buffer  [Esc] Close"
+	footerX := x + (pw-runewidth.StringWidth(footerText))/2
+	e.printCell(footerX, y+ph-2, ColorBlue, ColorBlack, footerText)
+}
+
+func (e *Editor) processBuffersEvent(event Event) {
+	view := &e.buffersView
+	switch {
+	case event.Key == KeyEsc:
+		e.mode = ModeEditor
+	case event.Key == KeyArrowUp:
+		if view.cursor > 0 {
+			view.cursor--
+		}
+	case event.Key == KeyArrowDown:
+		if view.cursor < len(e.buffers)-1 {
+			view.cursor++
+		}
+	case event.Key == KeyEnter:
+		e.mode = ModeEditor
+		e.switchBuffer(view.cursor)
+	case event.Ch == 'd' || event.Key == KeyDelete:
+		e.mode = ModeEditor
+		e.closeBuffer(view.cursor, false)
+	}
+}
+
+// exBuffers opens the buffers popup.
+func (e *Editor) exBuffers(args exArgs) error {
+	e.openBuffers()
+	return nil
+}
+
+// exBuffer switches to the buffer with the number given, or the one whose
+// name contains the argument if only one does.
+func (e *Editor) exBuffer(args exArgs) error {
+	if args.arg == "" {
+		return nil
+	}
+	i, err := e.bufferArg(args.arg)
+	if err != nil {
+		return err
+	}
+	e.switchBuffer(i)
+	return nil
+}
+
+// bufferArg returns the index of the buffer a command's argument names,
+// by number or by part of its name.
+func (e *Editor) bufferArg(arg string) (int, error) {
+	if n, err := strconv.Atoi(arg); err == nil {
+		if n < 1 || n > len(e.buffers) {
+			return 0, fmt.Errorf("no buffer %d", n)
+		}
+		return n - 1, nil
+	}
+	found := -1
+	for i, b := range e.buffers {
+		if strings.Contains(b.Path, arg) {
+			if found >= 0 {
+				return 0, fmt.Errorf("more than one buffer matches %s", arg)
+			}
+			found = i
+		}
+	}
+	if found < 0 {
+		return 0, fmt.Errorf("no buffer matches %s", arg)
+	}
+	return found, nil
+}
+
+func (e *Editor) exBufferNext(args exArgs) error {
+	e.cycleBuffer(1)
+	return nil
+}
+
+func (e *Editor) exBufferPrevious(args exArgs) error {
+	e.cycleBuffer(-1)
+	return nil
+}
+
+// exBufferDelete closes the current buffer, or the one given, asking about
+// unsaved changes unless given !.
+func (e *Editor) exBufferDelete(args exArgs) error {
+	i := e.bufferIndex()
+	if args.arg != "" {
+		var err error
+		if i, err = e.bufferArg(args.arg); err != nil {
+			return err
+		}
+	}
+	e.closeBuffer(i, args.bang)
+	return nil
+}
@@ -0,0 +1,185 @@
+package editor
+
+import (
+	"encoding/base64"
+	"errors"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// Clipboard is a way to reach the system clipboard.
+type Clipboard interface {
+	Name() string
+	Copy(text string) error
+	Paste() (string, error)
+}
+
+// commandClipboard runs helper programs such as xclip, which read the text
+// to copy on standard input and write the clipboard to standard output.
+type commandClipboard struct {
+	name      string
+	copyArgs  []string
+	pasteArgs []string
+}
+
+func (c commandClipboard) Name() string {
+	return c.name
+}
+
+func (c commandClipboard) Copy(text string) error {
+	cmd := exec.Command(c.copyArgs[0], c.copyArgs[1:]...)
+	cmd.Stdin = strings.NewReader(text)
+	return cmd.Run()
+}
+
+func (c commandClipboard) Paste() (string, error) {
+	out, err := exec.Command(c.pasteArgs[0], c.pasteArgs[1:]...).Output()
+	return string(out), err
+}
+
+// backgroundClipboard copies with a helper program without waiting for it,
+// so that every copy and delete, which also go to the clipboard, does not
+// stall the editor while the program starts. Copies are made one at a time
+// in order, and one still waiting when a newer one comes is skipped. An
+// error is returned by the next Copy. Paste waits for the copies to finish,
+// so it reads the text copied last.
+type backgroundClipboard struct {
+	Clipboard
+
+	mu      sync.Mutex
+	done    sync.Cond
+	pending *string
+	running bool
+	err     error
+}
+
+func newBackgroundClipboard(c Clipboard) *backgroundClipboard {
+	bc := &backgroundClipboard{Clipboard: c}
+	bc.done.L = &bc.mu
+	return bc
+}
+
+func (c *backgroundClipboard) Copy(text string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	err := c.err
+	c.err = nil
+	c.pending = &text
+	if !c.running {
+		c.running = true
+		go c.copyPending()
+	}
+	return err
+}
+
+func (c *backgroundClipboard) copyPending() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for c.pending != nil {
+		text := *c.pending
+		c.pending = nil
+		c.mu.Unlock()
+		err := c.Clipboard.Copy(text)
+		c.mu.Lock()
+		if err != nil {
+			c.err = err
+		}
+	}
+	c.running = false
+	c.done.Broadcast()
+}
+
+func (c *backgroundClipboard) Paste() (string, error) {
+	c.mu.Lock()
+	for c.running {
+		c.done.Wait()
+	}
+	c.mu.Unlock()
+	return c.Clipboard.Paste()
+}
+
+// osc52Clipboard sets the clipboard of the terminal the editor runs in with
+// an OSC 52 escape sequence, which also works over SSH. Terminals rarely
+// let programs read the clipboard, so Paste is not supported; the
+// terminal's own paste delivers the text instead.
+type osc52Clipboard struct {
+	screen escapeWriter
+}
+
+func (c osc52Clipboard) Name() string {
+	return "osc52"
+}
+
+func (c osc52Clipboard) Copy(text string) error {
+	c.screen.WriteEscape("\x1b]52;c;" + base64.StdEncoding.EncodeToString([]byte(text)) + "\a")
+	return nil
+}
+
+func (c osc52Clipboard) Paste() (string, error) {
+	return "", errors.New("the terminal clipboard cannot be read; paste with the terminal instead")
+}
+
+var clipboardCommands = []commandClipboard{
+	{name: "wl-copy", copyArgs: []string{"wl-copy"}, pasteArgs: []string{"wl-paste", "--no-newline"}},
+	{name: "xclip", copyArgs: []string{"xclip", "-selection", "clipboard"}, pasteArgs: []string{"xclip", "-selection", "clipboard", "-o"}},
+	{name: "xsel", copyArgs: []string{"xsel", "--clipboard", "--input"}, pasteArgs: []string{"xsel", "--clipboard", "--output"}},
+	{name: "pbcopy", copyArgs: []string{"pbcopy"}, pasteArgs: []string{"pbpaste"}},
+}
+
+// clipboardSettings are the values of the clipboard setting.
+var clipboardSettings = []string{"auto", "osc52", "wl-copy", "xclip", "xsel", "pbcopy", "none"}
+
+// findClipboard returns the clipboard named by setting, or nil for "none"
+// or one that is not available. "auto" picks OSC 52 over SSH, where the
+// helpers would reach the remote machine's clipboard, and otherwise the
+// first helper that is installed for the display in use, falling back to
+// OSC 52.
+func findClipboard(setting string, screen Screen) Clipboard {
+	osc52 := func() Clipboard {
+		if w, ok := screen.(escapeWriter); ok {
+			return osc52Clipboard{screen: w}
+		}
+		return nil
+	}
+	installed := func(c commandClipboard) bool {
+		_, err := exec.LookPath(c.copyArgs[0])
+		return err == nil
+	}
+
+	switch setting {
+	case "none":
+		return nil
+	case "osc52":
+		return osc52()
+	case "", "auto":
+	default:
+		for _, c := range clipboardCommands {
+			if c.name == setting && installed(c) {
+				return newBackgroundClipboard(c)
+			}
+		}
+		return nil
+	}
+
+	if os.Getenv("SSH_TTY") != "" || os.Getenv("SSH_CONNECTION") != "" {
+		return osc52()
+	}
+	for _, c := range clipboardCommands {
+		usable := false
+		switch c.name {
+		case "wl-copy":
+			usable = os.Getenv("WAYLAND_DISPLAY") != ""
+		case "xclip", "xsel":
+			usable = os.Getenv("DISPLAY") != ""
+		case "pbcopy":
+			usable = runtime.GOOS == "darwin"
+		}
+		if usable && installed(c) {
+			return newBackgroundClipboard(c)
+		}
+	}
+	return osc52()
+}
@@ -0,0 +1,176 @@
+package editor
+
+import (
+	"encoding/base64"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// slowClipboard is a clipboard whose copies wait to be released.
+type slowClipboard struct {
+	release chan struct{}
+	copied  []string
+	err     error
+}
+
+func (c *slowClipboard) Name() string { return "slow" }
+
+func (c *slowClipboard) Copy(text string) error {
+	<-c.release
+	c.copied = append(c.copied, text)
+	return c.err
+}
+
+func (c *slowClipboard) Paste() (string, error) {
+	return c.copied[len(c.copied)-1], nil
+}
+
+func TestBackgroundClipboard(t *testing.T) {
+	slow := &slowClipboard{release: make(chan struct{})}
+	c := newBackgroundClipboard(slow)
+
+	// Copies return before the helper is done.
+	for _, text := range []string{"one", "two", "three"} {
+		if err := c.Copy(text); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(slow.release)
+	if text, err := c.Paste(); text != "three" || err != nil {
+		t.Errorf("Paste() = %q, %v, want %q", text, err, "three")
+	}
+	// At most the first copy was under way; the others waited, and only
+	// the newest of them was made.
+	if len(slow.copied) > 2 || slow.copied[len(slow.copied)-1] != "three" {
+		t.Errorf("copied %q, want three last and no more than two copies", slow.copied)
+	}
+
+	slow.err = errors.New("no display")
+	if err := c.Copy("four"); err != nil {
+		t.Fatal(err)
+	}
+	c.Paste()
+	if err := c.Copy("five"); err == nil || err.Error() != "no display" {
+		t.Errorf("Copy after a failed copy = %v, want the error", err)
+	}
+}
+
+func TestFindClipboard(t *testing.T) {
+	screen := NewMemoryScreen(80, 8)
+	for _, tt := range []struct {
+		setting string
+		ssh     bool
+		want    string
+	}{
+		{"none", false, ""},
+		{"osc52", false, "osc52"},
+		{"auto", true, "osc52"},
+		// Without a display or a helper, auto falls back to OSC 52.
+		{"auto", false, "osc52"},
+		// A helper that is not installed gives no clipboard.
+		{"xclip", false, ""},
+	} {
+		t.Setenv("PATH", t.TempDir())
+		t.Setenv("DISPLAY", "")
+		t.Setenv("WAYLAND_DISPLAY", "")
+		t.Setenv("SSH_CONNECTION", "")
+		t.Setenv("SSH_TTY", "")
+		if tt.ssh {
+			t.Setenv("SSH_TTY", "/dev/pts/0")
+		}
+		got := ""
+		if c := findClipboard(tt.setting, screen); c != nil {
+			got = c.Name()
+		}
+		if got != tt.want {
+			t.Errorf("findClipboard(%q), ssh %v = %q, want %q", tt.setting, tt.ssh, got, tt.want)
+		}
+	}
+}
+
+func TestOSC52Copy(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	useSettings(t, Settings{TabSize: 4, Theme: "one-dark", Clipboard: "osc52"})
+	screen := NewMemoryScreen(80, 8)
+	e := NewEditor(screen)
+	b := newTestBuffer("one\ntwo")
+	e.buffers, e.window.buffer = []*Buffer{b}, b
+
+	typeKeys(e, "yy")
+	want := []string{"\x1b]52;c;" + base64.StdEncoding.EncodeToString([]byte("one\n")) + "\a"}
+	if !reflect.DeepEqual(screen.Escapes, want) {
+		t.Errorf("escapes = %q, want %q", screen.Escapes, want)
+	}
+	// The terminal clipboard cannot be read, so "+p pastes the last copy.
+	pressKey(e, KeyArrowDown)
+	typeKeys(e, `"+p`)
+	if got, want := bufferText(b), "one\none\ntwo"; got != want {
+		t.Errorf("after \"+p, buffer = %q, want %q", got, want)
+	}
+}
+
+func TestBracketedPaste(t *testing.T) {
+	var events []Event
+	for _, ch := range "\x1b[200~if x {\n\ty\x1b[201~z" {
+		switch ch {
+		case '\x1b':
+			events = append(events, Event{Type: EventKey, Key: KeyEsc})
+		case '\n':
+			events = append(events, Event{Type: EventKey, Key: KeyEnter})
+		case '\t':
+			events = append(events, Event{Type: EventKey, Key: KeyTab})
+		case ' ':
+			events = append(events, Event{Type: EventKey, Key: KeySpace})
+		default:
+			events = append(events, Event{Type: EventKey, Ch: ch})
+		}
+	}
+	// A lone Esc is typing, not the start of a paste.
+	events = append(events, Event{Type: EventKey, Key: KeyEsc}, Event{Type: EventKey, Ch: '['})
+	r := &pasteReader{next: func(time.Duration) (Event, bool) {
+		if len(events) == 0 {
+			return Event{}, false
+		}
+		event := events[0]
+		events = events[1:]
+		return event, true
+	}}
+	var got []Event
+	for {
+		event, ok := r.read(-1)
+		if !ok {
+			break
+		}
+		got = append(got, event)
+	}
+	want := []Event{
+		{Type: EventPaste, Text: "if x {\n\ty"},
+		{Type: EventKey, Ch: 'z'},
+		{Type: EventKey, Key: KeyEsc},
+		{Type: EventKey, Ch: '['},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("events = %v, want %v", got, want)
+	}
+
+	// The paste goes in as it is, without indenting, and one undo takes
+	// it back.
+	t.Setenv("HOME", t.TempDir())
+	e := NewEditor(NewMemoryScreen(80, 8))
+	b := newTestBuffer("\tfunc() {\n\t")
+	e.buffers, e.window.buffer = []*Buffer{b}, b
+	pressKey(e, KeyArrowDown)
+	typeKeys(e, "i")
+	pressKey(e, KeyEnd)
+	e.HandleEvent(got[0])
+	if got, want := bufferText(b), "\tfunc() {\n\tif x {\n\ty"; got != want {
+		t.Errorf("buffer = %q, want %q", got, want)
+	}
+	pressKey(e, KeyEsc)
+	b.Undo()
+	if got, want := bufferText(b), "\tfunc() {\n\t"; got != want {
+		t.Errorf("after undo, buffer = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,156 @@
+package editor
+
+import (
+	"path/filepath"
+
+	"github.com/mattn/go-runewidth"
+)
+
+// commandLineView is the line typed after ':' in the status bar row.
+type commandLineView struct {
+	input  []rune
+	cursor int
+
+	// history indexes Editor.commandHistory while browsing it with the
+	// arrow keys; draft keeps what was typed before browsing started.
+	history int
+	draft   []rune
+
+	// completions are the candidates Tab cycles through, and completion
+	// the one currently shown.
+	completions []string
+	completion  int
+}
+
+// openCommandLine opens the command line. From a selection, it leaves the
+// selection and starts the line with the range of the selected lines.
+func (e *Editor) openCommandLine() {
+	selecting := e.selecting()
+	e.endSelection()
+	e.commandLine = commandLineView{history: len(e.commandHistory)}
+	e.mode = ModeCommandLine
+	if selecting {
+		e.commandLine.setInput("'<,'>")
+	}
+}
+
+func (e *Editor) displayCommandLine() {
+	view := &e.commandLine
+	text := ":" + string(view.input)
+	e.printCell(0, e.rows, CurrentTheme.Foreground, CurrentTheme.Background, runewidth.FillRight(text, e.cols))
+
+	if len(view.completions) > 1 {
+		col := 0
+		for i, completion := range view.completions {
+			label := " " + filepath.Base(completion) + " "
+			if completion[len(completion)-1] == '/' {
+				label = " " + filepath.Base(completion) + "/ "
+			}
+			if col+runewidth.StringWidth(label) > e.cols {
+				break
+			}
+			fg, bg := CurrentTheme.StatusBarFg, CurrentTheme.StatusBarBg
+			if i == view.completion {
+				fg, bg = CurrentTheme.StatusModeFg, CurrentTheme.StatusModeBg
+			}
+			e.printCell(col, e.rows-1, fg, bg, label)
+			col += runewidth.StringWidth(label)
+		}
+		e.printCell(col, e.rows-1, CurrentTheme.StatusBarFg, CurrentTheme.StatusBarBg, runewidth.FillRight("", e.cols-col))
+	}
+}
+
+// commandLineCursor returns the screen column of the command line cursor.
+func (e *Editor) commandLineCursor() int {
+	return 1 + runewidth.StringWidth(string(e.commandLine.input[:e.commandLine.cursor]))
+}
+
+func (e *Editor) processCommandLineEvent(event Event) {
+	view := &e.commandLine
+	if event.Key != KeyTab {
+		view.completions = nil
+	}
+	switch {
+	case event.Key == KeyEsc:
+		e.mode = ModeEditor
+	case event.Key == KeyEnter:
+		line := string(view.input)
+		e.mode = ModeEditor
+		if line != "" && (len(e.commandHistory) == 0 || e.commandHistory[len(e.commandHistory)-1] != line) {
+			e.commandHistory = append(e.commandHistory, line)
+		}
+		if err := e.executeCommand(line); err != nil {
+			e.setMessage(err.Error())
+		}
+	case event.Key == KeyBackspace || event.Key == KeyBackspace2:
+		if len(view.input) == 0 {
+			e.mode = ModeEditor
+		} else if view.cursor > 0 {
+			view.input = append(view.input[:view.cursor-1], view.input[view.cursor:]...)
+			view.cursor--
+		}
+	case event.Key == KeyArrowLeft:
+		if view.cursor > 0 {
+			view.cursor--
+		}
+	case event.Key == KeyArrowRight:
+		if view.cursor < len(view.input) {
+			view.cursor++
+		}
+	case event.Key == KeyHome:
+		view.cursor = 0
+	case event.Key == KeyEnd:
+		view.cursor = len(view.input)
+	case event.Key == KeyArrowUp:
+		if view.history > 0 {
+			if view.history == len(e.commandHistory) {
+				view.draft = view.input
+			}
+			view.history--
+			view.setInput(e.commandHistory[view.history])
+		}
+	case event.Key == KeyArrowDown:
+		if view.history < len(e.commandHistory)-1 {
+			view.history++
+			view.setInput(e.commandHistory[view.history])
+		} else if view.history == len(e.commandHistory)-1 {
+			view.history++
+			view.setInput(string(view.draft))
+		}
+	case event.Key == KeyTab:
+		view.complete()
+	case event.Key == KeySpace:
+		view.insert(' ')
+	case event.Ch != 0:
+		view.insert(event.Ch)
+	}
+}
+
+func (view *commandLineView) setInput(line string) {
+	view.input = []rune(line)
+	view.cursor = len(view.input)
+}
+
+func (view *commandLineView) insert(ch rune) {
+	view.input = append(view.input[:view.cursor], append([]rune{ch}, view.input[view.cursor:]...)...)
+	view.cursor++
+}
+
+// complete replaces the line with the next completion candidate. The first
+// Tab looks them up; a single candidate is taken and the list dropped, so
+// the next Tab completes from there, as when descending into directories.
+func (view *commandLineView) complete() {
+	if view.completions == nil {
+		view.completions = completeCommand(string(view.input))
+		view.completion = -1
+		if len(view.completions) == 0 {
+			view.completions = nil
+			return
+		}
+	}
+	view.completion = (view.completion + 1) % len(view.completions)
+	view.setInput(view.completions[view.completion])
+	if len(view.completions) == 1 {
+		view.completions = nil
+	}
+}
@@ -0,0 +1,484 @@
+package editor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// exCommand is a command of the command line. It can be abbreviated to
+// any prefix of name that starts with short.
+type exCommand struct {
+	name  string
+	short string
+	run   func(e *Editor, args exArgs) error
+
+	// completeFiles makes the argument complete as a file path, ranged
+	// lets the command be given a line range, and keepSpace keeps the
+	// spaces at the end of the argument, which may be part of it.
+	completeFiles bool
+	ranged        bool
+	keepSpace     bool
+}
+
+// exArgs is what a command was invoked with. bang is set when its name was
+// followed by '!', and arg holds the rest of the line, trimmed unless the
+// command keeps its spaces. first and last are the rows of the range
+// before the name, or the cursor's row.
+type exArgs struct {
+	bang        bool
+	arg         string
+	first, last int
+}
+
+var exCommands = []exCommand{
+	{name: "bdelete", short: "bd", run: (*Editor).exBufferDelete},
+	{name: "bnext", short: "bn", run: (*Editor).exBufferNext},
+	{name: "bprevious", short: "bp", run: (*Editor).exBufferPrevious},
+	{name: "buffer", short: "b", run: (*Editor).exBuffer},
+	{name: "buffers", short: "buffers", run: (*Editor).exBuffers},
+	{name: "close", short: "clo", run: (*Editor).exClose},
+	{name: "edit", short: "e", run: (*Editor).exEdit, completeFiles: true},
+	{name: "ls", short: "ls", run: (*Editor).exBuffers},
+	{name: "only", short: "on", run: (*Editor).exOnly},
+	{name: "quit", short: "q", run: (*Editor).exQuit},
+	{name: "registers", short: "reg", run: (*Editor).exRegisters},
+	{name: "substitute", short: "s", run: (*Editor).exSubstitute, ranged: true, keepSpace: true},
+	{name: "set", short: "se", run: (*Editor).exSet},
+	{name: "split", short: "sp", run: (*Editor).exSplit, completeFiles: true},
+	{name: "tabclose", short: "tabc", run: (*Editor).exTabClose},
+	{name: "tabedit", short: "tabe", run: (*Editor).exTabNew, completeFiles: true},
+	{name: "tabmove", short: "tabm", run: (*Editor).exTabMove},
+	{name: "tabnew", short: "tabnew", run: (*Editor).exTabNew, completeFiles: true},
+	{name: "tabnext", short: "tabn", run: (*Editor).exTabNext},
+	{name: "tabonly", short: "tabo", run: (*Editor).exTabOnly},
+	{name: "tabprevious", short: "tabp", run: (*Editor).exTabPrevious},
+	{name: "vsplit", short: "vs", run: (*Editor).exVsplit, completeFiles: true},
+	{name: "write", short: "w", run: (*Editor).exWrite, completeFiles: true},
+	{name: "wq", short: "wq", run: (*Editor).exWriteQuit, completeFiles: true},
+	{name: "xit", short: "x", run: (*Editor).exWriteQuit, completeFiles: true},
+}
+
+// findExCommand returns the command name abbreviates, or nil.
+func findExCommand(name string) *exCommand {
+	for i := range exCommands {
+		cmd := &exCommands[i]
+		if strings.HasPrefix(cmd.name, name) && strings.HasPrefix(name, cmd.short) {
+			return cmd
+		}
+	}
+	return nil
+}
+
+// splitExCommand splits a command line into the command name, whether it
+// was followed by '!', and its argument. Spaces at the end are left on the
+// argument.
+func splitExCommand(line string) (string, bool, string) {
+	line = strings.TrimLeft(line, " \t")
+	end := 0
+	for end < len(line) && (line[end] >= 'a' && line[end] <= 'z') {
+		end++
+	}
+	name, rest := line[:end], line[end:]
+	bang := strings.HasPrefix(rest, "!")
+	if bang {
+		rest = rest[1:]
+	}
+	return name, bang, strings.TrimLeft(rest, " \t")
+}
+
+// parseLineRange reads the line range at the start of line: "%" for the
+// whole buffer, or one or two addresses separated by a comma. It returns
+// the first and last row, the rest of the line and whether there was a
+// range at all.
+func (e *Editor) parseLineRange(line string) (int, int, string, bool, error) {
+	b := e.Buffer()
+	if rest, ok := strings.CutPrefix(line, "%"); ok {
+		return 0, b.LineCount() - 1, rest, true, nil
+	}
+	first, rest, ok, err := e.parseLineAddress(line)
+	if err != nil || !ok {
+		return b.Row, b.Row, line, false, err
+	}
+	last := first
+	if after, found := strings.CutPrefix(rest, ","); found {
+		last, rest, ok, err = e.parseLineAddress(after)
+		if err != nil {
+			return 0, 0, "", false, err
+		}
+		if !ok {
+			return 0, 0, "", false, fmt.Errorf("missing line after ',': %s", line)
+		}
+	}
+	if first > last {
+		first, last = last, first
+	}
+	return first, last, rest, true, nil
+}
+
+// parseLineAddress reads a line number, "." for the cursor's line, "$"
+// for the last one or '< and '> for the first and last line of the last
+// selection, optionally followed by +n or -n, and returns its row clamped
+// to the buffer.
+func (e *Editor) parseLineAddress(line string) (int, string, bool, error) {
+	b := e.Buffer()
+	row := 0
+	switch {
+	case strings.HasPrefix(line, "."):
+		row, line = b.Row, line[1:]
+	case strings.HasPrefix(line, "$"):
+		row, line = b.LineCount()-1, line[1:]
+	case strings.HasPrefix(line, "'<"), strings.HasPrefix(line, "'>"):
+		if !e.hasLastSelection {
+			return 0, "", false, errors.New("no previous selection")
+		}
+		row = e.lastSelection[0]
+		if line[1] == '>' {
+			row = e.lastSelection[1]
+		}
+		line = line[2:]
+	case line != "" && line[0] >= '0' && line[0] <= '9':
+		end := strings.IndexFunc(line, func(r rune) bool { return r < '0' || r > '9' })
+		if end < 0 {
+			end = len(line)
+		}
+		n, err := strconv.Atoi(line[:end])
+		if err != nil {
+			return 0, "", false, fmt.Errorf("invalid line number: %s", line[:end])
+		}
+		row, line = n-1, line[end:]
+	case line != "" && (line[0] == '+' || line[0] == '-'):
+		row = b.Row
+	default:
+		return 0, line, false, nil
+	}
+	for line != "" && (line[0] == '+' || line[0] == '-') {
+		sign := 1
+		if line[0] == '-' {
+			sign = -1
+		}
+		end := strings.IndexFunc(line[1:], func(r rune) bool { return r < '0' || r > '9' }) + 1
+		if end <= 0 {
+			end = len(line)
+		}
+		n := 1
+		if end > 1 {
+			n, _ = strconv.Atoi(line[1:end])
+		}
+		row, line = row+sign*n, line[end:]
+	}
+	return min(max(row, 0), b.LineCount()-1), line, true, nil
+}
+
+// executeCommand runs a line typed on the command line, without its ':'.
+// A range on its own moves the cursor to its last line.
+func (e *Editor) executeCommand(line string) error {
+	line = strings.TrimLeft(line, " \t")
+	if strings.TrimSpace(line) == "" {
+		return nil
+	}
+	first, last, rest, ranged, err := e.parseLineRange(line)
+	if err != nil {
+		return err
+	}
+	if ranged && strings.TrimSpace(rest) == "" {
+		b := e.Buffer()
+		b.Row, b.Column = last, 0
+		return nil
+	}
+	name, bang, arg := splitExCommand(rest)
+	cmd := findExCommand(name)
+	if name == "" || cmd == nil {
+		return fmt.Errorf("not an editor command: %s", line)
+	}
+	if ranged && !cmd.ranged {
+		return fmt.Errorf("%s does not take a line range", cmd.name)
+	}
+	if !cmd.keepSpace {
+		arg = strings.TrimRight(arg, " \t")
+	}
+	return cmd.run(e, exArgs{bang: bang, arg: arg, first: first, last: last})
+}
+
+// exEdit opens a file, or switches to it if it is already open. Without
+// an argument, or given the buffer's own file, it reads that file again,
+// which only discards unsaved changes with !.
+func (e *Editor) exEdit(args exArgs) error {
+	b := e.Buffer()
+	if args.arg != "" && !samePath(expandHome(args.arg), b.Path) {
+		e.Open(expandHome(args.arg))
+		return nil
+	}
+	if b.Modified && !args.bang {
+		return errors.New("the buffer has unsaved changes (add ! to discard them)")
+	}
+	if err := b.Reload(); err != nil {
+		return fmt.Errorf("error reloading %s: %w", b.Path, err)
+	}
+	e.setMessage("Reloaded " + b.Path)
+	return nil
+}
+
+// exQuit closes the window, or quits if it is the last one, asking about
+// unsaved changes unless given !.
+func (e *Editor) exQuit(args exArgs) error {
+	if e.layout.window == nil || len(e.tabs) > 1 {
+		e.closeWindow()
+		return nil
+	}
+	if args.bang {
+		e.quit()
+		return nil
+	}
+	e.confirmQuit()
+	return nil
+}
+
+// exSplit splits the window, showing the file given in the new one.
+func (e *Editor) exSplit(args exArgs) error {
+	return e.splitAndOpen(false, args.arg)
+}
+
+// exVsplit splits the window side by side, showing the file given in the
+// new one.
+func (e *Editor) exVsplit(args exArgs) error {
+	return e.splitAndOpen(true, args.arg)
+}
+
+func (e *Editor) splitAndOpen(vertical bool, path string) error {
+	if e.splitWindow(vertical) && path != "" {
+		e.Open(expandHome(path))
+	}
+	return nil
+}
+
+func (e *Editor) exClose(args exArgs) error {
+	e.closeWindow()
+	return nil
+}
+
+func (e *Editor) exOnly(args exArgs) error {
+	e.onlyWindow()
+	return nil
+}
+
+// exWrite saves the buffer, or with an argument saves it under that name.
+// An existing file other than the buffer's own, however it is named, is
+// only overwritten with !.
+func (e *Editor) exWrite(args exArgs) error {
+	b := e.Buffer()
+	if args.arg == "" || samePath(expandHome(args.arg), b.Path) {
+		e.save()
+		return nil
+	}
+	path := expandHome(args.arg)
+	if _, err := os.Stat(path); err == nil && !args.bang {
+		return fmt.Errorf("%s exists (add ! to override)", path)
+	}
+	err := b.SaveAs(path)
+	if err != nil && !errors.As(err, new(undoHistoryError)) {
+		return fmt.Errorf("error saving %s: %w", path, err)
+	}
+	e.reportSaved(b, err)
+	return nil
+}
+
+func (e *Editor) exWriteQuit(args exArgs) error {
+	if err := e.exWrite(args); err != nil {
+		return err
+	}
+	if !e.Buffer().Modified {
+		return e.exQuit(exArgs{})
+	}
+	return nil
+}
+
+// editorOption is a setting that :set can change for the session. Options
+// go by the key they have in settings.json, or by one of their aliases.
+type editorOption struct {
+	key     string
+	aliases []string
+	get     func() string
+	set     func(value string) error
+}
+
+var editorOptions = []editorOption{
+	{
+		key:     "tab_size",
+		aliases: []string{"tabsize", "ts"},
+		get:     func() string { return strconv.Itoa(editSettings.TabSize) },
+		set: func(value string) error {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 || n > 16 {
+				return fmt.Errorf("tab_size must be a number from 1 to 16")
+			}
+			editSettings.TabSize = n
+			return nil
+		},
+	},
+	{
+		key: "clipboard",
+		get: func() string { return editSettings.Clipboard },
+		set: func(value string) error {
+			if !slices.Contains(clipboardSettings, value) {
+				return fmt.Errorf("clipboard must be one of %s", strings.Join(clipboardSettings, ", "))
+			}
+			editSettings.Clipboard = value
+			return nil
+		},
+	},
+	{
+		key:     "line_numbers",
+		aliases: []string{"numbers", "nu"},
+		get: func() string {
+			if editSettings.LineNumbers == "" {
+				return "absolute"
+			}
+			return editSettings.LineNumbers
+		},
+		set: func(value string) error {
+			if !slices.Contains(lineNumberSettings, value) {
+				return fmt.Errorf("line_numbers must be one of %s", strings.Join(lineNumberSettings, ", "))
+			}
+			editSettings.LineNumbers = value
+			return nil
+		},
+	},
+	{
+		key: "theme",
+		get: GetCurrentThemeKey,
+		set: func(value string) error {
+			if !SetTheme(value) {
+				return fmt.Errorf("unknown theme: %s", value)
+			}
+			return nil
+		},
+	},
+}
+
+func findEditorOption(name string) *editorOption {
+	for i := range editorOptions {
+		option := &editorOptions[i]
+		if option.key == name || slices.Contains(option.aliases, name) {
+			return option
+		}
+	}
+	return nil
+}
+
+// exSet shows every option with no argument, shows one with "key" or
+// "key?", and changes one with "key=value".
+func (e *Editor) exSet(args exArgs) error {
+	arg := args.arg
+	if arg == "" {
+		var values []string
+		for _, option := range editorOptions {
+			values = append(values, option.key+"="+option.get())
+		}
+		e.setMessage(strings.Join(values, "  "))
+		return nil
+	}
+	name, value, assign := strings.Cut(arg, "=")
+	name = strings.TrimSuffix(strings.TrimSpace(name), "?")
+	option := findEditorOption(name)
+	if option == nil {
+		return fmt.Errorf("unknown option: %s", name)
+	}
+	if !assign {
+		e.setMessage(option.key + "=" + option.get())
+		return nil
+	}
+	return option.set(strings.TrimSpace(value))
+}
+
+// expandHome replaces a leading ~/ in path with the home directory.
+func expandHome(path string) string {
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, rest)
+		}
+	}
+	return path
+}
+
+// samePath reports whether a and b name the same file: the same absolute
+// path, or a link to it.
+func samePath(a, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	if errA == nil && errB == nil && absA == absB {
+		return true
+	}
+	infoA, errA := os.Stat(a)
+	infoB, errB := os.Stat(b)
+	return errA == nil && errB == nil && os.SameFile(infoA, infoB)
+}
+
+// completeCommand returns the candidates for the word being typed at the
+// end of line: command names, option names after :set, or file paths for
+// commands that take one. Each candidate is the whole line completed.
+func completeCommand(line string) []string {
+	name, bang, arg := splitExCommand(line)
+	arg = strings.TrimRight(arg, " \t")
+	if !strings.ContainsAny(line, " !") {
+		var names []string
+		for _, cmd := range exCommands {
+			if strings.HasPrefix(cmd.name, name) {
+				names = append(names, cmd.name)
+			}
+		}
+		return names
+	}
+	cmd := findExCommand(name)
+	if cmd == nil {
+		return nil
+	}
+	prefix := cmd.name
+	if bang {
+		prefix += "!"
+	}
+	prefix += " "
+
+	var words []string
+	switch {
+	case cmd.name == "set":
+		for _, option := range editorOptions {
+			if strings.HasPrefix(option.key, arg) {
+				words = append(words, option.key)
+			}
+		}
+	case cmd.completeFiles:
+		words = completePath(arg)
+	}
+	for i, word := range words {
+		words[i] = prefix + word
+	}
+	return words
+}
+
+// completePath returns the files and directories starting with partial,
+// directories with a trailing slash. Hidden files are only offered once
+// partial names a leading dot.
+func completePath(partial string) []string {
+	dir, base := filepath.Split(partial)
+	entries, err := os.ReadDir(expandHome(dir + "."))
+	if err != nil {
+		return nil
+	}
+	var paths []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, base) || (strings.HasPrefix(name, ".") && !strings.HasPrefix(base, ".")) {
+			continue
+		}
+		if entry.IsDir() {
+			name += "/"
+		}
+		paths = append(paths, dir+name)
+	}
+	return paths
+}
@@ -0,0 +1,73 @@
+package editor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWriteOwnFileByAnotherName(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	dir := t.TempDir()
+	t.Chdir(dir)
+	if err := os.Symlink("notes.txt", "link.txt"); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"./notes.txt", filepath.Join(dir, "notes.txt"), "link.txt"} {
+		t.Run(name, func(t *testing.T) {
+			if err := os.WriteFile("notes.txt", []byte("mine\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			e := NewEditor(NewMemoryScreen(80, 8))
+			e.Open("notes.txt")
+			e.Buffer().InsertRune('!')
+
+			// Another program changes the file after it was opened.
+			if err := os.WriteFile("notes.txt", []byte("theirs\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			later := time.Now().Add(time.Minute)
+			if err := os.Chtimes("notes.txt", later, later); err != nil {
+				t.Fatal(err)
+			}
+			if err := e.exWrite(exArgs{arg: name, bang: true}); err != nil {
+				t.Fatal(err)
+			}
+			if e.mode != ModeDiskChange {
+				t.Errorf(":w! %s did not ask about the file changed on disk", name)
+			}
+			if data, _ := os.ReadFile("notes.txt"); string(data) != "theirs\n" {
+				t.Errorf("notes.txt holds %q, want the other program's version", data)
+			}
+		})
+	}
+}
+
+func TestEditReloads(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Chdir(t.TempDir())
+	if err := os.WriteFile("notes.txt", []byte("saved\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	e := NewEditor(NewMemoryScreen(80, 8))
+	e.Open("notes.txt")
+	b := e.Buffer()
+	b.InsertRune('!')
+
+	if err := e.executeCommand("e"); err == nil {
+		t.Error(":e with unsaved changes did not fail")
+	}
+	if err := e.executeCommand("e notes.txt"); err == nil {
+		t.Error(":e notes.txt with unsaved changes did not fail")
+	}
+	if got := bufferText(b); got != "!saved" {
+		t.Fatalf("buffer = %q, want the unsaved changes kept", got)
+	}
+	if err := e.executeCommand("e!"); err != nil {
+		t.Fatal(err)
+	}
+	if got := bufferText(b); got != "saved" || b.Modified {
+		t.Errorf("after :e!, buffer = %q, modified %v, want the file unmodified", got, b.Modified)
+	}
+}
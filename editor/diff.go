@@ -0,0 +1,82 @@
+package editor
+
+import "bytes"
+
+// diffLine is a line removed from or added to a buffer. row is its index
+// in the version it belongs to.
+type diffLine struct {
+	op   byte
+	row  int
+	text []rune
+}
+
+// maxDiffCells bounds the table used to line up the changed region of two
+// buffers. Larger regions are shown as removed and added wholesale.
+const maxDiffCells = 4 << 20
+
+// diffBuffers returns the lines that have to be removed from a ('-') and
+// added ('+') to turn it into b, in order.
+func diffBuffers(a, b *Buffer) []diffLine {
+	aEnd, bEnd := a.LineCount(), b.LineCount()
+	start := 0
+	for start < aEnd && start < bEnd && bytes.Equal(a.rawLine(start), b.rawLine(start)) {
+		start++
+	}
+	for aEnd > start && bEnd > start && bytes.Equal(a.rawLine(aEnd-1), b.rawLine(bEnd-1)) {
+		aEnd--
+		bEnd--
+	}
+	n, m := aEnd-start, bEnd-start
+
+	var diff []diffLine
+	removed := func(i int) { diff = append(diff, diffLine{op: '-', row: start + i, text: a.Line(start + i)}) }
+	added := func(j int) { diff = append(diff, diffLine{op: '+', row: start + j, text: b.Line(start + j)}) }
+	if n*m > maxDiffCells {
+		for i := 0; i < n; i++ {
+			removed(i)
+		}
+		for j := 0; j < m; j++ {
+			added(j)
+		}
+		return diff
+	}
+
+	aLines := make([]string, n)
+	for i := range aLines {
+		aLines[i] = string(a.rawLine(start + i))
+	}
+	bLines := make([]string, m)
+	for j := range bLines {
+		bLines[j] = string(b.rawLine(start + j))
+	}
+	// common[i][j] is the length of the longest common subsequence of
+	// aLines[i:] and bLines[j:].
+	common := make([][]int32, n+1)
+	for i := range common {
+		common[i] = make([]int32, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if aLines[i] == bLines[j] {
+				common[i][j] = common[i+1][j+1] + 1
+			} else {
+				common[i][j] = max(common[i+1][j], common[i][j+1])
+			}
+		}
+	}
+	i, j := 0, 0
+	for i < n || j < m {
+		switch {
+		case i < n && j < m && aLines[i] == bLines[j]:
+			i++
+			j++
+		case j == m || (i < n && common[i+1][j] >= common[i][j+1]):
+			removed(i)
+			i++
+		default:
+			added(j)
+			j++
+		}
+	}
+	return diff
+}
@@ -0,0 +1,67 @@
+package editor
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mattn/go-runewidth"
+)
+
+// diffView is a scrollable popup listing the lines that differ between two
+// versions of a buffer. Popups that offer to show differences draw it in
+// place of their own contents while it is open.
+type diffView struct {
+	title  string
+	lines  []diffLine
+	open   bool
+	scroll int
+}
+
+func (view *diffView) show(title string, lines []diffLine) {
+	*view = diffView{title: title, lines: lines, open: true}
+}
+
+func (e *Editor) showDiffView(view *diffView) {
+	w, h := e.screen.Size()
+
+	pw := w - 8
+	ph := h - 4
+	x := (w - pw) / 2
+	y := (h - ph) / 2
+
+	e.drawPopupFrame(x, y, pw, ph, view.title)
+
+	visibleEntries := ph - 4
+	view.scroll = max(0, min(view.scroll, len(view.lines)-visibleEntries))
+	if len(view.lines) == 0 {
+		e.printCell(x+2, y+1, ColorWhite, ColorBlack, "There are no differences.")
+	}
+	tab := strings.Repeat(" ", editSettings.TabSize)
+	endIdx := min(view.scroll+visibleEntries, len(view.lines))
+	for i := view.scroll; i < endIdx; i++ {
+		line := view.lines[i]
+		fg := ColorGreen
+		if line.op == '-' {
+			fg = ColorRed
+		}
+		label := fmt.Sprintf("%c %5d  %s", line.op, line.row+1, strings.ReplaceAll(string(line.text), "\t", tab))
+		e.printCell(x+2, y+1+(i-view.scroll), fg, ColorBlack, runewidth.Truncate(label, pw-4, "..."))
+	}
+
+	footerText := "[↑/↓] Scroll  [Esc] Back"
+	footerX := x + (pw-len(footerText))/2
+	e.printCell(footerX, y+ph-2, ColorBlue, ColorBlack, footerText)
+}
+
+func (view *diffView) processEvent(event Event) {
+	switch event.Key {
+	case KeyEsc, KeyEnter:
+		view.open = false
+	case KeyArrowUp:
+		if view.scroll > 0 {
+			view.scroll--
+		}
+	case KeyArrowDown:
+		view.scroll++
+	}
+}
@@ -0,0 +1,192 @@
+package editor
+
+import "github.com/mattn/go-runewidth"
+
+const (
+	diskReload    = "Reload from disk"
+	diskKeep      = "Keep my changes"
+	diskOverwrite = "Overwrite it with my changes"
+	diskDiff      = "Show differences"
+	diskCancel    = "Cancel"
+)
+
+// diskChangeView asks what to do about a file changed by another program
+// while its buffer holds unsaved changes, or when saving would overwrite
+// the newer version.
+type diskChangeView struct {
+	buffer  *Buffer
+	saving  bool
+	options []string
+	cursor  int
+	diff    diffView
+}
+
+func (e *Editor) openDiskChange(b *Buffer, saving bool) {
+	options := []string{diskReload, diskKeep, diskDiff}
+	if saving {
+		options = []string{diskOverwrite, diskReload, diskDiff, diskCancel}
+	}
+	e.diskChange = diskChangeView{buffer: b, saving: saving, options: options}
+	e.mode = ModeDiskChange
+}
+
+// checkDisk looks for files changed by other programs among the open
+// buffers, whether they are shown in a window of any tab page or not.
+// Buffers without changes of their own are reloaded; about the first one
+// with changes, the current buffer before the others, the user is asked.
+func (e *Editor) checkDisk() {
+	current := e.Buffer()
+	var ask *Buffer
+	if e.checkBufferDisk(current) {
+		ask = current
+	}
+	for _, b := range e.buffers {
+		if b != current && e.checkBufferDisk(b) && ask == nil {
+			ask = b
+		}
+	}
+	if ask != nil {
+		e.openDiskChange(ask, false)
+	}
+}
+
+// checkBufferDisk reloads b if its file was changed by another program
+// and b has no changes of its own. It reports whether b has, so that the
+// user has to be asked. A buffer that read lines of a large file after it
+// was rewritten in place holds padded or cut lines instead of the file's,
+// so it is reloaded even if the file now looks as it did when it was
+// opened.
+func (e *Editor) checkBufferDisk(b *Buffer) bool {
+	if err := b.lines.intact(); err != nil && !b.Modified {
+		if err := b.Reload(); err != nil {
+			e.setMessage("Error reloading " + b.Path + ": " + err.Error())
+		} else {
+			e.setMessage("Reloaded " + b.Path + ", which was rewritten in place by another program")
+		}
+		return false
+	}
+	change, err := b.diskChange()
+	if err != nil {
+		return false
+	}
+	switch {
+	case change == diskRemoved:
+		if err := b.AcceptDiskVersion(); err == nil {
+			e.setMessage(b.Path + " was removed by another program; saving will recreate it")
+		}
+	case change == diskModified && !b.Modified:
+		if err := b.Reload(); err != nil {
+			e.setMessage("Error reloading " + b.Path + ": " + err.Error())
+		} else {
+			e.setMessage("Reloaded " + b.Path + ", which was changed by another program")
+		}
+	case change == diskModified:
+		return true
+	}
+	return false
+}
+
+func (e *Editor) showDiskChange() {
+	view := &e.diskChange
+	if view.diff.open {
+		e.showDiffView(&view.diff)
+		return
+	}
+	w, h := e.screen.Size()
+	b := view.buffer
+
+	text := []string{b.Path + " has been changed by another program."}
+	if view.saving {
+		text = append(text, "Saving now would overwrite that version.")
+	} else {
+		text = append(text, "Reloading it discards your unsaved changes.")
+	}
+	if b.lines.intact() != nil {
+		text = append(text, "It was rewritten in place, so lines not yet read",
+			"from it are lost; the buffer cannot be saved until reloaded.")
+	}
+
+	pw := 64
+	ph := len(text) + len(view.options) + 5
+	x := (w - pw) / 2
+	y := (h - ph) / 2
+
+	e.drawPopupFrame(x, y, pw, ph, "File Changed")
+
+	for i, line := range text {
+		e.printCell(x+2, y+1+i, ColorWhite, ColorBlack, runewidth.Truncate(line, pw-4, "..."))
+	}
+	for i, option := range view.options {
+		var fg, bg Attribute = ColorWhite, ColorBlack
+		if i == view.cursor {
+			fg, bg = ColorBlack, ColorWhite
+		}
+		e.printCell(x+2, y+2+len(text)+i, fg, bg, option)
+	}
+
+	footerText := "[↑/↓] Navigate  [Enter] Select"
+	if view.saving {
+		footerText += "  [Esc] Cancel"
+	}
+	footerX := x + (pw-len(footerText))/2
+	e.printCell(footerX, y+ph-2, ColorBlue, ColorBlack, footerText)
+}
+
+func (e *Editor) processDiskChangeEvent(event Event) {
+	view := &e.diskChange
+	if view.diff.open {
+		view.diff.processEvent(event)
+		return
+	}
+
+	switch event.Key {
+	case KeyEsc:
+		if view.saving {
+			e.mode = ModeEditor
+		}
+	case KeyArrowUp:
+		if view.cursor > 0 {
+			view.cursor--
+		}
+	case KeyArrowDown:
+		if view.cursor < len(view.options)-1 {
+			view.cursor++
+		}
+	case KeyEnter:
+		e.selectDiskChangeOption(view.options[view.cursor])
+	}
+}
+
+func (e *Editor) selectDiskChangeOption(option string) {
+	view := &e.diskChange
+	b := view.buffer
+	switch option {
+	case diskReload:
+		e.mode = ModeEditor
+		if err := b.Reload(); err != nil {
+			e.setMessage("Error reloading " + b.Path + ": " + err.Error())
+		} else {
+			e.setMessage("Reloaded " + b.Path)
+		}
+	case diskKeep, diskOverwrite:
+		e.mode = ModeEditor
+		if err := b.AcceptDiskVersion(); err != nil {
+			e.setMessage("Error reading " + b.Path + ": " + err.Error())
+			return
+		}
+		if option == diskOverwrite {
+			e.save()
+		}
+	case diskDiff:
+		onDisk := NewBuffer(b.Path)
+		if err := onDisk.readFile(b.Path, b.Format.Encoding); err != nil {
+			onDisk.Close()
+			e.setMessage("Error reading " + b.Path + ": " + err.Error())
+			return
+		}
+		view.diff.show("Your Changes Against the File on Disk", diffBuffers(onDisk, b))
+		onDisk.Close()
+	case diskCancel:
+		e.mode = ModeEditor
+	}
+}
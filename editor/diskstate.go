@@ -0,0 +1,115 @@
+package editor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"time"
+)
+
+// diskState identifies a version of a file on disk. The modification time
+// and size are compared first; the content hash is only computed when they
+// differ, so touching a file without changing it is not reported.
+type diskState struct {
+	exists  bool
+	modTime time.Time
+	size    int64
+	hash    string
+}
+
+type diskChange int
+
+const (
+	diskUnchanged diskChange = iota
+	diskModified
+	diskRemoved
+)
+
+// statDisk returns the state of path without its hash. A missing file is
+// not an error.
+func statDisk(path string) (diskState, error) {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return diskState{}, nil
+	}
+	if err != nil {
+		return diskState{}, err
+	}
+	return diskState{exists: true, modTime: info.ModTime(), size: info.Size()}, nil
+}
+
+func hashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// readDiskState returns the state of path including its hash.
+func readDiskState(path string) (diskState, error) {
+	state, err := statDisk(path)
+	if err != nil || !state.exists {
+		return state, err
+	}
+	state.hash, err = hashFile(path)
+	return state, err
+}
+
+// diskChange reports how the file at the buffer's path differs from the
+// version the buffer last read, wrote or accepted.
+func (b *Buffer) diskChange() (diskChange, error) {
+	state, err := statDisk(b.Path)
+	if err != nil {
+		return diskUnchanged, err
+	}
+	switch {
+	case !state.exists && !b.disk.exists:
+		return diskUnchanged, nil
+	case !state.exists:
+		return diskRemoved, nil
+	case b.disk.exists && state.modTime.Equal(b.disk.modTime) && state.size == b.disk.size:
+		return diskUnchanged, nil
+	}
+	state.hash, err = hashFile(b.Path)
+	if err != nil {
+		return diskUnchanged, err
+	}
+	if b.disk.exists && state.hash == b.disk.hash {
+		b.disk = state
+		return diskUnchanged, nil
+	}
+	return diskModified, nil
+}
+
+// AcceptDiskVersion records the file as it is on disk now as the version
+// the buffer's changes are made against, so the next Save overwrites it.
+// No state in the undo history matches it, so the buffer stays modified
+// until it is saved. Lines of a large file not read yet are read first, as
+// the file they come from is about to be replaced. If it was rewritten in
+// place and they are already lost, the new version is still recorded, so
+// it is not reported again, but errSourceChanged is returned and saving
+// keeps failing until the buffer is reloaded.
+func (b *Buffer) AcceptDiskVersion() error {
+	lost := b.lines.loadAll()
+	state, err := readDiskState(b.Path)
+	if err != nil {
+		return err
+	}
+	b.disk = state
+	b.markDiverged()
+	return lost
+}
+
+// Reload reads the buffer's file again in the same encoding, discarding
+// unsaved changes. The cursor stays on the same line and column where
+// possible.
+func (b *Buffer) Reload() error {
+	return b.ReopenWithEncoding(b.Format.Encoding)
+}
@@ -0,0 +1,279 @@
+package editor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeLargeFile writes a file too large to be read into memory when it is
+// opened, with lines "<word> <n>", and returns its line count.
+func writeLargeFile(t testing.TB, path, word string) int {
+	t.Helper()
+	var sb strings.Builder
+	n := 0
+	for sb.Len() <= eagerLoadBytes+eagerLoadBytes/8 {
+		fmt.Fprintf(&sb, "%s %d\n", word, n)
+		n++
+	}
+	if err := os.WriteFile(path, []byte(sb.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestAcceptRewrittenInPlace(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	path := filepath.Join(t.TempDir(), "large.txt")
+	writeLargeFile(t, path, "original")
+	b, err := OpenBuffer(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	b.InsertRune('!')
+
+	// os.WriteFile truncates and rewrites the same file.
+	writeLargeFile(t, path, "REWRITTEN")
+	if err := b.AcceptDiskVersion(); !errors.Is(err, errSourceChanged) {
+		t.Fatalf("AcceptDiskVersion() = %v, want %v", err, errSourceChanged)
+	}
+	// The new version is recorded, so it is not reported again.
+	if change, err := b.diskChange(); change != diskUnchanged || err != nil {
+		t.Fatalf("diskChange() = %v, %v, want %v", change, err, diskUnchanged)
+	}
+	if err := b.writeFile(path); !errors.Is(err, errSourceChanged) {
+		t.Fatalf("writeFile() = %v, want %v", err, errSourceChanged)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "original") {
+		t.Error("the file on disk mixes both versions")
+	}
+}
+
+func TestReloadAfterLinesLost(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	path := filepath.Join(t.TempDir(), "large.txt")
+	lines := writeLargeFile(t, path, "original")
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := NewEditor(NewMemoryScreen(80, 8))
+	e.Open(path)
+	b := e.Buffer()
+	b.Line(0)
+
+	writeLargeFile(t, path, "ORIGINAL")
+	if got, want := string(b.Line(lines-1)), fmt.Sprintf("ORIGINAL %d", lines-1); got != want {
+		t.Fatalf("last line = %q, want %q", got, want)
+	}
+	if err := b.lines.intact(); !errors.Is(err, errSourceChanged) {
+		t.Fatalf("intact() = %v, want %v", err, errSourceChanged)
+	}
+	// The file looks as it did when it was opened, but the lines read
+	// before the rewrite are still the old ones.
+	if err := os.Chtimes(path, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	e.checkDisk()
+	if got := string(b.Line(0)); got != "ORIGINAL 0" {
+		t.Errorf("after checkDisk, first line = %q, want %q", got, "ORIGINAL 0")
+	}
+	if err := b.lines.intact(); err != nil {
+		t.Errorf("after checkDisk, intact() = %v", err)
+	}
+}
+
+func TestAcceptReplacedByRename(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	dir := t.TempDir()
+	path := filepath.Join(dir, "large.txt")
+	lines := writeLargeFile(t, path, "original")
+	b, err := OpenBuffer(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	b.InsertRune('!')
+
+	other := filepath.Join(dir, "other.txt")
+	writeLargeFile(t, other, "REWRITTEN")
+	if err := os.Rename(other, path); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.AcceptDiskVersion(); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Save(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(saved) != lines {
+		t.Fatalf("saved %d lines, want %d", len(saved), lines)
+	}
+	if saved[0] != "!original 0" {
+		t.Errorf("line 0 = %q, want %q", saved[0], "!original 0")
+	}
+	if want := fmt.Sprintf("original %d", lines/2); saved[lines/2] != want {
+		t.Errorf("line %d = %q, want %q", lines/2, saved[lines/2], want)
+	}
+}
+
+func TestCheckDiskOfEveryBuffer(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Chdir(t.TempDir())
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		if err := os.WriteFile(name, []byte(name+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	e := NewEditor(NewMemoryScreen(80, 12))
+	e.Open("c.txt")
+	e.Open("b.txt")
+	e.splitWindow(false)
+	e.Open("a.txt")
+	// b.txt is shown in the other window, c.txt in none; c.txt has
+	// changes of its own.
+	c := e.buffers[e.findBuffer("c.txt")]
+	c.InsertRune('!')
+
+	later := time.Now().Add(time.Minute)
+	for _, name := range []string{"b.txt", "c.txt"} {
+		if err := os.WriteFile(name, []byte("new "+name+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(name, later, later)
+	}
+	e.checkDisk()
+	if got := bufferText(e.buffers[e.findBuffer("b.txt")]); got != "new b.txt" {
+		t.Errorf("b.txt holds %q, want it reloaded", got)
+	}
+	if e.mode != ModeDiskChange || e.diskChange.buffer != c {
+		t.Fatalf("mode = %v, want the popup asking about c.txt", e.mode)
+	}
+	e.selectDiskChangeOption(diskReload)
+	if got := bufferText(c); got != "new c.txt" {
+		t.Errorf("c.txt holds %q, want it reloaded", got)
+	}
+	if got := bufferText(e.Buffer()); got != "a.txt" {
+		t.Errorf("current buffer holds %q, want a.txt unchanged", got)
+	}
+}
+
+// rewrite replaces the contents of path as another program would, moving
+// its modification time on so the change is seen however fast the test
+// runs.
+func rewrite(t *testing.T, path, data string) {
+	t.Helper()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	later := info.ModTime().Add(time.Second)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDiskChangeWhileIdle(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Chdir(t.TempDir())
+	if err := os.WriteFile("notes.txt", []byte("one\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	e := NewEditor(NewMemoryScreen(80, 12))
+	e.Open("notes.txt")
+	b := e.Buffer()
+
+	// Touching the file without changing it is not a change.
+	rewrite(t, "notes.txt", "one\n")
+	if change, err := b.diskChange(); change != diskUnchanged || err != nil {
+		t.Errorf("after touching the file, diskChange() = %v, %v", change, err)
+	}
+
+	// An unmodified buffer is reloaded.
+	rewrite(t, "notes.txt", "two\n")
+	e.idle()
+	if got := bufferText(b); got != "two" || e.mode != ModeEditor {
+		t.Errorf("unmodified buffer holds %q in mode %v, want it reloaded", got, e.mode)
+	}
+
+	// A modified one asks; keeping the changes lets them be saved over
+	// the new version.
+	b.InsertRune('!')
+	rewrite(t, "notes.txt", "three\n")
+	e.idle()
+	if e.mode != ModeDiskChange || e.diskChange.options[1] != diskKeep {
+		t.Fatalf("mode = %v, want the popup offering to keep the changes", e.mode)
+	}
+	e.HandleEvent(Event{Type: EventKey, Key: KeyArrowDown})
+	e.HandleEvent(Event{Type: EventKey, Key: KeyEnter})
+	if got := bufferText(b); got != "!two" || !b.Modified {
+		t.Errorf("after keeping the changes, buffer holds %q, modified %v", got, b.Modified)
+	}
+	if err := b.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile("notes.txt"); string(data) != "!two\n" {
+		t.Errorf("file holds %q, want the kept changes", data)
+	}
+
+	// A removed file is recreated by the next save.
+	os.Remove("notes.txt")
+	e.idle()
+	if !b.Modified || !strings.Contains(e.message, "removed") {
+		t.Errorf("after removing the file, modified %v, message %q", b.Modified, e.message)
+	}
+	if err := b.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile("notes.txt"); string(data) != "!two\n" {
+		t.Errorf("file holds %q after saving, want it recreated", data)
+	}
+}
+
+func TestSaveAsksBeforeOverwritingChange(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Chdir(t.TempDir())
+	if err := os.WriteFile("notes.txt", []byte("mine\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	e := NewEditor(NewMemoryScreen(80, 12))
+	e.Open("notes.txt")
+	b := e.Buffer()
+	b.InsertRune('!')
+	rewrite(t, "notes.txt", "theirs\n")
+
+	if err := b.Save(); !errors.Is(err, ErrChangedOnDisk) {
+		t.Fatalf("Save() = %v, want %v", err, ErrChangedOnDisk)
+	}
+	ctrlS := Event{Type: EventKey, Key: KeyCtrlS}
+	e.HandleEvent(ctrlS)
+	if e.mode != ModeDiskChange || !e.diskChange.saving {
+		t.Fatalf("mode = %v, want the popup asking before saving", e.mode)
+	}
+	e.HandleEvent(Event{Type: EventKey, Key: KeyEsc})
+	if data, _ := os.ReadFile("notes.txt"); string(data) != "theirs\n" {
+		t.Errorf("after cancelling, file holds %q, want it untouched", data)
+	}
+	e.HandleEvent(ctrlS)
+	e.HandleEvent(Event{Type: EventKey, Key: KeyEnter})
+	if data, _ := os.ReadFile("notes.txt"); string(data) != "!mine\n" {
+		t.Errorf("after overwriting, file holds %q, want %q", data, "!mine\n")
+	}
+}
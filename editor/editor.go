@@ -1,19 +1,15 @@
 package editor
 
-/*
-#cgo CFLAGS: -I${SRCDIR}/termbox2
-#cgo LDFLAGS: ${SRCDIR}/termbox2/libtermbox2.a -lm -lc
-#include "termbox2.h"
-*/
-import "C"
-
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/mattn/go-runewidth"
 )
@@ -25,246 +21,369 @@ const (
 	ModeHelp
 	ModeFileBrowser
 	ModeThemeSelector
+	ModeUndoTree
+	ModeRecovery
+	ModeDiskChange
+	ModeEncoding
+	ModeUnsaved
+	ModeCommandLine
+	ModeSearch
+	ModeReplace
+	ModeRegisters
+	ModeBuffers
 )
 
-var currentMode Mode = ModeEditor
-var fileBrowser *FileBrowser
+// EditMode is the modal editing state of the text area.
+type EditMode int
+
+const (
+	EditNormal EditMode = iota
+	EditInsert
+	EditVisual
+	EditVisualLine
+	EditVisualBlock
+)
 
 var editSettings, err = LoadSettings()
 
-var mode int
-var sourceFile string
-var ROWS, COLS int
-var offsetColumn, offsetRow int
-var currentColumn, currentRow int
-var textBuffer = [][]rune{}
-var undoBuffer = [][]rune{}
-var copyBuffer = []rune{}
-var modified bool
-
-func runeIndexToDisplayCol(row int, runeIndex int) int {
-	if row >= len(textBuffer) {
-		return 0
-	}
-	col := 0
-	if runeIndex > len(textBuffer[row]) {
-		runeIndex = len(textBuffer[row])
-	}
-	for i := 0; i < runeIndex; i++ {
-		ch := textBuffer[row][i]
-		if ch == '\t' {
-			col += editSettings.TabSize
-		} else {
-			col += runewidth.RuneWidth(ch)
-		}
-	}
-	return col
+// Editor holds the open buffers and the view state used to render them.
+type Editor struct {
+	screen Screen
+
+	// buffers are the open buffers, in the order the buffer list shows
+	// them. layout divides the text area between windows, and window is
+	// the one with the focus, showing the buffer being edited. They belong
+	// to tabs[tab], the tab page shown.
+	buffers []*Buffer
+	layout  *split
+	window  *window
+	tabs    []*tabPage
+	tab     int
+
+	mode     Mode
+	editMode EditMode
+
+	rows, cols       int
+	registers        registers
+	registersView    registersView
+	buffersView      buffersView
+	fileBrowser      *FileBrowser
+	undoTree         undoTreeView
+	recovery         recoveryView
+	diskChange       diskChangeView
+	encodingSelector encodingView
+	unsaved          unsavedView
+	commandLine      commandLineView
+	commandHistory   []string
+	search           searchView
+	searchMatches    searchCache
+	replace          replaceView
+
+	// lastSearch is repeated by n and N, and its matches are highlighted
+	// while highlightSearch is set.
+	lastSearch         string
+	lastSearchBackward bool
+	highlightSearch    bool
+
+	// anchorRow and anchorColumn are where the selection started in the
+	// visual modes; the cursor is its other end. lastSelection holds the
+	// first and last row of the most recent selection.
+	anchorRow, anchorColumn int
+	lastSelection           [2]int
+	hasLastSelection        bool
+
+	// register is the register chosen with '"' for the next copy, delete
+	// or paste, and choosingRegister is set while its name is awaited.
+	register         rune
+	choosingRegister bool
+
+	// keymaps holds the keymap of each mode. pendingKeys are the keys
+	// typed of a sequence that is not complete yet, and typedKeys all the
+	// keys of the unfinished command, to show in the status bar.
+	keymaps     map[string]keymap
+	pendingKeys []Event
+	typedKeys   []string
+
+	// count is the number typed before a command in normal mode. operator
+	// names the operator waiting for a motion, and operatorCount is the
+	// count typed before it. findingChar is set while the character for
+	// pendingFind is awaited, and lastFind is the last character find,
+	// which ; and , repeat.
+	count, operatorCount int
+	operator             string
+	findingChar          bool
+	pendingFind          characterFind
+	lastFind             characterFind
+
+	// recordingMacro is the register keys are being recorded into, and
+	// recordedKeys the keys so far, added to what the register already
+	// holds if appendingMacro. choosingMacro is "record" or "play" while
+	// the name of a register is awaited, with macroCount the count typed
+	// before @. playingMacros are the registers being played, innermost
+	// last, and macroFailed tells why they stop early.
+	recordingMacro rune
+	recordedKeys   []Event
+	appendingMacro bool
+	choosingMacro  string
+	macroCount     int
+	lastMacro      rune
+	playingMacros  []rune
+	macroFailed    string
+
+	// helpScroll is the first line of the help shown in its popup.
+	helpScroll int
+
+	// clipboard is the system clipboard found for clipboardSetting, the
+	// value of the clipboard setting when it was looked for, if
+	// clipboardFound is set.
+	clipboard        Clipboard
+	clipboardSetting string
+	clipboardFound   bool
+
+	// message is shown in the status bar until the next key press.
+	message string
 }
 
-func displayColToRuneIndex(row int, displayCol int) int {
-	if row >= len(textBuffer) {
-		return 0
+// NewEditor returns an editor drawing to screen and holding a single empty,
+// untitled buffer.
+func NewEditor(screen Screen) *Editor {
+	b := NewBuffer("untitled")
+	e := &Editor{
+		screen:    screen,
+		buffers:   []*Buffer{b},
+		window:    &window{buffer: b},
+		mode:      ModeEditor,
+		registers: registers{},
+	}
+	e.layout = &split{window: e.window}
+	e.tabs = []*tabPage{{layout: e.layout, window: e.window}}
+	var custom map[string]map[string]string
+	if editSettings != nil {
+		custom = editSettings.Keymaps
+	}
+	keymaps, err := loadKeymaps(custom)
+	e.keymaps = keymaps
+	if err != nil {
+		e.setMessage(err.Error())
 	}
-	col := 0
-	for i := 0; i < len(textBuffer[row]); i++ {
-		ch := textBuffer[row][i]
-		width := 0
-		if ch == '\t' {
-			width = editSettings.TabSize
-		} else {
-			width = runewidth.RuneWidth(ch)
-		}
-		if col+width > displayCol {
-			return i
-		}
-		col += width
+	if e.registers, err = loadRegisters(); err != nil {
+		e.setMessage("Error loading registers: " + err.Error())
 	}
-	return len(textBuffer[row])
+	return e
 }
 
-func printCell(col int, row int, fg C.uintattr_t, bg C.uintattr_t, msg string) {
-	for _, character := range msg {
-		C.tb_set_cell(C.int(col), C.int(row), C.uint32_t(character), fg, bg)
-		col += runewidth.RuneWidth(character)
-	}
+// Buffer returns the buffer currently being edited.
+func (e *Editor) Buffer() *Buffer {
+	return e.window.buffer
+}
+
+// Open switches to the buffer holding path, reading it into a new buffer
+// if no open buffer does.
+func (e *Editor) Open(path string) {
+	e.switchBuffer(e.openBuffer(path))
 }
 
-func readFile(filename string) {
-	file, err := os.Open(filename)
-	textBuffer = [][]rune{}
+// save writes the current buffer and reports the outcome in the status bar.
+// It returns false if the file could not be written.
+func (e *Editor) save() bool {
+	b := e.Buffer()
+	err := b.Save()
+	switch {
+	case errors.Is(err, ErrChangedOnDisk):
+		e.openDiskChange(b, true)
+		return false
+	case err != nil && !errors.As(err, new(undoHistoryError)):
+		e.setMessage("Error saving " + b.Path + ": " + err.Error())
+		return false
+	}
+	e.reportSaved(b, err)
+	return true
+}
 
+// reportSaved shows in the status bar that b was saved, and the
+// undoHistoryError err if its undo history was not.
+func (e *Editor) reportSaved(b *Buffer, err error) {
+	message := fmt.Sprintf("Saved %s (%d lines)", b.Path, b.LineCount())
 	if err != nil {
-		sourceFile = filename
-		textBuffer = append(textBuffer, []rune{})
-		return
+		message += "; " + err.Error()
 	}
-	defer file.Close()
-
-	scanner := bufio.NewScanner(file)
-	lineNumber := 0
+	e.setMessage(message)
+}
 
-	for scanner.Scan() {
-		line := scanner.Text()
-		textBuffer = append(textBuffer, []rune{})
+// idleTime is how long the main loop waits for input before doing its
+// background work: bringing swap files up to date and checking whether the
+// open file was changed by another program.
+const idleTime = 2 * time.Second
 
-		for i := 0; i < len(line); i++ {
-			textBuffer[lineNumber] = append(textBuffer[lineNumber], rune(line[i]))
-		}
-		lineNumber++
-	}
-	if lineNumber == 0 {
-		textBuffer = append(textBuffer, []rune{})
+func (e *Editor) idle() {
+	e.updateSwapFiles(true)
+	if e.mode == ModeEditor {
+		e.checkDisk()
 	}
 }
 
-func writeFile(filename string) {
-	file, err := os.Create(filename)
-	if err != nil {
-		return
-	}
-	defer file.Close()
-
-	writer := bufio.NewWriter(file)
-	for _, line := range textBuffer {
-		for _, ch := range line {
-			_, err = writer.WriteRune(ch)
-			if err != nil {
-				fmt.Println("Error writing to file:", err)
-				return
-			}
+// updateSwapFiles brings the swap files of the open buffers up to date. idle
+// is set once no input has arrived for idleTime.
+func (e *Editor) updateSwapFiles(idle bool) {
+	for _, b := range e.buffers {
+		if err := b.updateSwap(idle); err != nil {
+			e.setMessage("Error writing swap file for " + b.Path + ": " + err.Error())
 		}
-		writer.WriteRune('\n')
 	}
-	writer.Flush()
-	modified = false
 }
 
-func insertCharacters(keyEvent C.struct_tb_event) {
-	insertCharacter := make([]rune, len(textBuffer[currentRow])+1)
-	copy(insertCharacter[:currentColumn], textBuffer[currentRow][:currentColumn])
-	switch keyEvent.key {
-	case C.TB_KEY_SPACE:
-		insertCharacter[currentColumn] = rune(' ')
-	case C.TB_KEY_TAB:
-		insertCharacter[currentColumn] = rune('\t')
-	default:
-		insertCharacter[currentColumn] = rune(keyEvent.ch)
-	}
-	copy(insertCharacter[currentColumn+1:], textBuffer[currentRow][currentColumn:])
-	textBuffer[currentRow] = insertCharacter
-	currentColumn++
-	modified = true
+func (e *Editor) setMessage(msg string) {
+	e.message = msg
 }
 
-func deleteCharacter() {
-	if currentColumn == 0 && currentRow == 0 {
-		return
+func runeDisplayWidth(ch rune, tabSize int) int {
+	if ch == '\t' {
+		return tabSize
 	}
-	if currentColumn > 0 {
-		textBuffer[currentRow] = append(textBuffer[currentRow][:currentColumn-1], textBuffer[currentRow][currentColumn:]...)
-		currentColumn--
-	} else {
-		previousRowLength := len(textBuffer[currentRow-1])
-		textBuffer[currentRow-1] = append(textBuffer[currentRow-1], textBuffer[currentRow]...)
-		textBuffer = append(textBuffer[:currentRow], textBuffer[currentRow+1:]...)
-		currentRow--
-		currentColumn = previousRowLength
+	if isInvalidByteRune(ch) {
+		return 1
 	}
-	modified = true
+	return runewidth.RuneWidth(ch)
 }
 
-func insertNewLine() {
-	newLine := make([]rune, len(textBuffer[currentRow])-currentColumn)
-	copy(newLine, textBuffer[currentRow][currentColumn:])
-	textBuffer[currentRow] = textBuffer[currentRow][:currentColumn]
-	textBuffer = append(textBuffer[:currentRow+1], textBuffer[currentRow:]...)
-	textBuffer[currentRow+1] = newLine
-	currentRow++
-	currentColumn = 0
-	modified = true
+func (e *Editor) runeIndexToDisplayCol(row int, runeIndex int) int {
+	return e.Buffer().runeIndexToDisplayCol(row, runeIndex, editSettings.TabSize)
 }
 
-func copyLine() {
-	if currentRow < len(textBuffer) {
-		copyBuffer = make([]rune, len(textBuffer[currentRow]))
-		copy(copyBuffer, textBuffer[currentRow])
-	}
+func (e *Editor) displayColToRuneIndex(row int, displayCol int) int {
+	return e.Buffer().displayColToRuneIndex(row, displayCol, editSettings.TabSize)
 }
 
-func pasteLine() {
-	if len(copyBuffer) == 0 {
-		currentRow++
-		currentColumn = 0
+func (e *Editor) printCell(col int, row int, fg Attribute, bg Attribute, msg string) {
+	for _, character := range msg {
+		e.screen.SetCell(col, row, character, fg, bg)
+		col += runewidth.RuneWidth(character)
 	}
-	insertedLine := make([]rune, len(copyBuffer))
-	copy(insertedLine, copyBuffer)
-	textBuffer = append(textBuffer[:currentRow+1], textBuffer[currentRow:]...)
-	textBuffer[currentRow] = insertedLine
-	modified = true
 }
 
-func deleteLine() {
-	copyLine()
-	if currentRow < len(textBuffer) {
-		textBuffer = append(textBuffer[:currentRow], textBuffer[currentRow+1:]...)
-		if currentRow >= len(textBuffer) && currentRow > 0 {
-			currentRow--
-		}
-		currentColumn = 0
-		modified = true
+func (e *Editor) insertCharacters(keyEvent Event) {
+	switch keyEvent.Key {
+	case KeySpace:
+		e.Buffer().InsertRune(' ')
+	case KeyTab:
+		e.Buffer().InsertRune('\t')
+	default:
+		e.Buffer().InsertRune(keyEvent.Ch)
 	}
 }
 
-func pushBuffer() {
-	copyUndoBuffer := make([][]rune, len(textBuffer))
-	copy(copyUndoBuffer, textBuffer)
-	undoBuffer = copyUndoBuffer
+func (e *Editor) startInsert() {
+	e.editMode = EditInsert
+	e.Buffer().BeginUndoGroup()
 }
 
-func pullBuffer() {
-	if len(undoBuffer) == 0 {
-		return
+func (e *Editor) stopInsert() {
+	e.editMode = EditNormal
+	e.Buffer().EndUndoGroup()
+}
+
+// clearState removes the search highlight and forgets the register chosen
+// for the next command.
+func (e *Editor) clearState() {
+	e.highlightSearch = false
+	e.register = 0
+}
+
+func (e *Editor) openHelp() {
+	e.helpScroll = 0
+	e.mode = ModeHelp
+}
+
+// quit closes every buffer, discarding unsaved changes, and exits.
+func (e *Editor) quit() {
+	for _, buffer := range e.buffers {
+		buffer.Close()
 	}
+	e.screen.Close()
+	os.Exit(0)
+}
 
-	textBuffer = undoBuffer
-	undoBuffer = [][]rune{}
+func (e *Editor) toggleLineEnding() {
+	b := e.Buffer()
+	if b.Format.LineEnding == LineEndingCRLF {
+		b.SetLineEnding(LineEndingLF)
+	} else {
+		b.SetLineEnding(LineEndingCRLF)
+	}
+	e.setMessage("Line endings will be saved as " + b.Format.LineEnding.String())
 }
 
-func scrollText() {
-	if currentRow < offsetRow {
-		offsetRow = currentRow
-	} else if currentRow >= offsetRow+ROWS {
-		offsetRow = currentRow - ROWS + 1
+// scrollText scrolls the focused window to keep the cursor in view.
+func (e *Editor) scrollText() {
+	w := e.window
+	b := e.Buffer()
+	if b.Row < w.offsetRow {
+		w.offsetRow = b.Row
+	} else if b.Row >= w.offsetRow+w.height {
+		w.offsetRow = b.Row - w.height + 1
 	}
 
 	visCol := 0
-	if currentRow < len(textBuffer) {
-		visCol = runeIndexToDisplayCol(currentRow, currentColumn)
+	if b.Row < b.LineCount() {
+		visCol = e.runeIndexToDisplayCol(b.Row, b.Column)
 	}
-	if visCol < offsetColumn {
-		offsetColumn = visCol
-	} else if visCol >= offsetColumn+COLS {
-		offsetColumn = visCol - COLS + 1
+	if visCol < w.offsetColumn {
+		w.offsetColumn = visCol
+	} else if visCol >= w.offsetColumn+w.textWidth() {
+		w.offsetColumn = visCol - w.textWidth() + 1
 	}
 }
 
-func displayText() {
-	lang := getLanguageStatusText()
+// displayWindow draws the text of the buffer w shows. The selection and a
+// replacement being confirmed are only shown in the focused window, and
+// search matches in the windows showing its buffer.
+func (e *Editor) displayWindow(w *window) {
+	b := w.buffer
+	lang := detectLanguage(b.Path)
 	inMultiLineComment := false
+	offsetRow, offsetColumn := w.offsetRow, w.offsetColumn
+	rows, cols := w.height, w.textWidth()
+	printCell := func(col, row int, fg, bg Attribute, msg string) {
+		e.printCell(w.x+w.gutter+col, w.y+row, fg, bg, msg)
+	}
 
-	for scrRow := 0; scrRow < ROWS; scrRow++ {
+	for scrRow := 0; scrRow < rows; scrRow++ {
 		textRow := scrRow + offsetRow
-		if textRow >= len(textBuffer) {
+		if textRow >= b.LineCount() {
 			continue
 		}
 
-		startRune := displayColToRuneIndex(textRow, offsetColumn)
-		visCol := runeIndexToDisplayCol(textRow, startRune)
+		startRune := b.displayColToRuneIndex(textRow, offsetColumn, editSettings.TabSize)
+		visCol := b.runeIndexToDisplayCol(textRow, startRune, editSettings.TabSize)
 
-		line := textBuffer[textRow]
+		line := b.Line(textRow)
+		var matches []Match
+		var selected selectionSpan
+		var isSelected bool
+		if w == e.window {
+			line = e.replaceLine(textRow)
+			selected, isSelected = e.selectedSpan(textRow)
+		}
+		if b == e.Buffer() {
+			matches = e.rowMatches(textRow)
+		}
 		tokens, stillInComment := tokenizeLine(line, lang, inMultiLineComment)
 		inMultiLineComment = stillInComment
 
+		// colors returns the colors of the rune at index, highlighted if it
+		// is selected or part of a search match.
+		colors := func(index int, fg Attribute) (Attribute, Attribute) {
+			if isSelected && index >= selected.start && index < selected.end {
+				return CurrentTheme.SelectionFg, CurrentTheme.SelectionBg
+			}
+			for _, m := range matches {
+				if index >= m.Column && index < m.Column+m.Length {
+					return CurrentTheme.SelectionFg, CurrentTheme.SelectionBg
+				}
+			}
+			return fg, CurrentTheme.Background
+		}
+
 		for _, token := range tokens {
 			tokenColor := CurrentTheme.Foreground
 			switch token.Type {
@@ -293,69 +412,88 @@ func displayText() {
 
 			switch token.Type {
 			case TokenSpace:
-				if visCol-offsetColumn >= COLS {
+				if visCol-offsetColumn >= cols {
 					break
 				}
 				col := visCol - offsetColumn
-				if col >= 0 && col < COLS {
-					printCell(col, scrRow, CurrentTheme.WhitespaceColor, CurrentTheme.Background, " ")
+				if col >= 0 && col < cols {
+					fg, bg := colors(token.Start, CurrentTheme.WhitespaceColor)
+					printCell(col, scrRow, fg, bg, " ")
 				}
 				visCol++
 			case TokenTab:
-				if visCol-offsetColumn >= COLS {
+				if visCol-offsetColumn >= cols {
 					break
 				}
+				fg, bg := colors(token.Start, CurrentTheme.WhitespaceColor)
 				col := visCol - offsetColumn
-				if col >= 0 && col < COLS {
-					printCell(col, scrRow, CurrentTheme.WhitespaceColor, CurrentTheme.Background, "→")
+				if col >= 0 && col < cols {
+					printCell(col, scrRow, fg, bg, "→")
 				}
 				visCol++
 				remaining := editSettings.TabSize - 1
-				for j := 0; j < remaining && visCol-offsetColumn < COLS; j++ {
+				for j := 0; j < remaining && visCol-offsetColumn < cols; j++ {
 					c := visCol - offsetColumn
-					if c >= 0 && c < COLS {
-						printCell(c, scrRow, CurrentTheme.WhitespaceColor, CurrentTheme.Background, "·")
+					if c >= 0 && c < cols {
+						printCell(c, scrRow, fg, bg, "·")
 					}
 					visCol++
 				}
 			default:
 				for j := startInToken; j < len(token.Value); j++ {
-					if visCol-offsetColumn >= COLS {
+					if visCol-offsetColumn >= cols {
 						break
 					}
 					col := visCol - offsetColumn
-					if col >= 0 && col < COLS {
-						r := token.Value[j]
-						printCell(col, scrRow, tokenColor, CurrentTheme.Background, string(r))
+					r := token.Value[j]
+					if col >= 0 && col < cols {
+						fg, bg := colors(token.Start+j, tokenColor)
+						if isInvalidByteRune(r) {
+							printCell(col, scrRow, fg|AttrReverse, bg, string(utf8.RuneError))
+						} else {
+							printCell(col, scrRow, fg, bg, string(r))
+						}
 					}
-					visCol += runewidth.RuneWidth(token.Value[j])
+					visCol += runeDisplayWidth(r, editSettings.TabSize)
 				}
 			}
 		}
+
+		// A selected line break shows as a highlighted cell after the text.
+		if isSelected && selected.end > len(line) {
+			if col := visCol - offsetColumn; col >= 0 && col < cols {
+				printCell(col, scrRow, CurrentTheme.SelectionFg, CurrentTheme.SelectionBg, " ")
+			}
+		}
 	}
 }
 
 type statusComponent struct {
 	text      string
-	fg        C.uintattr_t
-	bg        C.uintattr_t
+	fg        Attribute
+	bg        Attribute
 	separator bool
 }
 
-func displayStatusBar() {
+func (e *Editor) displayStatusBar() {
 	const separatorWidth = 2
 
-	copyUndoText, hasCopyUndo := getCopyUndoText()
+	copyUndoText, hasCopyUndo := e.getCopyUndoText()
 
 	leftComponents := []statusComponent{
-		{text: getModeStatusText(), fg: CurrentTheme.StatusModeFg, bg: CurrentTheme.StatusModeBg, separator: true},
-		{text: getFileStatusText(), fg: CurrentTheme.StatusBarFg, bg: CurrentTheme.StatusBarBg, separator: true},
+		{text: e.getModeStatusText(), fg: CurrentTheme.StatusModeFg, bg: CurrentTheme.StatusModeBg, separator: true},
+		{text: e.getFileStatusText(), fg: CurrentTheme.StatusBarFg, bg: CurrentTheme.StatusBarBg, separator: true},
 		{text: copyUndoText, fg: CurrentTheme.StatusBarFg, bg: CurrentTheme.StatusBarBg, separator: hasCopyUndo},
 	}
+	if e.message != "" {
+		leftComponents = append(leftComponents, statusComponent{text: e.message, fg: CurrentTheme.StatusBarFg, bg: CurrentTheme.StatusBarBg, separator: false})
+	}
 
 	rightComponents := []statusComponent{
-		{text: getCursorStatusText(), fg: CurrentTheme.StatusInfoFg, bg: CurrentTheme.StatusInfoBg, separator: true},
-		{text: getLanguageStatusText(), fg: CurrentTheme.StatusInfoFg, bg: CurrentTheme.StatusInfoBg, separator: true},
+		{text: e.getCursorStatusText(), fg: CurrentTheme.StatusInfoFg, bg: CurrentTheme.StatusInfoBg, separator: true},
+		{text: e.getLanguageStatusText(), fg: CurrentTheme.StatusInfoFg, bg: CurrentTheme.StatusInfoBg, separator: true},
+		{text: e.Buffer().Format.Encoding.String(), fg: CurrentTheme.StatusInfoFg, bg: CurrentTheme.StatusInfoBg, separator: true},
+		{text: e.Buffer().Format.String(), fg: CurrentTheme.StatusInfoFg, bg: CurrentTheme.StatusInfoBg, separator: true},
 		{text: getTabSizeText(), fg: CurrentTheme.StatusInfoFg, bg: CurrentTheme.StatusInfoBg, separator: false},
 	}
 
@@ -377,45 +515,56 @@ func displayStatusBar() {
 
 	currentCol := 0
 	for _, component := range leftComponents {
-		printCell(currentCol, ROWS, component.fg, component.bg, component.text)
+		e.printCell(currentCol, e.rows, component.fg, component.bg, component.text)
 		currentCol += len(component.text)
 		if component.separator {
-			printCell(currentCol, ROWS, C.TB_WHITE, C.TB_BLACK, "  ")
+			e.printCell(currentCol, e.rows, ColorWhite, ColorBlack, "  ")
 			currentCol += separatorWidth
 		}
 	}
 
-	middleSpace := COLS - leftWidth - rightWidth
+	middleSpace := e.cols - leftWidth - rightWidth
 	if middleSpace > 0 {
 		spaces := strings.Repeat(" ", middleSpace)
-		printCell(currentCol, ROWS, C.TB_WHITE, C.TB_BLACK, spaces)
+		e.printCell(currentCol, e.rows, ColorWhite, ColorBlack, spaces)
 		currentCol += middleSpace
 	}
 
 	for _, component := range rightComponents {
-		printCell(currentCol, ROWS, component.fg, component.bg, component.text)
+		e.printCell(currentCol, e.rows, component.fg, component.bg, component.text)
 		currentCol += len(component.text)
 		if component.separator {
-			printCell(currentCol, ROWS, C.TB_WHITE, C.TB_BLACK, "  ")
+			e.printCell(currentCol, e.rows, ColorWhite, ColorBlack, "  ")
 			currentCol += separatorWidth
 		}
 	}
 }
 
-func getModeStatusText() string {
-	if mode > 0 {
+func (e *Editor) getModeStatusText() string {
+	switch e.editMode {
+	case EditInsert:
 		return "-- INSERT --"
-	}
-	return "-- VISUAL --"
+	case EditVisual:
+		return "-- VISUAL --"
+	case EditVisualLine:
+		return "-- VISUAL LINE --"
+	case EditVisualBlock:
+		return "-- VISUAL BLOCK --"
+	}
+	return "-- NORMAL --"
 }
 
-func getFileStatusText() string {
-	filenameLength := len(sourceFile)
+func (e *Editor) getFileStatusText() string {
+	b := e.Buffer()
+	filenameLength := len(b.Path)
 	if filenameLength > 8 {
 		filenameLength = 8
 	}
-	status := sourceFile[:filenameLength] + " - " + strconv.Itoa(len(textBuffer)) + " lines"
-	if modified {
+	status := b.Path[:filenameLength] + " - " + strconv.Itoa(b.LineCount()) + " lines"
+	if len(e.buffers) > 1 {
+		status = fmt.Sprintf("[%d/%d] ", e.bufferIndex()+1, len(e.buffers)) + status
+	}
+	if b.Modified {
 		status += " (modified)"
 	} else {
 		status += " (saved)"
@@ -423,7 +572,11 @@ func getFileStatusText() string {
 	return status
 }
 
-func getLanguageStatusText() string {
+func (e *Editor) getLanguageStatusText() string {
+	return detectLanguage(e.Buffer().Path)
+}
+
+func detectLanguage(sourceFile string) string {
 	if sourceFile == "" || sourceFile == "untitled" {
 		return "Plain"
 	}
@@ -504,193 +657,126 @@ func getLanguageStatusText() string {
 	return "Plain"
 }
 
-func getCopyUndoText() (string, bool) {
+func (e *Editor) getCopyUndoText() (string, bool) {
 	var status strings.Builder
 	hasContent := false
-	if len(copyBuffer) > 0 {
+	if _, ok := e.registers.get(unnamedRegister); ok {
 		status.WriteString(" [Copy]")
 		hasContent = true
 	}
-	if len(undoBuffer) > 0 {
-		status.WriteString(" [Undo]")
+	if e.register != 0 {
+		status.WriteString(fmt.Sprintf(" [\"%c]", e.register))
+		hasContent = true
+	}
+	if e.recordingMacro != 0 {
+		status.WriteString(fmt.Sprintf(" [Recording @%c]", e.recordingMacro))
+		hasContent = true
+	}
+	if pending := e.pendingCommand(); pending != "" {
+		status.WriteString(" [" + pending + "]")
+		hasContent = true
+	}
+	if depth := e.Buffer().UndoDepth(); depth > 0 {
+		status.WriteString(fmt.Sprintf(" [Undo %d]", depth))
 		hasContent = true
 	}
 	return status.String(), hasContent
 }
 
-func getCursorStatusText() string {
+func (e *Editor) getCursorStatusText() string {
+	b := e.Buffer()
 	visCol := 0
-	if currentRow < len(textBuffer) {
-		visCol = runeIndexToDisplayCol(currentRow, currentColumn)
+	if b.Row < b.LineCount() {
+		visCol = e.runeIndexToDisplayCol(b.Row, b.Column)
 	}
-	return fmt.Sprintf("Ln %d, Col %d", currentRow+1, visCol+1)
+	return fmt.Sprintf("Ln %d, Col %d", b.Row+1, visCol+1)
 }
 
 func getTabSizeText() string {
 	return fmt.Sprintf("Tab Size: %d", editSettings.TabSize)
 }
 
-func processKeypress(keyEvent C.struct_tb_event) {
-	if keyEvent.key == C.TB_KEY_ESC {
-		if mode > 0 {
-			mode = 0
-			return
+// processKeypress runs the action the keys typed so far are bound to in
+// the keymap of the text area's mode. In normal and visual mode, digits
+// typed first are a count for it. In insert mode, keys bound to nothing
+// type their character.
+func (e *Editor) processKeypress(keyEvent Event) {
+	if e.choosingRegister {
+		e.choosingRegister = false
+		if validRegister(keyEvent.Ch) {
+			e.register = keyEvent.Ch
 		}
-	} else if keyEvent.ch != 0 {
-		if mode > 0 {
-			insertCharacters(keyEvent)
-		} else {
-			switch keyEvent.ch {
-			case 'q':
-				C.tb_shutdown()
-				os.Exit(0)
-			case 'i':
-				mode = 1
-			case 'w':
-				writeFile(sourceFile)
-			case 'h':
-				currentMode = ModeHelp
-			case 'c':
-				copyLine()
-			case 'p':
-				pasteLine()
-			case 'd':
-				deleteLine()
-			case 's':
-				pushBuffer()
-			case 'l':
-				pullBuffer()
-			case 'o':
-				if fileBrowser == nil {
-					fileBrowser = NewFileBrowser()
-				} else {
-					fileBrowser.RefreshEntries()
-				}
-				currentMode = ModeFileBrowser
-			case 't':
-				themeSelector.Entries = nil
-				for key, theme := range Themes {
-					if theme.Name != CurrentTheme.Name {
-						themeSelector.Entries = append(themeSelector.Entries, themeEntry{
-							Key:  key,
-							Name: theme.Name,
-						})
-					}
-				}
-				previousThemeKey = ""
-				if editSettings != nil && editSettings.Theme != "" {
-					previousThemeKey = editSettings.Theme
-				} else {
-					previousThemeKey = GetCurrentThemeKey()
-				}
+		return
+	}
+	if e.choosingMacro != "" {
+		e.chooseMacro(keyEvent.Ch)
+		return
+	}
+	mode := e.keymapMode()
+	if mode != "insert" {
+		e.typedKeys = append(e.typedKeys, keyName(keyEvent))
+	}
 
-				themeSelector.Cursor = 0
-				for i, e := range themeSelector.Entries {
-					if e.Key == previousThemeKey {
-						themeSelector.Cursor = i
-						break
+	switch {
+	case e.findingChar:
+		e.findCharacter(keyEvent)
+	case mode != "insert" && e.countKeypress(keyEvent):
+	default:
+		act, pending, typed := e.keyAction(mode, keyEvent)
+		switch {
+		case pending:
+		case act == nil:
+			e.cancelCommand()
+			if mode == "insert" {
+				for _, event := range typed {
+					if event.Ch != 0 || event.Key == KeySpace || event.Key == KeyTab {
+						e.insertCharacters(event)
 					}
 				}
-
-				if len(themeSelector.Entries) > 0 {
-					SetTheme(themeSelector.Entries[themeSelector.Cursor].Key)
-				}
-
-				currentMode = ModeThemeSelector
-			}
-		}
-	} else {
-		switch keyEvent.key {
-		case C.TB_KEY_ENTER:
-			if mode > 0 {
-				insertNewLine()
-			}
-		case C.TB_KEY_BACKSPACE, C.TB_KEY_BACKSPACE2:
-			if mode > 0 {
-				deleteCharacter()
-			}
-		case C.TB_KEY_TAB:
-			if mode > 0 {
-				insertCharacters(keyEvent)
-			}
-		case C.TB_KEY_SPACE:
-			if mode > 0 {
-				insertCharacters(keyEvent)
 			}
-		case C.TB_KEY_HOME:
-			currentColumn = 0
-		case C.TB_KEY_END:
-			if currentRow < len(textBuffer) {
-				currentColumn = len(textBuffer[currentRow])
-			} else {
-				currentColumn = 0
-			}
-		case C.TB_KEY_PGUP:
-			if currentRow-int(ROWS/4) > 0 {
-				currentRow -= int(ROWS / 4)
-			}
-		case C.TB_KEY_PGDN:
-			if currentRow+int(ROWS/4) < len(textBuffer)-1 {
-				currentRow += int(ROWS / 4)
-			}
-		case C.TB_KEY_ARROW_UP:
-			if currentRow > 0 {
-				currentRow--
-			}
-		case C.TB_KEY_ARROW_DOWN:
-			if currentRow < len(textBuffer)-1 {
-				currentRow++
-			}
-		case C.TB_KEY_ARROW_LEFT:
-			if currentColumn > 0 {
-				currentColumn--
-			} else if currentRow > 0 {
-				currentRow--
-				currentColumn = len(textBuffer[currentRow])
-			}
-		case C.TB_KEY_ARROW_RIGHT:
-			if currentRow < len(textBuffer) && currentColumn < len(textBuffer[currentRow]) {
-				currentColumn++
-			} else if currentRow < len(textBuffer)-1 {
-				currentRow++
-				currentColumn = 0
+		case e.operator != "" && !act.motion && !act.operator:
+			e.cancelCommand()
+		default:
+			act.run(e)
+			if !act.motion && !act.operator {
+				e.count = 0
 			}
 		}
-		if currentRow < len(textBuffer) && currentColumn > len(textBuffer[currentRow]) {
-			currentColumn = len(textBuffer[currentRow])
-		}
+	}
+
+	if e.count == 0 && e.operator == "" && !e.findingChar && len(e.pendingKeys) == 0 {
+		e.typedKeys = nil
 	}
 }
 
-func drawPopupFrame(x, y, w, h int, title string) {
+func (e *Editor) drawPopupFrame(x, y, w, h int, title string) {
 	for i := 0; i < w; i++ {
-		C.tb_set_cell(C.int(x+i), C.int(y), '─', CurrentTheme.PopupFg, CurrentTheme.PopupBg)
-		C.tb_set_cell(C.int(x+i), C.int(y+h-1), '─', CurrentTheme.PopupFg, CurrentTheme.PopupBg)
+		e.screen.SetCell(x+i, y, '─', CurrentTheme.PopupFg, CurrentTheme.PopupBg)
+		e.screen.SetCell(x+i, y+h-1, '─', CurrentTheme.PopupFg, CurrentTheme.PopupBg)
 	}
 	for j := 0; j < h; j++ {
-		C.tb_set_cell(C.int(x), C.int(y+j), '│', CurrentTheme.PopupFg, CurrentTheme.PopupBg)
-		C.tb_set_cell(C.int(x+w-1), C.int(y+j), '│', CurrentTheme.PopupFg, CurrentTheme.PopupBg)
+		e.screen.SetCell(x, y+j, '│', CurrentTheme.PopupFg, CurrentTheme.PopupBg)
+		e.screen.SetCell(x+w-1, y+j, '│', CurrentTheme.PopupFg, CurrentTheme.PopupBg)
 	}
 
-	C.tb_set_cell(C.int(x), C.int(y), '┌', CurrentTheme.PopupFg, CurrentTheme.PopupBg)
-	C.tb_set_cell(C.int(x+w-1), C.int(y), '┐', CurrentTheme.PopupFg, CurrentTheme.PopupBg)
-	C.tb_set_cell(C.int(x), C.int(y+h-1), '└', CurrentTheme.PopupFg, CurrentTheme.PopupBg)
-	C.tb_set_cell(C.int(x+w-1), C.int(y+h-1), '┘', CurrentTheme.PopupFg, CurrentTheme.PopupBg)
+	e.screen.SetCell(x, y, '┌', CurrentTheme.PopupFg, CurrentTheme.PopupBg)
+	e.screen.SetCell(x+w-1, y, '┐', CurrentTheme.PopupFg, CurrentTheme.PopupBg)
+	e.screen.SetCell(x, y+h-1, '└', CurrentTheme.PopupFg, CurrentTheme.PopupBg)
+	e.screen.SetCell(x+w-1, y+h-1, '┘', CurrentTheme.PopupFg, CurrentTheme.PopupBg)
 
-	printCell(x+2, y, CurrentTheme.PopupTitleFg, CurrentTheme.PopupTitleBg, title)
+	e.printCell(x+2, y, CurrentTheme.PopupTitleFg, CurrentTheme.PopupTitleBg, title)
 
 	for i := 1; i < w-1; i++ {
 		for j := 1; j < h-1; j++ {
-			C.tb_set_cell(C.int(x+i), C.int(y+j), ' ', CurrentTheme.PopupFg, CurrentTheme.PopupBg)
+			e.screen.SetCell(x+i, y+j, ' ', CurrentTheme.PopupFg, CurrentTheme.PopupBg)
 		}
 	}
 }
 
-func showHelp() {
-	w := int(C.tb_width())
-	h := int(C.tb_height())
+func (e *Editor) showHelp() {
+	w, h := e.screen.Size()
 
-	helpText := FormatKeyBindingsHelp()
+	helpText := FormatKeyBindingsHelp(e.KeyBindings())
 
 	maxWidth := 0
 	for _, line := range helpText {
@@ -700,103 +786,210 @@ func showHelp() {
 	}
 
 	pw := maxWidth + 4
-	ph := len(helpText) + 4
+	ph := min(len(helpText)+4, h)
+	visible := max(ph-4, 1)
+	e.helpScroll = max(min(e.helpScroll, len(helpText)-visible), 0)
 
 	x := (w - pw) / 2
 	y := (h - ph) / 2
 
-	drawPopupFrame(x, y, pw, ph, "Help")
+	e.drawPopupFrame(x, y, pw, ph, "Help")
 
-	for i, line := range helpText {
-		printCell(x+2, y+1+i, C.TB_WHITE, C.TB_BLACK, line)
+	for i, line := range helpText[e.helpScroll:min(e.helpScroll+visible, len(helpText))] {
+		e.printCell(x+2, y+1+i, ColorWhite, ColorBlack, line)
 	}
 
 	footerText := "[Enter/Esc] Close"
-	footerX := x + (pw-len(footerText))/2
-	printCell(footerX, y+ph-2, C.TB_BLUE, C.TB_BLACK, footerText)
-
-	C.tb_present()
+	if visible < len(helpText) {
+		footerText = "[↑/↓/PgUp/PgDn] Scroll  " + footerText
+	}
+	footerX := x + (pw-runewidth.StringWidth(footerText))/2
+	e.printCell(footerX, y+ph-2, ColorBlue, ColorBlack, footerText)
 }
 
-func processPopover(event C.struct_tb_event) {
-	if event.key == C.TB_KEY_ENTER || event.key == C.TB_KEY_ESC {
-		currentMode = ModeEditor
-		return
+func (e *Editor) processPopover(event Event) {
+	switch event.Key {
+	case KeyEnter, KeyEsc:
+		e.mode = ModeEditor
+	case KeyArrowUp:
+		e.helpScroll--
+	case KeyArrowDown:
+		e.helpScroll++
+	case KeyPgUp:
+		e.helpScroll -= e.rows / 2
+	case KeyPgDn:
+		e.helpScroll += e.rows / 2
 	}
 }
 
 func RunEditor() {
-	event := C.struct_tb_event{}
-
-	err := C.tb_init()
-	if err != 0 {
+	screen, err := newTermboxScreen()
+	if err != nil {
 		fmt.Println(err)
 		os.Exit(1)
 	}
 
 	ApplySettingsTheme()
 
-	if len(os.Args) > 1 {
-		sourceFile = os.Args[1]
-		readFile(sourceFile)
-	} else {
-		sourceFile = "untitled"
-		textBuffer = append(textBuffer, []rune{})
+	e := NewEditor(screen)
+	for _, path := range os.Args[1:] {
+		e.openBuffer(path)
 	}
+	e.switchBuffer(0)
 
-	currentRow = 0
-
-	fileBrowser = NewFileBrowser()
+	e.fileBrowser = NewFileBrowser()
 
 	for {
-		COLS = int(C.tb_width())
-		ROWS = int(C.tb_height())
-		ROWS--
-		if COLS < 78 {
-			COLS = 78
-		}
-		C.tb_clear()
-
-		switch currentMode {
-		case ModeEditor:
-			scrollText()
-			displayText()
-			displayStatusBar()
-			visCol := 0
-			if currentRow < len(textBuffer) {
-				visCol = runeIndexToDisplayCol(currentRow, currentColumn)
-			}
-			C.tb_set_cursor(C.int(visCol-offsetColumn), C.int(currentRow-offsetRow))
-		case ModeHelp:
-			displayText()
-			displayStatusBar()
-			showHelp()
-			C.tb_set_cursor(-1, -1)
-		case ModeFileBrowser:
-			displayText()
-			displayStatusBar()
-			showFileBrowser()
-			C.tb_set_cursor(-1, -1)
-		case ModeThemeSelector:
-			displayText()
-			displayStatusBar()
-			showThemeSelector()
-			C.tb_set_cursor(-1, -1)
+		e.Draw()
+		if event, ok := screen.PeekEvent(idleTime); ok {
+			e.HandleEvent(event)
+		} else {
+			e.idle()
 		}
+	}
+}
 
-		C.tb_present()
-		C.tb_poll_event(&event)
-		if event._type == C.TB_EVENT_KEY {
-			switch currentMode {
-			case ModeEditor:
-				processKeypress(event)
-			case ModeHelp:
-				processPopover(event)
-			case ModeFileBrowser:
-				processFileBrowserEvent(event)
-			case ModeThemeSelector:
-				processThemeSelectorEvent(event)
-			}
+// Draw renders the current state of the editor to its screen.
+func (e *Editor) Draw() {
+	width, height := e.screen.Size()
+	e.cols = width
+	e.rows = height - 1
+	if e.cols < 78 {
+		e.cols = 78
+	}
+	e.layoutWindows()
+	e.screen.Clear()
+
+	switch e.mode {
+	case ModeEditor:
+		b := e.Buffer()
+		e.scrollText()
+		e.displayText()
+		e.displayStatusBar()
+		visCol := 0
+		if b.Row < b.LineCount() {
+			visCol = e.runeIndexToDisplayCol(b.Row, b.Column)
 		}
+		w := e.window
+		e.screen.SetCursor(w.x+w.gutter+visCol-w.offsetColumn, w.y+b.Row-w.offsetRow)
+	case ModeHelp:
+		e.displayText()
+		e.displayStatusBar()
+		e.showHelp()
+		e.screen.SetCursor(-1, -1)
+	case ModeFileBrowser:
+		e.displayText()
+		e.displayStatusBar()
+		e.showFileBrowser()
+		e.screen.SetCursor(-1, -1)
+	case ModeThemeSelector:
+		e.displayText()
+		e.displayStatusBar()
+		e.showThemeSelector()
+		e.screen.SetCursor(-1, -1)
+	case ModeUndoTree:
+		e.scrollText()
+		e.displayText()
+		e.displayStatusBar()
+		e.showUndoTree()
+		e.screen.SetCursor(-1, -1)
+	case ModeRecovery:
+		e.displayText()
+		e.displayStatusBar()
+		e.showRecovery()
+		e.screen.SetCursor(-1, -1)
+	case ModeDiskChange:
+		e.displayText()
+		e.displayStatusBar()
+		e.showDiskChange()
+		e.screen.SetCursor(-1, -1)
+	case ModeEncoding:
+		e.displayText()
+		e.displayStatusBar()
+		e.showEncodingSelector()
+		e.screen.SetCursor(-1, -1)
+	case ModeUnsaved:
+		e.displayText()
+		e.displayStatusBar()
+		e.showUnsaved()
+		e.screen.SetCursor(-1, -1)
+	case ModeRegisters:
+		e.displayText()
+		e.displayStatusBar()
+		e.showRegisters()
+		e.screen.SetCursor(-1, -1)
+	case ModeBuffers:
+		e.displayText()
+		e.displayStatusBar()
+		e.showBuffers()
+		e.screen.SetCursor(-1, -1)
+	case ModeCommandLine:
+		e.scrollText()
+		e.displayText()
+		e.displayCommandLine()
+		e.screen.SetCursor(e.commandLineCursor(), e.rows)
+	case ModeSearch:
+		e.scrollText()
+		e.displayText()
+		e.displaySearch()
+		e.screen.SetCursor(e.searchCursor(), e.rows)
+	case ModeReplace:
+		e.scrollText()
+		e.displayText()
+		e.displayReplace()
+		e.screen.SetCursor(-1, -1)
+	}
+
+	e.screen.Present()
+}
+
+// HandleEvent dispatches an input event to the handler for the current mode.
+func (e *Editor) HandleEvent(event Event) {
+	if event.Type == EventPaste {
+		e.message = ""
+		e.recordEvent(event)
+		e.insertPaste(event.Text)
+		e.updateSwapFiles(false)
+		return
+	}
+	if event.Type == EventMouse {
+		e.processMouseEvent(event)
+		return
+	}
+	if event.Type != EventKey {
+		return
 	}
+	e.message = ""
+	e.recordEvent(event)
+	switch e.mode {
+	case ModeEditor:
+		e.processKeypress(event)
+	case ModeHelp:
+		e.processPopover(event)
+	case ModeFileBrowser:
+		e.processFileBrowserEvent(event)
+	case ModeThemeSelector:
+		e.processThemeSelectorEvent(event)
+	case ModeUndoTree:
+		e.processUndoTreeEvent(event)
+	case ModeRecovery:
+		e.processRecoveryEvent(event)
+	case ModeDiskChange:
+		e.processDiskChangeEvent(event)
+	case ModeEncoding:
+		e.processEncodingSelectorEvent(event)
+	case ModeUnsaved:
+		e.processUnsavedEvent(event)
+	case ModeCommandLine:
+		e.processCommandLineEvent(event)
+	case ModeSearch:
+		e.processSearchEvent(event)
+	case ModeReplace:
+		e.processReplaceEvent(event)
+	case ModeRegisters:
+		e.processRegistersEvent(event)
+	case ModeBuffers:
+		e.processBuffersEvent(event)
+	}
+	e.updateSwapFiles(false)
 }
@@ -0,0 +1,57 @@
+package editor
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+// useSettings replaces the settings and theme for the rest of the test.
+func useSettings(t *testing.T, settings Settings) {
+	t.Helper()
+	saved, theme := *editSettings, CurrentTheme
+	*editSettings = settings
+	SetTheme(settings.Theme)
+	t.Cleanup(func() {
+		*editSettings = saved
+		CurrentTheme = theme
+	})
+}
+
+func TestRenderGolden(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Chdir(t.TempDir())
+	useSettings(t, Settings{TabSize: 4, Theme: "one-dark", LineNumbers: "absolute"})
+	source := "package main\n\nfunc main() {\n\tprintln(\"hi\") // greet\n}\n"
+	if err := os.WriteFile("main.go", []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+	screen := NewMemoryScreen(80, 8)
+	e := NewEditor(screen)
+	e.Open("main.go")
+	e.Buffer().Row, e.Buffer().Column = 3, 1
+	e.Draw()
+
+	want := strings.Join([]string{
+		"  1 package main",
+		"  2",
+		"  3 func main() {",
+		"  4 →···println(\"hi\") // greet",
+		"  5 }",
+		"",
+		"",
+		"-- NORMAL --  main.go - 5 lines (saved)  Ln 4, Col 5  Go  UTF-8  LF  Tab Size: 4",
+	}, "\n")
+	if got := screen.String(); got != want {
+		t.Errorf("screen:\n%s\nwant:\n%s", got, want)
+	}
+	if screen.CursorX != 8 || screen.CursorY != 3 {
+		t.Errorf("cursor at %d,%d, want 8,3", screen.CursorX, screen.CursorY)
+	}
+	if cell := screen.CellAt(4, 2); cell.Ch != 'f' || cell.Fg != CurrentTheme.KeywordColor {
+		t.Errorf("func is drawn as %q in %v, want keyword color %v", cell.Ch, cell.Fg, CurrentTheme.KeywordColor)
+	}
+	if cell := screen.CellAt(0, 0); cell.Fg != CurrentTheme.LineNumber {
+		t.Errorf("line number color = %v, want %v", cell.Fg, CurrentTheme.LineNumber)
+	}
+}
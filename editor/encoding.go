@@ -0,0 +1,215 @@
+package editor
+
+import (
+	"bytes"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Bytes that are not part of a valid UTF-8 sequence are kept in the buffer
+// as runes in the low surrogate range U+DC80..U+DCFF, one rune per byte.
+// Surrogates never appear in decoded UTF-8, so encodeLine can turn them back
+// into the original bytes and files round-trip unchanged.
+const invalidByteBase = 0xDC00
+
+func isInvalidByteRune(r rune) bool {
+	return r >= invalidByteBase+0x80 && r <= invalidByteBase+0xFF
+}
+
+// decodeLine converts UTF-8 bytes to runes, escaping invalid bytes. It
+// returns the number of invalid bytes found.
+func decodeLine(data []byte) ([]rune, int) {
+	line := make([]rune, 0, len(data))
+	invalid := 0
+	for len(data) > 0 {
+		r, size := utf8.DecodeRune(data)
+		if r == utf8.RuneError && size == 1 {
+			r = invalidByteBase + rune(data[0])
+			invalid++
+		}
+		line = append(line, r)
+		data = data[size:]
+	}
+	return line, invalid
+}
+
+// encodeLine appends the UTF-8 form of line to dst, restoring any bytes
+// that decodeLine escaped.
+func encodeLine(dst []byte, line []rune) []byte {
+	for _, r := range line {
+		if isInvalidByteRune(r) {
+			dst = append(dst, byte(r-invalidByteBase))
+			continue
+		}
+		dst = utf8.AppendRune(dst, r)
+	}
+	return dst
+}
+
+// Encoding is the character encoding of a file. Files in other encodings
+// than UTF-8 are converted to UTF-8 as a whole when read, so they are
+// always held in memory, and converted back when saved.
+type Encoding int
+
+const (
+	EncodingUTF8 Encoding = iota
+	EncodingLatin1
+	EncodingUTF16LE
+	EncodingUTF16BE
+)
+
+// detectEncoding asks readFile to pick the encoding of a file itself.
+const detectEncoding Encoding = -1
+
+// Encodings lists the supported encodings in the order they are offered.
+var Encodings = []Encoding{EncodingUTF8, EncodingLatin1, EncodingUTF16LE, EncodingUTF16BE}
+
+func (enc Encoding) String() string {
+	switch enc {
+	case EncodingLatin1:
+		return "Latin-1"
+	case EncodingUTF16LE:
+		return "UTF-16LE"
+	case EncodingUTF16BE:
+		return "UTF-16BE"
+	}
+	return "UTF-8"
+}
+
+// bom returns the byte order mark of the encoding, or nil if it has none.
+func (enc Encoding) bom() []byte {
+	switch enc {
+	case EncodingUTF8:
+		return utf8BOM
+	case EncodingUTF16LE:
+		return []byte{0xFF, 0xFE}
+	case EncodingUTF16BE:
+		return []byte{0xFE, 0xFF}
+	}
+	return nil
+}
+
+// sniffBytes is how much of a file sniffEncoding looks at.
+const sniffBytes = 4096
+
+// sniffEncoding guesses the encoding of a file from its first bytes: a byte
+// order mark, or for UTF-16 without one, the zero high bytes of ASCII
+// characters. Anything else is taken to be UTF-8 for now.
+func sniffEncoding(prefix []byte) Encoding {
+	for _, enc := range []Encoding{EncodingUTF8, EncodingUTF16LE, EncodingUTF16BE} {
+		if bytes.HasPrefix(prefix, enc.bom()) {
+			return enc
+		}
+	}
+	pairs := len(prefix) / 2
+	if pairs < 2 {
+		return EncodingUTF8
+	}
+	evenZeros, oddZeros := 0, 0
+	for i := 0; i+1 < len(prefix); i += 2 {
+		if prefix[i] == 0 {
+			evenZeros++
+		}
+		if prefix[i+1] == 0 {
+			oddZeros++
+		}
+	}
+	switch {
+	case 2*oddZeros > pairs && 10*evenZeros < pairs:
+		return EncodingUTF16LE
+	case 2*evenZeros > pairs && 10*oddZeros < pairs:
+		return EncodingUTF16BE
+	}
+	return EncodingUTF8
+}
+
+// looksLatin1 reports whether data, which is not valid UTF-8, is likely to
+// be Latin-1 text rather than binary data or UTF-8 with a few invalid
+// bytes: it has no NUL bytes, and most of its bytes above 0x7f are not part
+// of a valid UTF-8 sequence.
+func looksLatin1(data []byte) bool {
+	if utf8.Valid(data) || bytes.IndexByte(data, 0) >= 0 {
+		return false
+	}
+	valid, invalid := 0, 0
+	for i := 0; i < len(data); {
+		if data[i] < utf8.RuneSelf {
+			i++
+			continue
+		}
+		r, size := utf8.DecodeRune(data[i:])
+		if r == utf8.RuneError && size == 1 {
+			invalid++
+		} else {
+			valid += size
+		}
+		i += size
+	}
+	return invalid > valid
+}
+
+// decode converts data in the encoding to UTF-8. Unpaired UTF-16
+// surrogates and a trailing odd byte become U+FFFD.
+func (enc Encoding) decode(data []byte) []byte {
+	switch enc {
+	case EncodingLatin1:
+		decoded := make([]byte, 0, len(data)+len(data)/8)
+		for _, c := range data {
+			decoded = utf8.AppendRune(decoded, rune(c))
+		}
+		return decoded
+	case EncodingUTF16LE, EncodingUTF16BE:
+		units := make([]uint16, len(data)/2)
+		for i := range units {
+			if enc == EncodingUTF16LE {
+				units[i] = uint16(data[2*i]) | uint16(data[2*i+1])<<8
+			} else {
+				units[i] = uint16(data[2*i])<<8 | uint16(data[2*i+1])
+			}
+		}
+		decoded := make([]byte, 0, len(data))
+		for _, r := range utf16.Decode(units) {
+			decoded = utf8.AppendRune(decoded, r)
+		}
+		if len(data)%2 != 0 {
+			decoded = utf8.AppendRune(decoded, utf8.RuneError)
+		}
+		return decoded
+	}
+	return data
+}
+
+// encode appends text, held as in the buffer, to dst in the encoding. It
+// returns false if text has characters the encoding cannot represent.
+// Bytes escaped by decodeLine are written back as they were for Latin-1
+// and as U+FFFD for UTF-16.
+func (enc Encoding) encode(dst, text []byte) ([]byte, bool) {
+	if enc == EncodingUTF8 {
+		return append(dst, text...), true
+	}
+	line, _ := decodeLine(text)
+	for _, r := range line {
+		switch enc {
+		case EncodingLatin1:
+			if isInvalidByteRune(r) {
+				r -= invalidByteBase
+			}
+			if r > 0xFF {
+				return dst, false
+			}
+			dst = append(dst, byte(r))
+		case EncodingUTF16LE, EncodingUTF16BE:
+			if isInvalidByteRune(r) {
+				r = utf8.RuneError
+			}
+			for _, unit := range utf16.Encode([]rune{r}) {
+				if enc == EncodingUTF16LE {
+					dst = append(dst, byte(unit), byte(unit>>8))
+				} else {
+					dst = append(dst, byte(unit>>8), byte(unit))
+				}
+			}
+		}
+	}
+	return dst, true
+}
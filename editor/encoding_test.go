@@ -0,0 +1,241 @@
+package editor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+func TestOpenDetectsEncoding(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		enc     Encoding
+		invalid int
+		line0   string
+	}{
+		{"utf8", "héllo 日本\n", EncodingUTF8, 0, "héllo 日本"},
+		{"utf8 with a bad byte", "héllo 日本\nbad \xff byte\n", EncodingUTF8, 1, "héllo 日本"},
+		{"latin1", "caf\xe9 na\xefve\n", EncodingLatin1, 0, "café naïve"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "file.txt")
+			if err := os.WriteFile(path, []byte(tt.data), 0644); err != nil {
+				t.Fatal(err)
+			}
+			b, err := OpenBuffer(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer b.Close()
+			if b.Format.Encoding != tt.enc {
+				t.Errorf("Encoding = %v, want %v", b.Format.Encoding, tt.enc)
+			}
+			if b.InvalidBytes != tt.invalid {
+				t.Errorf("InvalidBytes = %d, want %d", b.InvalidBytes, tt.invalid)
+			}
+			if got := string(b.Line(0)); got != tt.line0 {
+				t.Errorf("line 0 = %q, want %q", got, tt.line0)
+			}
+		})
+	}
+}
+
+func TestSaveKeepsInvalidBytes(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	path := filepath.Join(t.TempDir(), "file.txt")
+	data := "héllo 日本\nbad \xff byte\n"
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	b, err := OpenBuffer(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	b.Column = len(b.Line(0))
+	b.InsertRune('€')
+	if err := b.Save(); err != nil {
+		t.Fatal(err)
+	}
+	saved, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "héllo 日本€\nbad \xff byte\n"; string(saved) != want {
+		t.Errorf("saved %q, want %q", saved, want)
+	}
+}
+
+func TestUTF8RoundTrip(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	long := strings.Repeat("ü", 70*1024)
+	tests := []struct {
+		name    string
+		data    string
+		invalid int
+		lines   []string
+	}{
+		{"accents and cjk", "Zoë Åström\n// 注释\n", 0, []string{"Zoë Åström", "// 注释"}},
+		{"emoji", "ok 👍🏽\n", 0, []string{"ok 👍🏽"}},
+		// Enough valid UTF-8 around the invalid bytes not to look like
+		// Latin-1.
+		{"invalid bytes", "日本語 a\xffb\n\xc0\xaf 日本\n", 3, []string{"日本語 a\xffb", "\xc0\xaf 日本"}},
+		{"cut sequence at the end", "日本語 end \xe6\x97", 2, []string{"日本語 end \xe6\x97"}},
+		{"line longer than 64KB", long + "\nnext\n", 0, []string{long, "next"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "file.txt")
+			if err := os.WriteFile(path, []byte(tt.data), 0644); err != nil {
+				t.Fatal(err)
+			}
+			b, err := OpenBuffer(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer b.Close()
+			if b.InvalidBytes != tt.invalid {
+				t.Errorf("InvalidBytes = %d, want %d", b.InvalidBytes, tt.invalid)
+			}
+			if b.LineCount() != len(tt.lines) {
+				t.Fatalf("LineCount() = %d, want %d", b.LineCount(), len(tt.lines))
+			}
+			for row, want := range tt.lines {
+				if got := string(b.rawLine(row)); got != want {
+					t.Errorf("line %d = %q, want %q", row, got, want)
+				}
+			}
+			if err := b.Save(); err != nil {
+				t.Fatal(err)
+			}
+			if saved, _ := os.ReadFile(path); string(saved) != tt.data {
+				t.Errorf("saved %q, want the file unchanged", saved)
+			}
+		})
+	}
+}
+
+func TestInvalidBytesAreSingleRunes(t *testing.T) {
+	b := newTestBuffer("x\xffy")
+	if got := len(b.Line(0)); got != 3 {
+		t.Fatalf("line has %d runes, want 3", got)
+	}
+	// Deleting the invalid byte removes it alone.
+	b.Column = 2
+	b.DeleteCharacter()
+	if got := string(b.rawLine(0)); got != "xy" {
+		t.Errorf("line = %q, want %q", got, "xy")
+	}
+}
+
+// utf16Bytes returns s in UTF-16, little endian unless big is set.
+func utf16Bytes(s string, big bool) string {
+	var out []byte
+	for _, unit := range utf16.Encode([]rune(s)) {
+		if big {
+			out = append(out, byte(unit>>8), byte(unit))
+		} else {
+			out = append(out, byte(unit), byte(unit>>8))
+		}
+	}
+	return string(out)
+}
+
+func TestEncodingRoundTrip(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	tests := []struct {
+		name  string
+		data  string
+		enc   Encoding
+		bom   bool
+		line0 string
+	}{
+		{"latin1", "caf\xe9 na\xefve\r\n\xc0 bient\xf4t\r\n", EncodingLatin1, false, "café naïve"},
+		{"utf16le with bom", "\xff\xfe" + utf16Bytes("héllo 😀\nzwei\n", false), EncodingUTF16LE, true, "héllo 😀"},
+		{"utf16be with bom", "\xfe\xff" + utf16Bytes("héllo 😀\nzwei\n", true), EncodingUTF16BE, true, "héllo 😀"},
+		{"utf16le without bom", utf16Bytes("plain ascii text\nline two\n", false), EncodingUTF16LE, false, "plain ascii text"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "file.txt")
+			if err := os.WriteFile(path, []byte(tt.data), 0644); err != nil {
+				t.Fatal(err)
+			}
+			b, err := OpenBuffer(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer b.Close()
+			if b.Format.Encoding != tt.enc || b.Format.BOM != tt.bom {
+				t.Errorf("encoding = %v, BOM %v, want %v, %v", b.Format.Encoding, b.Format.BOM, tt.enc, tt.bom)
+			}
+			if got := string(b.Line(0)); got != tt.line0 {
+				t.Errorf("line 0 = %q, want %q", got, tt.line0)
+			}
+			if err := b.Save(); err != nil {
+				t.Fatal(err)
+			}
+			if saved, _ := os.ReadFile(path); string(saved) != tt.data {
+				t.Errorf("saved %q, want the file unchanged", saved)
+			}
+		})
+	}
+}
+
+func TestUTF16OddByteIsLost(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	path := filepath.Join(t.TempDir(), "file.txt")
+	data := "\xff\xfe" + utf16Bytes("ab", false) + "\x41"
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	b, err := OpenBuffer(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	// The odd byte cannot be decoded and becomes U+FFFD, which is what
+	// saving writes back in its place.
+	if got := string(b.Line(0)); got != "ab�" {
+		t.Fatalf("line 0 = %q, want %q", got, "ab�")
+	}
+	if err := b.Save(); err != nil {
+		t.Fatal(err)
+	}
+	want := "\xff\xfe" + utf16Bytes("ab�", false)
+	if saved, _ := os.ReadFile(path); string(saved) != want {
+		t.Errorf("saved %q, want %q", saved, want)
+	}
+}
+
+func TestSaveInAnotherEncoding(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	path := filepath.Join(t.TempDir(), "file.txt")
+	if err := os.WriteFile(path, []byte("café\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	b, err := OpenBuffer(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	b.SetEncoding(EncodingLatin1)
+	if err := b.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if saved, _ := os.ReadFile(path); string(saved) != "caf\xe9\n" {
+		t.Errorf("saved %q, want Latin-1", saved)
+	}
+	// Characters Latin-1 does not have stop the save.
+	b.InsertRune('€')
+	if err := b.Save(); err == nil {
+		t.Error("saving € as Latin-1 did not fail")
+	}
+	if saved, _ := os.ReadFile(path); string(saved) != "caf\xe9\n" {
+		t.Errorf("after the failed save, file holds %q", saved)
+	}
+}
@@ -0,0 +1,79 @@
+package editor
+
+type encodingView struct {
+	cursor int
+}
+
+func (e *Editor) openEncodingSelector() {
+	e.encodingSelector = encodingView{}
+	for i, enc := range Encodings {
+		if enc == e.Buffer().Format.Encoding {
+			e.encodingSelector.cursor = i
+		}
+	}
+	e.mode = ModeEncoding
+}
+
+func (e *Editor) showEncodingSelector() {
+	w, h := e.screen.Size()
+	view := &e.encodingSelector
+	current := e.Buffer().Format.Encoding
+
+	pw := 52
+	ph := len(Encodings) + 5
+	x := (w - pw) / 2
+	y := (h - ph) / 2
+
+	e.drawPopupFrame(x, y, pw, ph, "Encoding")
+
+	for i, enc := range Encodings {
+		label := "  " + enc.String()
+		if enc == current {
+			label = "* " + enc.String()
+		}
+		var fg, bg Attribute = ColorWhite, ColorBlack
+		if i == view.cursor {
+			fg, bg = ColorBlack, ColorWhite
+		}
+		e.printCell(x+2, y+2+i, fg, bg, label)
+	}
+
+	footerText := "[Enter] Reopen  [s] Save as  [Esc] Close"
+	footerX := x + (pw-len(footerText))/2
+	e.printCell(footerX, y+ph-2, ColorBlue, ColorBlack, footerText)
+}
+
+func (e *Editor) processEncodingSelectorEvent(event Event) {
+	view := &e.encodingSelector
+	b := e.Buffer()
+	enc := Encodings[view.cursor]
+	if event.Ch == 's' {
+		b.SetEncoding(enc)
+		e.setMessage("Will be saved as " + enc.String())
+		e.mode = ModeEditor
+		return
+	}
+	switch event.Key {
+	case KeyEsc:
+		e.mode = ModeEditor
+	case KeyArrowUp:
+		if view.cursor > 0 {
+			view.cursor--
+		}
+	case KeyArrowDown:
+		if view.cursor < len(Encodings)-1 {
+			view.cursor++
+		}
+	case KeyEnter:
+		e.mode = ModeEditor
+		if b.Modified {
+			e.setMessage("Save or undo your changes before reopening in another encoding")
+			return
+		}
+		if err := b.ReopenWithEncoding(enc); err != nil {
+			e.setMessage("Error reading " + b.Path + ": " + err.Error())
+			return
+		}
+		e.setMessage("Reopened " + b.Path + " as " + enc.String())
+	}
+}
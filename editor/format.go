@@ -0,0 +1,83 @@
+package editor
+
+// LineEnding is the sequence that ends lines when a buffer is saved.
+type LineEnding int
+
+const (
+	LineEndingLF LineEnding = iota
+	LineEndingCRLF
+)
+
+func (l LineEnding) String() string {
+	if l == LineEndingCRLF {
+		return "CRLF"
+	}
+	return "LF"
+}
+
+func (l LineEnding) bytes() []byte {
+	if l == LineEndingCRLF {
+		return []byte("\r\n")
+	}
+	return []byte("\n")
+}
+
+var utf8BOM = []byte("\xEF\xBB\xBF")
+
+// FileFormat describes how the lines of a buffer are laid out in its file,
+// apart from their text. It is detected when a file is read and reproduced
+// when it is saved, so an unedited file is written back unchanged. A file
+// with mixed line endings is saved with the one most of its lines use.
+type FileFormat struct {
+	Encoding     Encoding   `json:"encoding"`
+	LineEnding   LineEnding `json:"line_ending"`
+	BOM          bool       `json:"bom"`
+	FinalNewline bool       `json:"final_newline"`
+}
+
+// defaultFormat is used for files that do not exist yet.
+var defaultFormat = FileFormat{Encoding: EncodingUTF8, LineEnding: LineEndingLF, FinalNewline: true}
+
+func (f FileFormat) String() string {
+	text := f.LineEnding.String()
+	if f.BOM {
+		text += " BOM"
+	}
+	if !f.FinalNewline {
+		text += " noeol"
+	}
+	return text
+}
+
+// SetEncoding changes the encoding the buffer is saved in. A byte order
+// mark is kept if the new encoding has one.
+func (b *Buffer) SetEncoding(enc Encoding) {
+	if b.Format.Encoding == enc {
+		return
+	}
+	b.Format.Encoding = enc
+	b.Format.BOM = b.Format.BOM && enc.bom() != nil
+	b.markDiverged()
+}
+
+// ReopenWithEncoding reads the buffer's file again, decoded from enc,
+// discarding unsaved changes. The cursor stays on the same line and column
+// where possible.
+func (b *Buffer) ReopenWithEncoding(enc Encoding) error {
+	row, column := b.Row, b.Column
+	b.removeSwap()
+	err := b.readFile(b.Path, enc)
+	b.Modified = false
+	b.Row, b.Column = row, column
+	b.clampCursor()
+	return err
+}
+
+// SetLineEnding changes the line ending used when the buffer is saved.
+func (b *Buffer) SetLineEnding(ending LineEnding) {
+	if b.Format.LineEnding == ending {
+		return
+	}
+	b.Format.LineEnding = ending
+	b.markDiverged()
+}
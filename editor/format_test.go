@@ -0,0 +1,78 @@
+package editor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFormatRoundTrip(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	tests := []struct {
+		name   string
+		data   string
+		format string
+		lines  []string
+		saved  string
+	}{
+		{"lf", "one\ntwo\n", "LF", []string{"one", "two"}, ""},
+		{"crlf", "one\r\ntwo\r\n", "CRLF", []string{"one", "two"}, ""},
+		{"bom", "\xEF\xBB\xBFone\ntwo\n", "LF BOM", []string{"one", "two"}, ""},
+		{"no final newline", "one\r\ntwo", "CRLF noeol", []string{"one", "two"}, ""},
+		{"empty last line", "one\n\n", "LF", []string{"one", ""}, ""},
+		// Mixed line endings are saved as the one most lines use.
+		{"mostly crlf", "one\r\ntwo\nthree\r\n", "CRLF", []string{"one", "two", "three"}, "one\r\ntwo\r\nthree\r\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "file.txt")
+			if err := os.WriteFile(path, []byte(tt.data), 0644); err != nil {
+				t.Fatal(err)
+			}
+			b, err := OpenBuffer(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer b.Close()
+			if got := b.Format.String(); got != tt.format {
+				t.Errorf("format = %q, want %q", got, tt.format)
+			}
+			if got := bufferText(b); got != strings.Join(tt.lines, "\n") {
+				t.Errorf("text = %q, want %q", got, strings.Join(tt.lines, "\n"))
+			}
+			if err := b.Save(); err != nil {
+				t.Fatal(err)
+			}
+			saved, _ := os.ReadFile(path)
+			want := tt.data
+			if tt.saved != "" {
+				want = tt.saved
+			}
+			if string(saved) != want {
+				t.Errorf("saved %q, want %q", saved, want)
+			}
+		})
+	}
+}
+
+func TestToggleLineEnding(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Chdir(t.TempDir())
+	if err := os.WriteFile("dos.txt", []byte("one\r\ntwo\r\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	e := NewEditor(NewMemoryScreen(80, 8))
+	e.Open("dos.txt")
+	b := e.Buffer()
+	typeKeys(e, "L")
+	if b.Format.LineEnding != LineEndingLF || !b.Modified {
+		t.Fatalf("after L, line ending %v, modified %v, want LF and modified", b.Format.LineEnding, b.Modified)
+	}
+	if err := b.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile("dos.txt"); string(data) != "one\ntwo\n" {
+		t.Errorf("saved %q, want LF line endings", data)
+	}
+}
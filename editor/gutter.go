@@ -0,0 +1,62 @@
+package editor
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// lineNumberSettings are the values of the line_numbers setting. Relative
+// numbers count the lines from the cursor's, and hybrid ones show the
+// cursor's line number in place of its 0.
+var lineNumberSettings = []string{"absolute", "relative", "hybrid", "off"}
+
+// gutterWidth returns how many columns the line numbers of b take with the
+// space after them: enough for its last line's number, and at least 3.
+func gutterWidth(b *Buffer) int {
+	if editSettings.LineNumbers == "off" {
+		return 0
+	}
+	return max(len(strconv.Itoa(b.LineCount())), 3) + 1
+}
+
+// lineNumber returns the number shown beside row when the cursor is on
+// cursorRow.
+func lineNumber(row, cursorRow int) int {
+	distance := max(row-cursorRow, cursorRow-row)
+	switch editSettings.LineNumbers {
+	case "relative":
+		return distance
+	case "hybrid":
+		if distance > 0 {
+			return distance
+		}
+	}
+	return row + 1
+}
+
+// displayGutter draws the line numbers left of the text of w, the cursor's
+// in the text color. Numbers too long for a gutter narrowed to fit the
+// window keep their last digits.
+func (e *Editor) displayGutter(w *window) {
+	if w.gutter == 0 {
+		return
+	}
+	b := w.buffer
+	cursorRow := w.row
+	if w == e.window {
+		cursorRow = b.Row
+	}
+	for scrRow := range w.height {
+		row := w.offsetRow + scrRow
+		if row >= b.LineCount() {
+			break
+		}
+		fg := CurrentTheme.LineNumber
+		if row == cursorRow {
+			fg = CurrentTheme.Foreground
+		}
+		number := strconv.Itoa(lineNumber(row, cursorRow))
+		number = number[max(len(number)-(w.gutter-1), 0):]
+		e.printCell(w.x, w.y+scrRow, fg, CurrentTheme.Background, fmt.Sprintf("%*s ", w.gutter-1, number))
+	}
+}
@@ -0,0 +1,78 @@
+package editor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func numberedLines(n int) string {
+	lines := make([]string, n)
+	for i := range lines {
+		lines[i] = fmt.Sprintf("line %d", i+1)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestGutterKeepsLastDigits(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	useSettings(t, Settings{TabSize: 4, Theme: "one-dark", LineNumbers: "absolute"})
+	screen := NewMemoryScreen(20, 4)
+	e := NewEditor(screen)
+	b := newTestBuffer(numberedLines(1200))
+	// Half of a 6 column window leaves room for two digits.
+	w := &window{buffer: b, width: 6, height: 3, gutter: 3, offsetRow: 1008}
+	e.displayGutter(w)
+	for y, want := range []string{"09", "10", "11"} {
+		if got := screen.Line(y); got != want {
+			t.Errorf("gutter row %d = %q, want %q", y, got, want)
+		}
+	}
+}
+
+func TestGutterFollowsShrunkBuffer(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	useSettings(t, Settings{TabSize: 4, Theme: "one-dark", LineNumbers: "absolute"})
+	screen := NewMemoryScreen(80, 9)
+	e := NewEditor(screen)
+	b := newTestBuffer(numberedLines(20))
+	e.buffers, e.window.buffer = []*Buffer{b}, b
+	e.Draw()
+	e.splitWindow(false)
+	below := e.layout.windows()[1]
+	below.offsetRow = 18
+	// Lines deleted through the focused window leave the other one
+	// scrolled past the end of the buffer.
+	b.replaceLines(0, 17, nil)
+	e.Draw()
+
+	if got, want := screen.Line(below.y), "  3 line 20"; got != want {
+		t.Errorf("first row of the lower window = %q, want %q", got, want)
+	}
+}
+
+func TestLineNumbersDefault(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	settings, err := LoadSettings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settings.LineNumbers != "absolute" {
+		t.Errorf("new settings file: line_numbers = %q, want %q", settings.LineNumbers, "absolute")
+	}
+
+	// A settings file from before the gutter existed has no line_numbers.
+	path := filepath.Join(home, ".gocodeeditor", "settings.json")
+	if err := os.WriteFile(path, []byte(`{"tab_size": 8, "theme": "dracula"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if settings, err = LoadSettings(); err != nil {
+		t.Fatal(err)
+	}
+	if settings.LineNumbers != "off" {
+		t.Errorf("old settings file: line_numbers = %q, want %q", settings.LineNumbers, "off")
+	}
+}
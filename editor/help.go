@@ -1,41 +1,54 @@
 package editor
 
+import (
+	"slices"
+	"strings"
+)
+
 type KeyBinding struct {
 	Key         string
 	Mode        string
 	Description string
 }
 
-func GetKeyBindings() []KeyBinding {
-	return []KeyBinding{
-		{Key: "ESC", Mode: "Any", Description: "Exit insert mode / Close popover"},
-		{Key: "i", Mode: "Visual", Description: "Enter insert mode"},
-		{Key: "w", Mode: "Visual", Description: "Save file"},
-		{Key: "q", Mode: "Visual", Description: "Quit editor"},
-		{Key: "h", Mode: "Visual", Description: "Show this help"},
-		{Key: "c", Mode: "Visual", Description: "Copy current line"},
-		{Key: "p", Mode: "Visual", Description: "Paste copied line below"},
-		{Key: "d", Mode: "Visual", Description: "Delete current line"},
-		{Key: "s", Mode: "Visual", Description: "Save current buffer for undo"},
-		{Key: "l", Mode: "Visual", Description: "Load saved buffer (undo)"},
-		{Key: "o", Mode: "Visual", Description: "Open file browser"},
-		{Key: "t", Mode: "Visual", Description: "Toggle theme"},
-		{Key: "Left", Mode: "Any", Description: "Move cursor left"},
-		{Key: "Right", Mode: "Any", Description: "Move cursor right"},
-		{Key: "Up", Mode: "Any", Description: "Move cursor up"},
-		{Key: "Down", Mode: "Any", Description: "Move cursor down"},
-		{Key: "Home", Mode: "Any", Description: "Move to start of line"},
-		{Key: "End", Mode: "Any", Description: "Move to end of line"},
-		{Key: "PgUp", Mode: "Any", Description: "Move up by quarter page"},
-		{Key: "PgDn", Mode: "Any", Description: "Move down by quarter page"},
-		{Key: "Enter", Mode: "Insert", Description: "Insert new line"},
-		{Key: "Backspace", Mode: "Insert", Description: "Delete character"},
-		{Key: "Tab", Mode: "Insert", Description: "Insert tab"},
+// modeLabels are how the help names the keymap modes.
+var modeLabels = map[string]string{
+	"normal": "Normal", "insert": "Insert", "visual": "Visual", "browser": "Browser", "theme": "Theme",
+}
+
+// KeyBindings lists the bindings of the editor's keymaps, one entry per
+// action and set of keys, in the order of the actions. An action bound to
+// the same keys in several modes is listed once, as "Any" if they are the
+// normal, insert and visual modes.
+func (e *Editor) KeyBindings() []KeyBinding {
+	var bindings []KeyBinding
+	for _, act := range actions {
+		var modes []string
+		var keys []string
+		for _, mode := range keymapModes {
+			bound := strings.Join(e.boundKeys(mode, act.name), " / ")
+			if bound == "" {
+				continue
+			}
+			if i := slices.Index(keys, bound); i >= 0 {
+				modes[i] += "/" + modeLabels[mode]
+				continue
+			}
+			modes = append(modes, modeLabels[mode])
+			keys = append(keys, bound)
+		}
+		for i := range keys {
+			mode := modes[i]
+			if mode == "Normal/Insert/Visual" {
+				mode = "Any"
+			}
+			bindings = append(bindings, KeyBinding{Key: keys[i], Mode: mode, Description: act.description})
+		}
 	}
+	return append(bindings, KeyBinding{Key: "1-9", Mode: "Normal/Visual", Description: "Count for the next motion or operator, as in 3dd"})
 }
 
-func FormatKeyBindingsHelp() []string {
-	bindings := GetKeyBindings()
+func FormatKeyBindingsHelp(bindings []KeyBinding) []string {
 	var lines []string
 
 	// Header with proper centering
@@ -44,8 +57,11 @@ func FormatKeyBindingsHelp() []string {
 	lines = append(lines, "")
 
 	// Calculate column widths
-	keyWidth := 12  // Increased to accommodate longer key names
-	modeWidth := 10 // Increased for better spacing
+	keyWidth, modeWidth := 12, 10
+	for _, binding := range bindings {
+		keyWidth = max(keyWidth, len(binding.Key)+2)
+		modeWidth = max(modeWidth, len(binding.Mode))
+	}
 
 	// Format each binding with proper column alignment
 	for _, binding := range bindings {
@@ -67,5 +83,18 @@ func FormatKeyBindingsHelp() []string {
 		lines = append(lines, line)
 	}
 
+	lines = append(lines, "", "Keys that did something else in earlier versions:", "")
+	lines = append(lines, changedKeys...)
 	return lines
 }
+
+// changedKeys tells users of earlier versions, where the letters below were
+// single key commands, what the default bindings do now.
+var changedKeys = []string{
+	"    w  moves to the next word; save with Ctrl+S or :w",
+	"    c  changes text over a motion; yy copies the line",
+	"    d  deletes text over a motion; dd deletes the line",
+	"    t  moves till a character; Ctrl+T opens the themes",
+	"    s  is not bound; every change can be undone with u",
+	"    l  is not bound; u undoes and Ctrl+R redoes",
+}
@@ -0,0 +1,265 @@
+package editor
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// keymap binds key sequences to the names of actions in one mode. A
+// sequence is the names of its keys, as keyName gives them, separated by
+// spaces. prefixes holds every sequence that starts a longer one; a key
+// that continues one waits for the rest instead of running a shorter
+// binding.
+type keymap struct {
+	bindings map[string]string
+	prefixes map[string]bool
+}
+
+// keymapModes are the modes that have keymaps, as settings.json names them.
+var keymapModes = []string{"normal", "insert", "visual", "browser", "theme"}
+
+// motionKeys are the default bindings of the motions in normal and visual
+// mode. Insert mode only gets the ones on special keys.
+var motionKeys = map[string]string{
+	"Left": "left", "Right": "right", "Up": "up", "Down": "down",
+	"PgUp": "page-up", "PgDn": "page-down", "Home": "line-start", "End": "line-end",
+	"0": "line-start", "^": "first-character", "$": "line-end",
+	"w": "word-forward", "b": "word-backward", "e": "word-end",
+	"}": "paragraph-forward", "{": "paragraph-backward",
+	"g g": "first-line", "G": "last-line", "%": "matching-bracket",
+	"f": "find-char", "F": "find-char-backward", "t": "till-char", "T": "till-char-backward",
+	";": "repeat-find", ",": "repeat-find-reverse",
+}
+
+var defaultKeymaps = map[string]map[string]string{
+	"normal": {
+		"Esc": "clear", "i": "insert", "Ctrl+S": "save", "q": "quit", "Q": "quit-now", "h": "help",
+		"p": "paste", "u": "undo", "Ctrl+R": "redo", "U": "undo-tree", "L": "line-endings", "E": "encoding",
+		"/": "search-forward", "?": "search-backward", "n": "search-next", "N": "search-previous",
+		":": "command-line", "o": "file-browser", "Ctrl+T": "theme", "\"": "register", "P": "registers",
+		"B": "buffers", "Ctrl+N": "next-buffer", "Ctrl+P": "previous-buffer", "m": "record-macro", "@": "play-macro",
+		"d": "delete", "c": "change", "y": "copy",
+		"Ctrl+W s": "split-window", "Ctrl+W v": "vsplit-window", "Ctrl+W w": "next-window", "Ctrl+W Ctrl+W": "next-window",
+		"Ctrl+W W": "previous-window", "Ctrl+W h": "window-left", "Ctrl+W j": "window-down", "Ctrl+W k": "window-up",
+		"Ctrl+W l": "window-right", "Ctrl+W Left": "window-left", "Ctrl+W Down": "window-down", "Ctrl+W Up": "window-up",
+		"Ctrl+W Right": "window-right", "Ctrl+W c": "close-window", "Ctrl+W q": "close-window", "Ctrl+W o": "only-window",
+		"Ctrl+W +": "taller-window", "Ctrl+W -": "shorter-window", "Ctrl+W >": "wider-window", "Ctrl+W <": "narrower-window",
+		"Ctrl+W =": "equalize-windows", "Ctrl+W T": "window-to-tab", "g n": "new-tab", "g c": "close-tab",
+		"g t": "next-tab", "g T": "previous-tab", "g <": "move-tab-left", "g >": "move-tab-right",
+		"v": "select", "V": "select-lines", "Ctrl+V": "select-block",
+	},
+	"insert": {
+		"Esc": "leave-insert", "Enter": "newline", "Backspace": "delete-back", "Ctrl+H": "delete-back",
+		"Left": "left", "Right": "right", "Up": "up", "Down": "down",
+		"PgUp": "page-up", "PgDn": "page-down", "Home": "line-start", "End": "line-end",
+	},
+	"visual": {
+		"Esc": "leave-selection", "v": "select", "V": "select-lines", "Ctrl+V": "select-block",
+		"y": "copy-selection", "c": "change-selection", "d": "delete-selection", "x": "delete-selection",
+		">": "indent", "<": "outdent", "~": "toggle-case", "u": "lower-case", "U": "upper-case",
+		"o": "other-end", ":": "command-line", "\"": "register", "Ctrl+S": "save", "Ctrl+T": "theme",
+	},
+	"browser": {
+		"Up": "browser-up", "Down": "browser-down", "Enter": "browser-open", "Esc": "browser-close",
+	},
+	"theme": {
+		"Up": "theme-previous", "Down": "theme-next", "Enter": "theme-apply", "Esc": "theme-cancel",
+	},
+}
+
+// keyNames are the names of the special keys in keymaps. Other keys are
+// named by their character, and Alt+ is put before keys pressed with Alt.
+var keyNames = map[Key]string{
+	KeyEnter: "Enter", KeyEsc: "Esc", KeyTab: "Tab", KeyBackTab: "Shift+Tab", KeySpace: "Space",
+	KeyBackspace2: "Backspace", KeyBackspace: "Ctrl+H", KeyInsert: "Insert", KeyDelete: "Delete",
+	KeyHome: "Home", KeyEnd: "End", KeyPgUp: "PgUp", KeyPgDn: "PgDn",
+	KeyArrowUp: "Up", KeyArrowDown: "Down", KeyArrowLeft: "Left", KeyArrowRight: "Right",
+}
+
+func init() {
+	for key := KeyCtrlA; key <= KeyCtrlZ; key++ {
+		if _, ok := keyNames[key]; !ok {
+			keyNames[key] = "Ctrl+" + string(rune('A'+key-KeyCtrlA))
+		}
+	}
+}
+
+// keyName returns the name of the key pressed in keyEvent, or "" for one
+// that has none.
+func keyName(keyEvent Event) string {
+	name := keyNames[keyEvent.Key]
+	if keyEvent.Ch != 0 {
+		name = string(keyEvent.Ch)
+	}
+	if name != "" && keyEvent.Mod&ModAlt != 0 {
+		name = "Alt+" + name
+	}
+	return name
+}
+
+// parseKeys returns the sequence of key names written in s. Keys are
+// separated by spaces, and a word that is not the name of a special key
+// stands for the keys of its characters, so "g g" and "gg" are the same.
+// Names are matched regardless of case.
+func parseKeys(s string) (string, error) {
+	var keys []string
+	for _, word := range strings.Fields(s) {
+		if name, ok := specialKeyName(word); ok {
+			keys = append(keys, name)
+			continue
+		}
+		if len(word) > 4 && strings.EqualFold(word[:4], "alt+") {
+			rest := word[4:]
+			if name, ok := specialKeyName(rest); ok {
+				keys = append(keys, "Alt+"+name)
+				continue
+			}
+			if utf8.RuneCountInString(rest) == 1 {
+				keys = append(keys, "Alt+"+rest)
+				continue
+			}
+		}
+		if strings.Contains(word[1:], "+") {
+			return "", fmt.Errorf("unknown key %q", word)
+		}
+		for _, ch := range word {
+			keys = append(keys, string(ch))
+		}
+	}
+	if len(keys) == 0 {
+		return "", fmt.Errorf("no keys in %q", s)
+	}
+	return strings.Join(keys, " "), nil
+}
+
+func specialKeyName(word string) (string, bool) {
+	for _, name := range keyNames {
+		if strings.EqualFold(word, name) {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// loadKeymaps returns the default keymaps with the bindings of custom,
+// which maps each mode to key sequences and the names of the actions to
+// bind them to, put over them. Binding a sequence to "" or "none" removes
+// it. Bindings that cannot be made are skipped, and the first of them is
+// reported.
+func loadKeymaps(custom map[string]map[string]string) (map[string]keymap, error) {
+	var firstErr error
+	keymaps := map[string]keymap{}
+	for _, mode := range keymapModes {
+		km := keymap{bindings: map[string]string{}, prefixes: map[string]bool{}}
+		defaults := maps.Clone(defaultKeymaps[mode])
+		if mode == "normal" || mode == "visual" {
+			maps.Copy(defaults, motionKeys)
+		}
+		for keys, name := range defaults {
+			km.bind(mode, keys, name)
+		}
+		for _, keys := range slices.Sorted(maps.Keys(custom[mode])) {
+			if err := km.bind(mode, keys, custom[mode][keys]); err != nil && firstErr == nil {
+				firstErr = fmt.Errorf("keymaps: %s mode: %w", mode, err)
+			}
+		}
+		for sequence := range km.bindings {
+			for i := range len(sequence) {
+				if sequence[i] == ' ' {
+					km.prefixes[sequence[:i]] = true
+				}
+			}
+		}
+		keymaps[mode] = km
+	}
+	for _, mode := range slices.Sorted(maps.Keys(custom)) {
+		if !slices.Contains(keymapModes, mode) && firstErr == nil {
+			firstErr = fmt.Errorf("keymaps: unknown mode %q", mode)
+		}
+	}
+	return keymaps, firstErr
+}
+
+func (km keymap) bind(mode, keys, name string) error {
+	sequence, err := parseKeys(keys)
+	if err != nil {
+		return err
+	}
+	if name == "" || name == "none" {
+		delete(km.bindings, sequence)
+		return nil
+	}
+	act := findAction(name)
+	if act == nil {
+		return fmt.Errorf("unknown command %q", name)
+	}
+	if !slices.Contains(act.modes, mode) {
+		return fmt.Errorf("%s cannot be bound in %s mode", name, mode)
+	}
+	km.bindings[sequence] = name
+	return nil
+}
+
+// keyAction adds keyEvent to the keys typed so far in mode and returns the
+// action they are bound to. pending is true while they start a longer
+// sequence. For keys bound to nothing the action is nil, and typed holds
+// them all.
+func (e *Editor) keyAction(mode string, keyEvent Event) (act *action, pending bool, typed []Event) {
+	km := e.keymaps[mode]
+	typed = append(e.pendingKeys, keyEvent)
+	e.pendingKeys = nil
+	names := make([]string, len(typed))
+	for i, event := range typed {
+		names[i] = keyName(event)
+	}
+	sequence := strings.Join(names, " ")
+	if km.prefixes[sequence] {
+		e.pendingKeys = typed
+		return nil, true, nil
+	}
+	if name, ok := km.bindings[sequence]; ok {
+		return findAction(name), false, nil
+	}
+	return nil, false, typed
+}
+
+// boundKeys returns the key sequences bound to the action name in mode,
+// shortest first, as the help shows them: "gg" for "g g", and "Ctrl+W v"
+// where a key has a longer name.
+func (e *Editor) boundKeys(mode, name string) []string {
+	var keys []string
+	for sequence, bound := range e.keymaps[mode].bindings {
+		if bound != name {
+			continue
+		}
+		parts := strings.Split(sequence, " ")
+		separator := ""
+		for _, part := range parts {
+			if utf8.RuneCountInString(part) > 1 {
+				separator = " "
+			}
+		}
+		keys = append(keys, strings.Join(parts, separator))
+	}
+	slices.SortFunc(keys, func(a, b string) int {
+		if len(a) != len(b) {
+			return len(a) - len(b)
+		}
+		return strings.Compare(a, b)
+	})
+	return keys
+}
+
+// keymapMode returns the keymap for the text area's current mode.
+func (e *Editor) keymapMode() string {
+	switch {
+	case e.editMode == EditInsert:
+		return "insert"
+	case e.selecting():
+		return "visual"
+	}
+	return "normal"
+}
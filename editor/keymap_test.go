@@ -0,0 +1,100 @@
+package editor
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseKeys(t *testing.T) {
+	for _, tt := range []struct {
+		keys string
+		want string
+	}{
+		{"gg", "g g"},
+		{"g g", "g g"},
+		{"ctrl+w v", "Ctrl+W v"},
+		{"Ctrl+W Ctrl+W", "Ctrl+W Ctrl+W"},
+		{"alt+x", "Alt+x"},
+		{"Alt+enter", "Alt+Enter"},
+		{"pgdn", "PgDn"},
+		{"+", "+"},
+	} {
+		got, err := parseKeys(tt.keys)
+		if err != nil || got != tt.want {
+			t.Errorf("parseKeys(%q) = %q, %v, want %q", tt.keys, got, err, tt.want)
+		}
+	}
+	for _, keys := range []string{"", "  ", "Hyper+x", "Alt+xy"} {
+		if got, err := parseKeys(keys); err == nil {
+			t.Errorf("parseKeys(%q) = %q, want an error", keys, got)
+		}
+	}
+}
+
+func TestLoadKeymapsReportsFirstError(t *testing.T) {
+	keymaps, err := loadKeymaps(map[string]map[string]string{
+		"normal": {"x": "no-such-command", "Ctrl+U": "undo"},
+		"visual": {"z": "undo"},
+	})
+	if err == nil || err.Error() != `keymaps: normal mode: unknown command "no-such-command"` {
+		t.Errorf("error = %v", err)
+	}
+	// The bindings that can be made still are.
+	if got := keymaps["normal"].bindings["Ctrl+U"]; got != "undo" {
+		t.Errorf("Ctrl+U is bound to %q, want undo", got)
+	}
+	if _, ok := keymaps["visual"].bindings["z"]; ok {
+		t.Error("undo was bound in visual mode")
+	}
+
+	_, err = loadKeymaps(map[string]map[string]string{"visual": {"z": "undo"}})
+	if err == nil || err.Error() != "keymaps: visual mode: undo cannot be bound in visual mode" {
+		t.Errorf("error = %v", err)
+	}
+	_, err = loadKeymaps(map[string]map[string]string{"command": {"z": "undo"}})
+	if err == nil || err.Error() != `keymaps: unknown mode "command"` {
+		t.Errorf("error = %v", err)
+	}
+}
+
+func TestCustomKeymap(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	useSettings(t, Settings{TabSize: 4, Theme: "one-dark", Keymaps: map[string]map[string]string{
+		"normal": {"u": "none", "z u": "undo", "Alt+r": "redo", "Ctrl+W x": "no-such-command"},
+	}})
+	e := NewEditor(NewMemoryScreen(80, 8))
+	if want := `keymaps: normal mode: unknown command "no-such-command"`; e.message != want {
+		t.Errorf("message = %q, want %q", e.message, want)
+	}
+	b := newTestBuffer("one two")
+	e.buffers, e.window.buffer = []*Buffer{b}, b
+
+	typeKeys(e, "dw")
+	typeKeys(e, "u")
+	if got, want := bufferText(b), "two"; got != want {
+		t.Errorf("after u, which is unbound, buffer = %q, want %q", got, want)
+	}
+	typeKeys(e, "z")
+	if got, want := e.pendingCommand(), "z"; got != want {
+		t.Errorf("pending command = %q, want %q", got, want)
+	}
+	typeKeys(e, "u")
+	if got, want := bufferText(b), "one two"; got != want {
+		t.Errorf("after zu, buffer = %q, want %q", got, want)
+	}
+	e.HandleEvent(Event{Type: EventKey, Ch: 'r', Mod: ModAlt})
+	if got, want := bufferText(b), "two"; got != want {
+		t.Errorf("after Alt+r, buffer = %q, want %q", got, want)
+	}
+
+	// The help lists the keys as they are bound now.
+	var undoKeys []string
+	for _, binding := range e.KeyBindings() {
+		if binding.Description == "Undo last change" {
+			undoKeys = append(undoKeys, binding.Key)
+		}
+	}
+	if want := []string{"zu"}; !slices.Equal(undoKeys, want) {
+		t.Errorf("help lists undo as %q, want %q", undoKeys, want)
+	}
+}
@@ -0,0 +1,528 @@
+package editor
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"slices"
+	"time"
+)
+
+// lineStore holds the lines of a buffer in a B+ tree. Leaves are chunks of
+// raw file bytes, each line terminated by '\n', and every node knows how
+// many lines it holds. Finding, inserting or deleting a line walks a single
+// root-to-leaf path, and changing a line rewrites only the leaf it is in,
+// so edits cost O(log n) in the number of lines plus the size of one leaf.
+//
+// Leaves of a large file are not read when it is opened. They keep the
+// offset of their bytes in the file and read them on first use, so opening
+// a file only has to scan it once to count lines. Saving replaces the file
+// by renaming a new one over it, so the open handle keeps reading the
+// contents the leaves were scanned from. A program that rewrites the file
+// in place instead changes the bytes under the unread leaves, which
+// lineSource detects; the store then refuses to hand out its lines whole.
+//
+// Leaf data is never modified once created; edits build a new slice. Lines
+// returned by line therefore stay valid after later edits.
+type lineStore struct {
+	root *lineNode
+	src  *lineSource
+}
+
+// errSourceChanged is returned when lines not yet read from a file were
+// lost because it was rewritten in place.
+var errSourceChanged = errors.New("the file was rewritten in place, losing the lines not yet read from it; reload it")
+
+// lineSource is the file unread leaves read their bytes from, with the
+// size and modification time it had when they were scanned. changed is set
+// once a read finds that it no longer has them.
+type lineSource struct {
+	file    *os.File
+	size    int64
+	modTime time.Time
+	changed bool
+}
+
+// check reports whether the file is still as it was when it was scanned.
+func (src *lineSource) check() bool {
+	if !src.changed {
+		info, err := src.file.Stat()
+		src.changed = err != nil || info.Size() != src.size || !info.ModTime().Equal(src.modTime)
+	}
+	return !src.changed
+}
+
+const (
+	leafTargetBytes = 32 * 1024
+	leafMaxBytes    = 64 * 1024
+	maxChildren     = 32
+)
+
+type lineNode struct {
+	parent   *lineNode
+	children []*lineNode
+	lines    int
+
+	data   []byte
+	starts []int
+
+	// Unread leaves hold the position of their bytes in src instead of
+	// data. unterminated is set for the last leaf of a file that does not
+	// end in a newline.
+	src          *lineSource
+	offset       int64
+	size         int
+	unterminated bool
+}
+
+func (n *lineNode) isLeaf() bool {
+	return n.children == nil
+}
+
+// newLineStore returns a store holding lines, which must not be empty.
+func newLineStore(lines [][]byte) *lineStore {
+	leaf := &lineNode{}
+	leaf.data = appendLines(nil, lines)
+	leaf.lines = len(lines)
+	s := &lineStore{root: leaf}
+	if len(leaf.data) > leafMaxBytes {
+		s.splitLeaf(leaf)
+	}
+	return s
+}
+
+func appendLines(dst []byte, lines [][]byte) []byte {
+	for _, line := range lines {
+		dst = append(dst, line...)
+		dst = append(dst, '\n')
+	}
+	return dst
+}
+
+// buildLineStore builds a balanced tree over leaves, which must not be
+// empty.
+func buildLineStore(leaves []*lineNode, src *lineSource) *lineStore {
+	level := leaves
+	for len(level) > 1 {
+		var parents []*lineNode
+		for i := 0; i < len(level); i += maxChildren {
+			end := min(i+maxChildren, len(level))
+			parent := &lineNode{children: append([]*lineNode(nil), level[i:end]...)}
+			for _, child := range parent.children {
+				child.parent = parent
+				parent.lines += child.lines
+			}
+			parents = append(parents, parent)
+		}
+		level = parents
+	}
+	return &lineStore{root: level[0], src: src}
+}
+
+func (s *lineStore) count() int {
+	return s.root.lines
+}
+
+func (s *lineStore) close() {
+	if s.src != nil {
+		s.src.file.Close()
+		s.src = nil
+	}
+}
+
+// inMemory reports whether every line is held in memory rather than read
+// from the file when needed.
+func (s *lineStore) inMemory() bool {
+	return s.src == nil
+}
+
+// intact returns errSourceChanged if lines were read from the file after it
+// was rewritten in place, so that the store no longer holds the lines it
+// was scanned with.
+func (s *lineStore) intact() error {
+	if s.src != nil && s.src.changed {
+		return errSourceChanged
+	}
+	return nil
+}
+
+// loadAll reads every unread leaf into memory and closes the file, so that
+// the store no longer depends on it. It fails if the file was rewritten in
+// place before all of them were read.
+func (s *lineStore) loadAll() error {
+	if s.src == nil {
+		return nil
+	}
+	var walk func(n *lineNode)
+	walk = func(n *lineNode) {
+		for _, child := range n.children {
+			walk(child)
+		}
+		if n.isLeaf() {
+			n.lineStarts()
+		}
+	}
+	walk(s.root)
+	if err := s.intact(); err != nil {
+		return err
+	}
+	s.close()
+	return nil
+}
+
+// load reads the bytes of an unread leaf. If the file has been truncated or
+// rewritten since it was scanned, its source is marked as changed, and the
+// result is padded or cut so the leaf still holds the number of lines the
+// tree expects.
+func (n *lineNode) load() []byte {
+	if n.data != nil {
+		return n.data
+	}
+	data := make([]byte, n.size, n.size+1)
+	read, _ := n.src.file.ReadAt(data, n.offset)
+	data = data[:read]
+	n.src.check()
+	if n.unterminated {
+		data = append(data, '\n')
+	}
+	found := bytes.Count(data, []byte{'\n'})
+	for ; found < n.lines; found++ {
+		data = append(data, '\n')
+	}
+	for found > n.lines {
+		data = data[:bytes.LastIndexByte(data[:len(data)-1], '\n')+1]
+		found--
+	}
+	return data
+}
+
+func (n *lineNode) lineStarts() []int {
+	if n.starts == nil {
+		if n.data == nil {
+			n.data = n.load()
+			n.src = nil
+		}
+		starts := make([]int, 0, n.lines+1)
+		starts = append(starts, 0)
+		for i, c := range n.data {
+			if c == '\n' {
+				starts = append(starts, i+1)
+			}
+		}
+		n.starts = starts
+	}
+	return n.starts
+}
+
+// find returns the leaf holding row and the index of row within it. A row
+// equal to the line count yields the end of the last leaf.
+func (s *lineStore) find(row int) (*lineNode, int) {
+	node := s.root
+	for !node.isLeaf() {
+		last := len(node.children) - 1
+		for i, child := range node.children {
+			if row < child.lines || i == last {
+				node = child
+				break
+			}
+			row -= child.lines
+		}
+	}
+	return node, row
+}
+
+// line returns the bytes of row without the trailing newline.
+func (s *lineStore) line(row int) []byte {
+	leaf, local := s.find(row)
+	starts := leaf.lineStarts()
+	return leaf.data[starts[local] : starts[local+1]-1]
+}
+
+// replace replaces count lines starting at row with lines.
+func (s *lineStore) replace(row, count int, lines [][]byte) {
+	leaf, local := s.find(row)
+	if local+count <= leaf.lines {
+		s.rewriteLeaf(leaf, local, count, lines)
+		return
+	}
+	for count > 0 {
+		leaf, local = s.find(row)
+		removed := min(count, leaf.lines-local)
+		s.rewriteLeaf(leaf, local, removed, nil)
+		count -= removed
+	}
+	if len(lines) > 0 {
+		leaf, local = s.find(row)
+		s.rewriteLeaf(leaf, local, 0, lines)
+	}
+}
+
+func (s *lineStore) rewriteLeaf(leaf *lineNode, local, count int, lines [][]byte) {
+	starts := leaf.lineStarts()
+	head := leaf.data[:starts[local]]
+	tail := leaf.data[starts[local+count]:]
+	data := make([]byte, 0, len(head)+len(tail)+len(lines)*8)
+	data = append(data, head...)
+	data = appendLines(data, lines)
+	data = append(data, tail...)
+	leaf.data = data
+	leaf.starts = nil
+
+	delta := len(lines) - count
+	for n := leaf; n != nil; n = n.parent {
+		n.lines += delta
+	}
+
+	switch {
+	case leaf.lines == 0:
+		s.removeNode(leaf)
+	case len(leaf.data) > leafMaxBytes:
+		s.splitLeaf(leaf)
+	}
+}
+
+// removeNode unlinks an empty node, and any ancestors it leaves empty. The
+// root is kept, as an empty leaf if need be.
+func (s *lineStore) removeNode(node *lineNode) {
+	for node != s.root && node.lines == 0 {
+		parent := node.parent
+		for i, child := range parent.children {
+			if child == node {
+				parent.children = append(parent.children[:i:i], parent.children[i+1:]...)
+				break
+			}
+		}
+		node = parent
+	}
+	if s.root.lines == 0 {
+		s.root = &lineNode{data: []byte{}}
+		return
+	}
+	for !s.root.isLeaf() && len(s.root.children) == 1 {
+		s.root = s.root.children[0]
+		s.root.parent = nil
+	}
+}
+
+// splitLeaf breaks an oversized leaf into leaves of about leafTargetBytes,
+// cutting only at line boundaries.
+func (s *lineStore) splitLeaf(leaf *lineNode) {
+	starts := leaf.lineStarts()
+	var pieces []*lineNode
+	first := 0
+	for first < leaf.lines {
+		last := first + 1
+		for last < leaf.lines && starts[last+1]-starts[first] <= leafTargetBytes {
+			last++
+		}
+		pieces = append(pieces, &lineNode{
+			data:  leaf.data[starts[first]:starts[last]:starts[last]],
+			lines: last - first,
+		})
+		first = last
+	}
+	if len(pieces) < 2 {
+		return
+	}
+	s.replaceChild(leaf, pieces)
+}
+
+// replaceChild puts nodes in place of old, splitting ancestors that end up
+// with more than maxChildren children.
+func (s *lineStore) replaceChild(old *lineNode, nodes []*lineNode) {
+	parent := old.parent
+	if parent == nil {
+		parent = &lineNode{lines: old.lines}
+		s.root = parent
+		parent.children = nodes
+	} else {
+		i := 0
+		for parent.children[i] != old {
+			i++
+		}
+		children := make([]*lineNode, 0, len(parent.children)+len(nodes)-1)
+		children = append(children, parent.children[:i]...)
+		children = append(children, nodes...)
+		children = append(children, parent.children[i+1:]...)
+		parent.children = children
+	}
+	for _, node := range nodes {
+		node.parent = parent
+	}
+	if len(parent.children) <= maxChildren {
+		return
+	}
+
+	var halves []*lineNode
+	for i := 0; i < len(parent.children); i += maxChildren / 2 {
+		end := min(i+maxChildren/2, len(parent.children))
+		half := &lineNode{children: parent.children[i:end:end]}
+		for _, child := range half.children {
+			child.parent = half
+			half.lines += child.lines
+		}
+		halves = append(halves, half)
+	}
+	s.replaceChild(parent, halves)
+}
+
+// eachLine calls fn with every line in order, without its newline. Unread
+// leaves are streamed from the file without being kept in memory. It stops
+// with errSourceChanged if the store is not intact.
+func (s *lineStore) eachLine(fn func(line []byte) error) error {
+	return s.eachLineFrom(0, false, func(_ int, line []byte) error {
+		return fn(line)
+	})
+}
+
+// eachLineFrom is eachLine starting at row, and going back to the first
+// line instead if backward. fn is also given the row of each line.
+func (s *lineStore) eachLineFrom(row int, backward bool, fn func(row int, line []byte) error) error {
+	type leafAt struct {
+		node  *lineNode
+		first int
+	}
+	var leaves []leafAt
+	first := 0
+	var walk func(n *lineNode)
+	walk = func(n *lineNode) {
+		if !n.isLeaf() {
+			for _, child := range n.children {
+				walk(child)
+			}
+			return
+		}
+		if backward && first <= row || !backward && first+n.lines > row {
+			leaves = append(leaves, leafAt{n, first})
+		}
+		first += n.lines
+	}
+	walk(s.root)
+	if backward {
+		slices.Reverse(leaves)
+	}
+
+	if err := s.intact(); err != nil {
+		return err
+	}
+	for _, leaf := range leaves {
+		data := leaf.node.load()
+		if err := s.intact(); err != nil {
+			return err
+		}
+		lines := bytes.SplitAfter(data, []byte{'\n'})
+		lines = lines[:len(lines)-1]
+		for i := range lines {
+			if backward {
+				i = len(lines) - 1 - i
+			}
+			r := leaf.first + i
+			if backward && r > row || !backward && r < row {
+				continue
+			}
+			if err := fn(r, lines[i][:len(lines[i])-1]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// readLineStore scans r, the contents of src from offset on, into unread
+// leaves. If src is nil the leaves keep their bytes instead. scan is called
+// for every line with whether it ended in a newline.
+func readLineStore(r io.Reader, src *lineSource, offset int64, scan func(line []byte, terminated bool)) (*lineStore, error) {
+	var leaves []*lineNode
+	reader := newLineReader(r)
+	leaf := &lineNode{src: src}
+	for {
+		line, terminated, err := reader.next()
+		if err != nil {
+			return nil, err
+		}
+		if line == nil {
+			break
+		}
+		scan(line, terminated)
+		if src == nil {
+			leaf.data = append(leaf.data, line...)
+			leaf.data = append(leaf.data, '\n')
+		}
+		leaf.lines++
+		leaf.size += len(line)
+		if terminated {
+			leaf.size++
+		} else {
+			leaf.unterminated = true
+		}
+		if leaf.size >= leafTargetBytes {
+			leaf.offset = offset
+			offset += int64(leaf.size)
+			leaves = append(leaves, leaf)
+			leaf = &lineNode{src: src}
+		}
+	}
+	if leaf.lines > 0 {
+		leaf.offset = offset
+		leaves = append(leaves, leaf)
+	}
+	if len(leaves) == 0 {
+		return newLineStore([][]byte{{}}), nil
+	}
+	return buildLineStore(leaves, src), nil
+}
+
+// lineReader splits a stream into lines of any length.
+type lineReader struct {
+	r    io.Reader
+	buf  []byte
+	head int
+	tail int
+	eof  bool
+}
+
+func newLineReader(r io.Reader) *lineReader {
+	return &lineReader{r: r, buf: make([]byte, 256*1024)}
+}
+
+// next returns the next line without its newline and whether it had one.
+// The slice is only valid until the following call. It returns nil at the
+// end of the input.
+func (lr *lineReader) next() ([]byte, bool, error) {
+	searched := lr.head
+	for {
+		if i := bytes.IndexByte(lr.buf[searched:lr.tail], '\n'); i >= 0 {
+			line := lr.buf[lr.head : searched+i]
+			lr.head = searched + i + 1
+			return line, true, nil
+		}
+		searched = lr.tail
+		if lr.eof {
+			if lr.head == lr.tail {
+				return nil, false, nil
+			}
+			line := lr.buf[lr.head:lr.tail]
+			lr.head = lr.tail
+			return line, false, nil
+		}
+		if lr.head > 0 {
+			copy(lr.buf, lr.buf[lr.head:lr.tail])
+			lr.tail -= lr.head
+			searched -= lr.head
+			lr.head = 0
+		}
+		if lr.tail == len(lr.buf) {
+			grown := make([]byte, 2*len(lr.buf))
+			copy(grown, lr.buf[:lr.tail])
+			lr.buf = grown
+		}
+		n, err := lr.r.Read(lr.buf[lr.tail:])
+		lr.tail += n
+		if err == io.EOF {
+			lr.eof = true
+		} else if err != nil {
+			return nil, false, err
+		}
+	}
+}
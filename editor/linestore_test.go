@@ -0,0 +1,362 @@
+package editor
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// checkTree fails the test if a node's line count is not the sum of its
+// children's, a child does not point back to its parent, or a node has
+// more than maxChildren children.
+func checkTree(t *testing.T, s *lineStore) {
+	t.Helper()
+	var check func(n *lineNode)
+	check = func(n *lineNode) {
+		if n.isLeaf() {
+			if n.data != nil && bytes.Count(n.data, []byte{'\n'}) != n.lines {
+				t.Fatalf("leaf holds %d lines, counted as %d", bytes.Count(n.data, []byte{'\n'}), n.lines)
+			}
+			return
+		}
+		if len(n.children) > maxChildren {
+			t.Fatalf("node has %d children, more than %d", len(n.children), maxChildren)
+		}
+		sum := 0
+		for _, child := range n.children {
+			if child.parent != n {
+				t.Fatal("child does not point to its parent")
+			}
+			check(child)
+			sum += child.lines
+		}
+		if sum != n.lines {
+			t.Fatalf("node counts %d lines, its children %d", n.lines, sum)
+		}
+	}
+	if s.root.parent != nil {
+		t.Fatal("root has a parent")
+	}
+	check(s.root)
+}
+
+func storeLines(t *testing.T, s *lineStore) []string {
+	t.Helper()
+	var lines []string
+	if err := s.eachLine(func(line []byte) error {
+		lines = append(lines, string(line))
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return lines
+}
+
+func checkLines(t *testing.T, s *lineStore, want []string) {
+	t.Helper()
+	checkTree(t, s)
+	if s.count() != len(want) {
+		t.Fatalf("count() = %d, want %d", s.count(), len(want))
+	}
+	got := storeLines(t, s)
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("line %d = %q, want %q", i, got[i], want[i])
+		}
+		if line := string(s.line(i)); line != want[i] {
+			t.Fatalf("line(%d) = %q, want %q", i, line, want[i])
+		}
+	}
+}
+
+func toBytes(lines []string) [][]byte {
+	b := make([][]byte, len(lines))
+	for i, line := range lines {
+		b[i] = []byte(line)
+	}
+	return b
+}
+
+func leafCount(n *lineNode) int {
+	if n.isLeaf() {
+		return 1
+	}
+	count := 0
+	for _, child := range n.children {
+		count += leafCount(child)
+	}
+	return count
+}
+
+func TestLineStoreSplitAtMaxChildren(t *testing.T) {
+	leaves := make([]*lineNode, maxChildren)
+	var want []string
+	for i := range leaves {
+		line := fmt.Sprintf("leaf %d", i)
+		leaves[i] = &lineNode{data: []byte(line + "\n"), lines: 1}
+		want = append(want, line)
+	}
+	s := buildLineStore(leaves, nil)
+	if len(s.root.children) != maxChildren {
+		t.Fatalf("root has %d children, want %d", len(s.root.children), maxChildren)
+	}
+	checkLines(t, s, want)
+
+	// Growing the first leaf past leafMaxBytes splits it, which gives the
+	// root one child too many.
+	long := strings.Repeat("x", leafTargetBytes)
+	s.replace(0, 0, toBytes([]string{long, long}))
+	want = append([]string{long, long}, want...)
+	for _, child := range s.root.children {
+		if child.isLeaf() || len(child.children) > maxChildren/2 {
+			t.Fatal("root was not split into nodes of up to half maxChildren leaves")
+		}
+	}
+	checkLines(t, s, want)
+}
+
+func TestLineStoreRemoveToEmpty(t *testing.T) {
+	var want []string
+	for i := range 5000 {
+		want = append(want, fmt.Sprintf("line %d %s", i, strings.Repeat("y", 40)))
+	}
+	s := newLineStore(toBytes(want))
+	if leafCount(s.root) < 2 {
+		t.Fatal("store was not split into leaves")
+	}
+	for s.count() > 0 {
+		row := s.count() / 2
+		count := min(s.count()-row, 777)
+		s.replace(row, count, nil)
+		want = append(want[:row], want[row+count:]...)
+		checkLines(t, s, want)
+	}
+	if !s.root.isLeaf() {
+		t.Fatal("empty store keeps inner nodes")
+	}
+	s.replace(0, 0, toBytes([]string{"again"}))
+	checkLines(t, s, []string{"again"})
+}
+
+func TestLineStoreReplaceAcrossLeaves(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	var want []string
+	for i := range 20000 {
+		want = append(want, fmt.Sprintf("line %d %s", i, strings.Repeat("z", rng.Intn(80))))
+	}
+	s := newLineStore(toBytes(want))
+	for i := range 300 {
+		row := rng.Intn(len(want))
+		count := min(rng.Intn(3000), len(want)-row)
+		var lines []string
+		for j := range rng.Intn(2000) {
+			lines = append(lines, fmt.Sprintf("edit %d.%d %s", i, j, strings.Repeat("w", rng.Intn(200))))
+		}
+		s.replace(row, count, toBytes(lines))
+		want = append(want[:row], append(lines, want[row+count:]...)...)
+		if len(want) == 0 {
+			want = []string{""}
+			s.replace(0, 0, [][]byte{{}})
+		}
+	}
+	checkLines(t, s, want)
+}
+
+func TestLineStoreLazyLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lines.txt")
+	var want []string
+	var sb strings.Builder
+	for i := range 50000 {
+		line := fmt.Sprintf("line %d", i)
+		want = append(want, line)
+		sb.WriteString(line + "\n")
+	}
+	if err := os.WriteFile(path, []byte(sb.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := &lineSource{file: file, size: info.Size(), modTime: info.ModTime()}
+	s, err := readLineStore(file, src, 0, func([]byte, bool) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.close()
+
+	unread := func() int {
+		count := 0
+		var walk func(n *lineNode)
+		walk = func(n *lineNode) {
+			for _, child := range n.children {
+				walk(child)
+			}
+			if n.isLeaf() && n.data == nil {
+				count++
+			}
+		}
+		walk(s.root)
+		return count
+	}
+	leaves := leafCount(s.root)
+	if leaves < 2 || unread() != leaves {
+		t.Fatalf("%d of %d leaves unread after scanning, want all", unread(), leaves)
+	}
+	if got := string(s.line(25000)); got != want[25000] {
+		t.Fatalf("line(25000) = %q, want %q", got, want[25000])
+	}
+	if unread() != leaves-1 {
+		t.Fatalf("reading a line read %d leaves, want 1", leaves-unread())
+	}
+	if got := storeLines(t, s); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatal("eachLine does not yield the file's lines")
+	}
+	if unread() != leaves-1 {
+		t.Fatal("eachLine kept leaves in memory")
+	}
+	if err := s.loadAll(); err != nil {
+		t.Fatal(err)
+	}
+	if unread() != 0 || s.src != nil {
+		t.Fatal("loadAll left leaves unread or the file open")
+	}
+	checkLines(t, s, want)
+}
+
+func BenchmarkOpenLargeFile(b *testing.B) {
+	b.Setenv("HOME", b.TempDir())
+	path := filepath.Join(b.TempDir(), "large.txt")
+	writeLargeFile(b, path, "line")
+	b.ResetTimer()
+	for range b.N {
+		buf, err := OpenBuffer(path)
+		if err != nil {
+			b.Fatal(err)
+		}
+		buf.Close()
+	}
+}
+
+func BenchmarkEditLargeFile(b *testing.B) {
+	b.Setenv("HOME", b.TempDir())
+	path := filepath.Join(b.TempDir(), "large.txt")
+	lines := writeLargeFile(b, path, "line")
+	buf, err := OpenBuffer(path)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer buf.Close()
+	rng := rand.New(rand.NewSource(1))
+	b.ResetTimer()
+	for range b.N {
+		buf.Row, buf.Column = rng.Intn(lines), 0
+		buf.InsertRune('x')
+		buf.InsertNewLine()
+		buf.DeleteLine()
+	}
+}
+
+func BenchmarkSaveLargeFile(b *testing.B) {
+	b.Setenv("HOME", b.TempDir())
+	path := filepath.Join(b.TempDir(), "large.txt")
+	lines := writeLargeFile(b, path, "line")
+	buf, err := OpenBuffer(path)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer buf.Close()
+	b.ResetTimer()
+	for i := range b.N {
+		buf.Row, buf.Column = i%lines, 0
+		buf.InsertRune('x')
+		if err := buf.Save(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// writeFileOfSize writes lines of the form "line N" to path until it holds
+// at least size bytes, streaming them so the file need not fit in memory.
+// It returns the number of lines written.
+func writeFileOfSize(t testing.TB, path string, size int64) int {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	var written int64
+	n := 0
+	for written < size {
+		count, _ := fmt.Fprintf(w, "line %d\n", n)
+		written += int64(count)
+		n++
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+// BenchmarkHugeFile opens, edits and saves a 500MB file. Writing the file
+// takes a while and needs the disk space, so it only runs with
+// GOEDITOR_BENCH_HUGE set and without -short.
+func BenchmarkHugeFile(b *testing.B) {
+	if testing.Short() || os.Getenv("GOEDITOR_BENCH_HUGE") == "" {
+		b.Skip("set GOEDITOR_BENCH_HUGE to run on a 500MB file")
+	}
+	b.Setenv("HOME", b.TempDir())
+	path := filepath.Join(b.TempDir(), "huge.txt")
+	lines := writeFileOfSize(b, path, 500<<20)
+
+	b.Run("Open", func(b *testing.B) {
+		for range b.N {
+			buf, err := OpenBuffer(path)
+			if err != nil {
+				b.Fatal(err)
+			}
+			buf.Close()
+		}
+	})
+	b.Run("Edit", func(b *testing.B) {
+		buf, err := OpenBuffer(path)
+		if err != nil {
+			b.Fatal(err)
+		}
+		defer buf.Close()
+		rng := rand.New(rand.NewSource(1))
+		b.ResetTimer()
+		for range b.N {
+			buf.Row, buf.Column = rng.Intn(lines), 0
+			buf.InsertRune('x')
+			buf.InsertNewLine()
+			buf.DeleteLine()
+		}
+	})
+	b.Run("Save", func(b *testing.B) {
+		buf, err := OpenBuffer(path)
+		if err != nil {
+			b.Fatal(err)
+		}
+		defer buf.Close()
+		b.ResetTimer()
+		for i := range b.N {
+			buf.Row, buf.Column = i*7919%lines, 0
+			buf.InsertRune('x')
+			if err := buf.Save(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
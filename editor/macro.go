@@ -0,0 +1,216 @@
+package editor
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// Macros are recorded into the named registers 'a' to 'z' as text, so the
+// same register can be pasted, edited and yanked back, then played again.
+// Characters stand for themselves and Enter for a line break. Every other
+// key is written as its name from keyName in angle brackets, as in <Esc> or
+// <Ctrl+W>, and '<' itself as <lt>. Text pasted through the terminal while
+// recording is kept between <Paste> and </Paste>.
+
+// validMacro reports whether name can be recorded into with m. Recording
+// into 'A' to 'Z' appends to 'a' to 'z'.
+func validMacro(name rune) bool {
+	return (name >= 'a' && name <= 'z') || (name >= 'A' && name <= 'Z')
+}
+
+// keyEvent returns the key event that keyName names name.
+func keyEvent(name string) (Event, bool) {
+	event := Event{Type: EventKey}
+	if rest, ok := strings.CutPrefix(name, "Alt+"); ok && rest != "" {
+		event.Mod = ModAlt
+		name = rest
+	}
+	for key, keyName := range keyNames {
+		if keyName == name {
+			event.Key = key
+			return event, true
+		}
+	}
+	ch, size := utf8.DecodeRuneInString(name)
+	if name == "" || size != len(name) {
+		return event, false
+	}
+	event.Ch = ch
+	return event, true
+}
+
+// macroText returns the text the events are kept as in a register.
+func macroText(events []Event) string {
+	var sb strings.Builder
+	for _, event := range events {
+		switch {
+		case event.Type == EventPaste:
+			sb.WriteString("<Paste>" + strings.ReplaceAll(event.Text, "<", "<lt>") + "</Paste>")
+		case event.Mod != 0:
+			sb.WriteString("<" + keyName(event) + ">")
+		case event.Key == KeyEnter:
+			sb.WriteByte('\n')
+		case event.Key == KeySpace || event.Ch == ' ':
+			sb.WriteByte(' ')
+		case event.Key == KeyTab:
+			sb.WriteByte('\t')
+		case event.Ch == '<':
+			sb.WriteString("<lt>")
+		case event.Ch != 0:
+			sb.WriteRune(event.Ch)
+		default:
+			sb.WriteString("<" + keyName(event) + ">")
+		}
+	}
+	return sb.String()
+}
+
+// macroEvents returns the events that text, as macroText writes it, stands
+// for. A '<' that does not start the name of a special key is the
+// character itself.
+func macroEvents(text string) []Event {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	var events []Event
+	for text != "" {
+		if rest, ok := strings.CutPrefix(text, "<Paste>"); ok {
+			pasted, after, _ := strings.Cut(rest, "</Paste>")
+			events = append(events, Event{Type: EventPaste, Text: strings.ReplaceAll(pasted, "<lt>", "<")})
+			text = after
+			continue
+		}
+		if name, after, ok := strings.Cut(text[1:], ">"); text[0] == '<' && ok {
+			if name == "lt" {
+				events = append(events, Event{Type: EventKey, Ch: '<'})
+				text = after
+				continue
+			}
+			if event, ok := keyEvent(name); ok && (event.Key != 0 || event.Mod != 0) {
+				events = append(events, event)
+				text = after
+				continue
+			}
+		}
+		ch, size := utf8.DecodeRuneInString(text)
+		text = text[size:]
+		event := Event{Type: EventKey, Ch: ch}
+		switch ch {
+		case '\n':
+			event = Event{Type: EventKey, Key: KeyEnter}
+		case ' ':
+			event = Event{Type: EventKey, Key: KeySpace}
+		case '\t':
+			event = Event{Type: EventKey, Key: KeyTab}
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+// recordMacroAction starts recording keys into the register named by the
+// next key, or stops the recording in progress.
+func (e *Editor) recordMacroAction() {
+	if e.recordingMacro == 0 {
+		e.choosingMacro = "record"
+		return
+	}
+	// The keys of this command stop the recording and are not part of it.
+	keys := e.recordedKeys[:max(len(e.recordedKeys)-len(e.typedKeys), 0)]
+	name := e.recordingMacro
+	text := copiedText{kind: EditVisual, lines: splitRuneLines(macroText(keys))}
+	if e.appendingMacro {
+		text = e.registers[name].appendText(text)
+	}
+	e.recordingMacro, e.recordedKeys, e.appendingMacro = 0, nil, false
+	e.registers[name] = text
+	if err := e.registers.save(); err != nil {
+		e.setMessage("Error saving registers: " + err.Error())
+		return
+	}
+	e.setMessage(fmt.Sprintf("Recorded @%c (%s)", name, plural(len(keys), "key", "keys")))
+}
+
+// playMacroAction plays the register named by the next key, as many times
+// as the count typed before it.
+func (e *Editor) playMacroAction() {
+	e.choosingMacro = "play"
+	e.macroCount = max(e.count, 1)
+}
+
+// chooseMacro starts recording into or playing the register name, typed
+// after m or @. Playing '@' plays the register played last.
+func (e *Editor) chooseMacro(name rune) {
+	choice := e.choosingMacro
+	e.choosingMacro = ""
+	if choice == "play" && name == '@' {
+		if e.lastMacro == 0 {
+			e.setMessage("No macro played yet")
+			return
+		}
+		name = e.lastMacro
+	}
+	if choice == "record" {
+		if !validMacro(name) {
+			return
+		}
+		e.recordingMacro = name
+		if name >= 'A' && name <= 'Z' {
+			e.recordingMacro += 'a' - 'A'
+			e.appendingMacro = true
+		}
+		return
+	}
+	if !validRegister(name) {
+		return
+	}
+	if name >= 'A' && name <= 'Z' {
+		name += 'a' - 'A'
+	}
+	e.lastMacro = name
+	e.playMacro(name, e.macroCount)
+}
+
+// playMacro feeds the keys held by the register name to the editor count
+// times. A macro that plays itself, directly or through other macros, stops
+// all of them instead of repeating forever.
+func (e *Editor) playMacro(name rune, count int) {
+	text, err := e.registerText(name)
+	if err != nil {
+		e.setMessage(fmt.Sprintf("Macro @%c is empty", name))
+		return
+	}
+	if slices.Contains(e.playingMacros, name) {
+		e.macroFailed = fmt.Sprintf("Macro @%c plays itself", name)
+		return
+	}
+	keys := macroEvents(text.String())
+	e.playingMacros = append(e.playingMacros, name)
+	defer func() {
+		e.playingMacros = e.playingMacros[:len(e.playingMacros)-1]
+		if len(e.playingMacros) == 0 && e.macroFailed != "" {
+			e.setMessage(e.macroFailed)
+			e.macroFailed = ""
+		}
+	}()
+	for range count {
+		for _, event := range keys {
+			if e.macroFailed != "" {
+				return
+			}
+			e.HandleEvent(event)
+		}
+	}
+}
+
+// recordEvent adds a key typed or text pasted by the user to the macro
+// being recorded. Events fed by a playing macro are not recorded again.
+func (e *Editor) recordEvent(event Event) {
+	if e.recordingMacro == 0 || len(e.playingMacros) > 0 {
+		return
+	}
+	if event.Type != EventPaste && keyName(event) == "" {
+		return
+	}
+	e.recordedKeys = append(e.recordedKeys, event)
+}
@@ -0,0 +1,80 @@
+package editor
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func typeKeys(e *Editor, keys string) {
+	for _, ch := range keys {
+		e.HandleEvent(Event{Type: EventKey, Ch: ch})
+	}
+}
+
+func TestMacroText(t *testing.T) {
+	events := []Event{
+		{Type: EventKey, Ch: 'i'},
+		{Type: EventKey, Ch: '<'},
+		{Type: EventKey, Key: KeySpace},
+		{Type: EventPaste, Text: "a</Paste>\nb"},
+		{Type: EventKey, Key: KeyEnter},
+		{Type: EventKey, Key: KeyEsc},
+		{Type: EventKey, Key: KeyCtrlW},
+		{Type: EventKey, Ch: 'x', Mod: ModAlt},
+	}
+	text := macroText(events)
+	if want := "i<lt> <Paste>a<lt>/Paste>\nb</Paste>\n<Esc><Ctrl+W><Alt+x>"; text != want {
+		t.Fatalf("macroText = %q, want %q", text, want)
+	}
+	if got := macroEvents(text); !reflect.DeepEqual(got, events) {
+		t.Errorf("macroEvents(%q) = %v, want %v", text, got, events)
+	}
+	// Text that was not recorded plays as the characters it is made of.
+	want := []Event{{Type: EventKey, Ch: 'a'}, {Type: EventKey, Ch: '<'}, {Type: EventKey, Ch: 'b'}, {Type: EventKey, Ch: '>'}}
+	if got := macroEvents("a<b>"); !reflect.DeepEqual(got, want) {
+		t.Errorf("macroEvents(%q) = %v, want %v", "a<b>", got, want)
+	}
+}
+
+func TestMacroRecordsPaste(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	e := NewEditor(NewMemoryScreen(80, 8))
+	typeKeys(e, "maix")
+	e.HandleEvent(Event{Type: EventPaste, Text: "y<z"})
+	e.HandleEvent(Event{Type: EventKey, Key: KeyEsc})
+	typeKeys(e, "m")
+
+	text, _ := e.registers.get('a')
+	if got, want := text.String(), "ix<Paste>y<lt>z</Paste><Esc>"; got != want {
+		t.Errorf("register a = %q, want %q", got, want)
+	}
+	if got := bufferText(e.Buffer()); got != "xy<z" {
+		t.Errorf("buffer = %q, want %q", got, "xy<z")
+	}
+	checkMode(t, filepath.Join(home, ".gocodeeditor"), os.ModeDir|0700)
+	checkMode(t, filepath.Join(home, ".gocodeeditor", "registers.json"), 0600)
+
+	// The register is saved, so a new editor can play it.
+	e = NewEditor(NewMemoryScreen(80, 8))
+	typeKeys(e, "@a")
+	if got := bufferText(e.Buffer()); got != "xy<z" {
+		t.Errorf("after @a, buffer = %q, want %q", got, "xy<z")
+	}
+}
+
+func TestMacroPlaysCopiedText(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Chdir(t.TempDir())
+	if err := os.WriteFile("keys.txt", []byte("ihello\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	e := NewEditor(NewMemoryScreen(80, 8))
+	e.Open("keys.txt")
+	typeKeys(e, `"ayy@a`)
+	if got, want := bufferText(e.Buffer()), "hello\nihello"; got != want {
+		t.Errorf("buffer = %q, want %q", got, want)
+	}
+}
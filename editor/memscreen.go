@@ -0,0 +1,124 @@
+package editor
+
+import (
+	"strings"
+	"time"
+
+	"github.com/mattn/go-runewidth"
+)
+
+// Cell is a single character cell recorded by a MemoryScreen.
+type Cell struct {
+	Ch rune
+	Fg Attribute
+	Bg Attribute
+}
+
+// MemoryScreen is a Screen that keeps its cells in memory instead of
+// drawing to a terminal. Events queued in Events are returned by PollEvent
+// in order, which lets the editor be rendered and driven without termbox.
+type MemoryScreen struct {
+	Width   int
+	Height  int
+	Cells   []Cell
+	CursorX int
+	CursorY int
+	Events  []Event
+	Closed  bool
+
+	// Escapes records the sequences sent with WriteEscape.
+	Escapes []string
+}
+
+// NewMemoryScreen returns a blank screen of the given size.
+func NewMemoryScreen(width, height int) *MemoryScreen {
+	s := &MemoryScreen{Width: width, Height: height}
+	s.Clear()
+	return s
+}
+
+func (s *MemoryScreen) Size() (int, int) {
+	return s.Width, s.Height
+}
+
+func (s *MemoryScreen) SetCell(x, y int, ch rune, fg, bg Attribute) {
+	if x < 0 || y < 0 || x >= s.Width || y >= s.Height {
+		return
+	}
+	s.Cells[y*s.Width+x] = Cell{Ch: ch, Fg: fg, Bg: bg}
+	if runewidth.RuneWidth(ch) == 2 && x+1 < s.Width {
+		s.Cells[y*s.Width+x+1] = Cell{Fg: fg, Bg: bg}
+	}
+}
+
+func (s *MemoryScreen) SetCursor(x, y int) {
+	s.CursorX, s.CursorY = x, y
+}
+
+func (s *MemoryScreen) Clear() {
+	s.Cells = make([]Cell, s.Width*s.Height)
+	for i := range s.Cells {
+		s.Cells[i] = Cell{Ch: ' ', Fg: ColorDefault, Bg: ColorDefault}
+	}
+}
+
+func (s *MemoryScreen) Present() {}
+
+// PollEvent pops the next queued event. An empty queue yields a zero Event.
+func (s *MemoryScreen) PollEvent() Event {
+	if len(s.Events) == 0 {
+		return Event{}
+	}
+	event := s.Events[0]
+	s.Events = s.Events[1:]
+	return event
+}
+
+// PeekEvent pops the next queued event without waiting, reporting false if
+// the queue is empty.
+func (s *MemoryScreen) PeekEvent(timeout time.Duration) (Event, bool) {
+	if len(s.Events) == 0 {
+		return Event{}, false
+	}
+	return s.PollEvent(), true
+}
+
+func (s *MemoryScreen) Close() {
+	s.Closed = true
+}
+
+func (s *MemoryScreen) WriteEscape(seq string) {
+	s.Escapes = append(s.Escapes, seq)
+}
+
+// CellAt returns the cell at x, y.
+func (s *MemoryScreen) CellAt(x, y int) Cell {
+	if x < 0 || y < 0 || x >= s.Width || y >= s.Height {
+		return Cell{}
+	}
+	return s.Cells[y*s.Width+x]
+}
+
+// Line returns row y as text with trailing spaces removed. The cell covered
+// by the second half of a wide character is skipped.
+func (s *MemoryScreen) Line(y int) string {
+	var sb strings.Builder
+	for x := 0; x < s.Width; x++ {
+		ch := s.CellAt(x, y).Ch
+		if ch == 0 {
+			continue
+		}
+		sb.WriteRune(ch)
+	}
+	return strings.TrimRight(sb.String(), " ")
+}
+
+// String returns the whole screen as newline separated rows, suitable for
+// comparing against golden output.
+func (s *MemoryScreen) String() string {
+	lines := make([]string, s.Height)
+	for y := range lines {
+		lines[y] = s.Line(y)
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,230 @@
+package editor
+
+import "unicode"
+
+// motion is where a cursor motion goes, and how an operator given with it
+// treats the text it moves over: whole lines if linewise, and otherwise
+// the characters up to the target, including the one at the target if
+// inclusive.
+type motion struct {
+	row, column int
+	linewise    bool
+	inclusive   bool
+}
+
+// textPos is a position in a buffer. A column at the end of a line stands
+// for its line break.
+type textPos struct {
+	row, column int
+}
+
+func (p textPos) before(q textPos) bool {
+	return p.row < q.row || (p.row == q.row && p.column < q.column)
+}
+
+// nextPos returns the position after p, or false at the end of the buffer.
+func (b *Buffer) nextPos(p textPos) (textPos, bool) {
+	if p.column < len(b.Line(p.row)) {
+		return textPos{p.row, p.column + 1}, true
+	}
+	if p.row < b.LineCount()-1 {
+		return textPos{p.row + 1, 0}, true
+	}
+	return p, false
+}
+
+// prevPos returns the position before p, or false at the start of the
+// buffer.
+func (b *Buffer) prevPos(p textPos) (textPos, bool) {
+	if p.column > 0 {
+		return textPos{p.row, p.column - 1}, true
+	}
+	if p.row > 0 {
+		return textPos{p.row - 1, len(b.Line(p.row - 1))}, true
+	}
+	return p, false
+}
+
+// Character classes for word motions. A word is a run of keyword
+// characters or a run of other characters that are not blank.
+const (
+	blankClass = iota
+	punctuationClass
+	keywordClass
+)
+
+func (b *Buffer) charClass(p textPos) int {
+	line := b.Line(p.row)
+	if p.column >= len(line) {
+		return blankClass
+	}
+	switch r := line[p.column]; {
+	case unicode.IsSpace(r):
+		return blankClass
+	case r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r):
+		return keywordClass
+	}
+	return punctuationClass
+}
+
+func (b *Buffer) emptyLine(row int) bool {
+	return len(b.Line(row)) == 0
+}
+
+// nextWordStart returns the start of the word after p. An empty line counts
+// as a word.
+func (b *Buffer) nextWordStart(p textPos) textPos {
+	start := p
+	if class := b.charClass(p); class != blankClass {
+		for b.charClass(p) == class {
+			next, ok := b.nextPos(p)
+			if !ok {
+				return p
+			}
+			p = next
+		}
+	}
+	for b.charClass(p) == blankClass && (p == start || !b.emptyLine(p.row)) {
+		next, ok := b.nextPos(p)
+		if !ok {
+			return p
+		}
+		p = next
+	}
+	return p
+}
+
+// prevWordStart returns the start of the word before p.
+func (b *Buffer) prevWordStart(p textPos) textPos {
+	p, ok := b.prevPos(p)
+	if !ok {
+		return p
+	}
+	for b.charClass(p) == blankClass && !(p.column == 0 && b.emptyLine(p.row)) {
+		if p, ok = b.prevPos(p); !ok {
+			return p
+		}
+	}
+	class := b.charClass(p)
+	for p.column > 0 && b.charClass(textPos{p.row, p.column - 1}) == class && class != blankClass {
+		p.column--
+	}
+	return p
+}
+
+// wordEnd returns the last character of the word ending after p.
+func (b *Buffer) wordEnd(p textPos) textPos {
+	p, ok := b.nextPos(p)
+	if !ok {
+		return p
+	}
+	for b.charClass(p) == blankClass {
+		if p, ok = b.nextPos(p); !ok {
+			return p
+		}
+	}
+	class := b.charClass(p)
+	for b.charClass(textPos{p.row, p.column + 1}) == class {
+		p.column++
+	}
+	return p
+}
+
+// nextParagraph returns the row of the empty line after the paragraph at or
+// after row, or the last row if there is none.
+func (b *Buffer) nextParagraph(row int) int {
+	last := b.LineCount() - 1
+	for row < last && b.emptyLine(row) {
+		row++
+	}
+	for row < last && !b.emptyLine(row) {
+		row++
+	}
+	return row
+}
+
+// prevParagraph returns the row of the empty line before the paragraph at
+// or before row, or the first row if there is none.
+func (b *Buffer) prevParagraph(row int) int {
+	for row > 0 && b.emptyLine(row) {
+		row--
+	}
+	for row > 0 && !b.emptyLine(row) {
+		row--
+	}
+	return row
+}
+
+// firstNonBlank returns the column of the first character of row that is
+// not blank, or the end of the line.
+func (b *Buffer) firstNonBlank(row int) int {
+	line := b.Line(row)
+	for i, r := range line {
+		if !unicode.IsSpace(r) {
+			return i
+		}
+	}
+	return len(line)
+}
+
+// findInLine returns the column of the count'th ch after column, or before
+// it if backward, on row.
+func (b *Buffer) findInLine(row, column int, ch rune, backward bool, count int) (int, bool) {
+	line := b.Line(row)
+	step := 1
+	if backward {
+		step = -1
+	}
+	for i := column + step; i >= 0 && i < len(line); i += step {
+		if line[i] == ch {
+			if count--; count == 0 {
+				return i, true
+			}
+		}
+	}
+	return 0, false
+}
+
+var bracketPairs = map[rune]rune{'(': ')', '[': ']', '{': '}', ')': '(', ']': '[', '}': '{'}
+
+// matchingBracket finds the first bracket at or after p on its line and
+// returns the position of the bracket that matches it.
+func (b *Buffer) matchingBracket(p textPos) (textPos, bool) {
+	line := b.Line(p.row)
+	for p.column < len(line) {
+		if _, ok := bracketPairs[line[p.column]]; ok {
+			break
+		}
+		p.column++
+	}
+	if p.column == len(line) {
+		return p, false
+	}
+	open := line[p.column]
+	closing := bracketPairs[open]
+	move := b.nextPos
+	if open == ')' || open == ']' || open == '}' {
+		move = b.prevPos
+	}
+	depth := 0
+	for {
+		next, ok := move(p)
+		if !ok {
+			return p, false
+		}
+		p = next
+		line := b.Line(p.row)
+		if p.column >= len(line) {
+			continue
+		}
+		switch line[p.column] {
+		case open:
+			depth++
+		case closing:
+			if depth == 0 {
+				return p, true
+			}
+			depth--
+		}
+	}
+}
@@ -0,0 +1,299 @@
+package editor
+
+import "strings"
+
+// characterFind is a search for a character on the cursor's line made with
+// f, F, t or T: backward for F and T, and stopping next to the character
+// for t and T.
+type characterFind struct {
+	ch       rune
+	backward bool
+	till     bool
+}
+
+// countKeypress adds a digit typed before a command to its count. A 0
+// that does not follow another digit is a motion instead.
+func (e *Editor) countKeypress(keyEvent Event) bool {
+	ch := keyEvent.Ch
+	if len(e.pendingKeys) > 0 || keyEvent.Mod != 0 || ch < '0' || ch > '9' || (ch == '0' && e.count == 0) {
+		return false
+	}
+	e.count = e.count*10 + int(ch-'0')
+	return true
+}
+
+// moveAction returns the run function of the motion name.
+func moveAction(name string) func(e *Editor) {
+	return func(e *Editor) { e.moveBy(name) }
+}
+
+// operatorAction returns the run function of the operator name, which
+// waits for a motion, or works on whole lines when typed twice.
+func operatorAction(name string) func(e *Editor) {
+	return func(e *Editor) {
+		switch e.operator {
+		case "":
+			e.operator, e.operatorCount, e.count = name, e.count, 0
+		case name:
+			e.moveBy(name)
+		default:
+			e.cancelCommand()
+		}
+	}
+}
+
+// findCharAction returns the run function of a character find, which
+// waits for the character to find.
+func findCharAction(find characterFind) func(e *Editor) {
+	return func(e *Editor) {
+		e.findingChar = true
+		e.pendingFind = find
+	}
+}
+
+func (e *Editor) findCharacter(keyEvent Event) {
+	e.findingChar = false
+	ch := keyEvent.Ch
+	switch keyEvent.Key {
+	case KeySpace:
+		ch = ' '
+	case KeyTab:
+		ch = '\t'
+	}
+	if ch == 0 {
+		e.cancelCommand()
+		return
+	}
+	e.lastFind = e.pendingFind
+	e.lastFind.ch = ch
+	e.moveBy("find")
+}
+
+// cancelCommand forgets a count, operator or unfinished key sequence typed
+// so far.
+func (e *Editor) cancelCommand() {
+	e.count, e.operatorCount, e.operator = 0, 0, ""
+	e.findingChar, e.pendingKeys = false, nil
+}
+
+// pendingCommand returns the keys typed of an unfinished command, to show
+// in the status bar.
+func (e *Editor) pendingCommand() string {
+	return strings.Join(e.typedKeys, "")
+}
+
+// moveBy makes the motion name, repeated by the count typed before it, and
+// applies the pending operator to the text it moves over. The motion named
+// after the operator itself works on whole lines, as dd does.
+func (e *Editor) moveBy(name string) {
+	b := e.Buffer()
+	counted := e.count > 0 || e.operatorCount > 0
+	count := max(e.count, 1) * max(e.operatorCount, 1)
+	operator := e.operator
+	e.cancelCommand()
+
+	var m motion
+	var ok bool
+	if name == operator {
+		m, ok = motion{row: min(b.Row+count-1, b.LineCount()-1), linewise: true}, true
+	} else {
+		m, ok = e.motionFor(name, count, counted, operator)
+	}
+	if !ok {
+		return
+	}
+	if operator != "" {
+		e.applyOperator(operator, m)
+		return
+	}
+	b.Row, b.Column = m.row, m.column
+	b.clampCursor()
+}
+
+// motionFor returns where the motion name goes from the cursor when
+// repeated count times, or false if it cannot be made. Motions behave a
+// little differently with some operators, as they do in vim: cw changes to
+// the end of the word, and dw on the last word of a line stops at its end.
+func (e *Editor) motionFor(name string, count int, counted bool, operator string) (motion, bool) {
+	b := e.Buffer()
+	p := textPos{b.Row, b.Column}
+	last := b.LineCount() - 1
+
+	switch name {
+	case "left", "right":
+		// Only insert mode wraps to the previous or next line; elsewhere
+		// the cursor stays on its line, as h and l do in vim, so dl on an
+		// empty line deletes nothing.
+		step := b.prevPos
+		if name == "right" {
+			step = b.nextPos
+		}
+		for i := 0; i < count; i++ {
+			next, _ := step(p)
+			if next.row != p.row && e.editMode != EditInsert {
+				break
+			}
+			p = next
+		}
+		return motion{row: p.row, column: p.column}, true
+	case "up", "page-up", "down", "page-down":
+		lines := count
+		if strings.HasPrefix(name, "page-") {
+			lines *= max(e.window.height/4, 1)
+		}
+		if strings.HasSuffix(name, "up") {
+			lines = -lines
+		}
+		return motion{row: min(max(p.row+lines, 0), last), column: p.column, linewise: true}, true
+	case "word-forward":
+		if operator == "change" && b.charClass(p) != blankClass {
+			class := b.charClass(p)
+			for b.charClass(textPos{p.row, p.column + 1}) == class {
+				p.column++
+			}
+			for i := 1; i < count; i++ {
+				p = b.wordEnd(p)
+			}
+			return motion{row: p.row, column: p.column, inclusive: true}, true
+		}
+		for i := 0; i < count; i++ {
+			next := b.nextWordStart(p)
+			if operator != "" && i == count-1 && next.row > p.row {
+				next = textPos{p.row, len(b.Line(p.row))}
+			}
+			p = next
+		}
+		return motion{row: p.row, column: p.column}, true
+	case "word-backward":
+		for i := 0; i < count; i++ {
+			p = b.prevWordStart(p)
+		}
+		return motion{row: p.row, column: p.column}, true
+	case "word-end":
+		for i := 0; i < count; i++ {
+			p = b.wordEnd(p)
+		}
+		return motion{row: p.row, column: p.column, inclusive: true}, true
+	case "paragraph-forward":
+		for i := 0; i < count; i++ {
+			p.row = b.nextParagraph(p.row)
+		}
+		p.column = 0
+		if p.row == last {
+			p.column = len(b.Line(last))
+		}
+		return motion{row: p.row, column: p.column}, true
+	case "paragraph-backward":
+		for i := 0; i < count; i++ {
+			p.row = b.prevParagraph(p.row)
+		}
+		return motion{row: p.row, column: 0}, true
+	case "first-line", "last-line":
+		row := last
+		if name == "first-line" {
+			row = 0
+		}
+		if counted {
+			row = min(count-1, last)
+		}
+		return motion{row: row, column: b.firstNonBlank(row), linewise: true}, true
+	case "line-start":
+		return motion{row: p.row, column: 0}, true
+	case "first-character":
+		return motion{row: p.row, column: b.firstNonBlank(p.row)}, true
+	case "line-end":
+		row := min(p.row+count-1, last)
+		return motion{row: row, column: len(b.Line(row))}, true
+	case "matching-bracket":
+		match, ok := b.matchingBracket(p)
+		return motion{row: match.row, column: match.column, inclusive: true}, ok
+	case "find", "repeat-find", "repeat-find-reverse":
+		find := e.lastFind
+		if find.ch == 0 {
+			return motion{}, false
+		}
+		if name == "repeat-find-reverse" {
+			find.backward = !find.backward
+		}
+		return e.findMotion(find, count, name != "find")
+	}
+	return motion{}, false
+}
+
+// findMotion returns the motion to the count'th character find on the
+// cursor's line. Repeating a t or T skips the character next to the
+// cursor, which it would otherwise find again.
+func (e *Editor) findMotion(find characterFind, count int, repeat bool) (motion, bool) {
+	b := e.Buffer()
+	step := 1
+	if find.backward {
+		step = -1
+	}
+	from := b.Column
+	if repeat && find.till {
+		from += step
+	}
+	column, ok := b.findInLine(b.Row, from, find.ch, find.backward, count)
+	if !ok {
+		return motion{}, false
+	}
+	if find.till {
+		column -= step
+	}
+	return motion{row: b.Row, column: column, inclusive: !find.backward}, true
+}
+
+// applyOperator deletes, changes or copies the text between the cursor and
+// the end of m by selecting it and using the visual mode commands. The
+// selection made for it is not remembered for '< and '>.
+func (e *Editor) applyOperator(operator string, m motion) {
+	b := e.Buffer()
+	start, end := textPos{b.Row, b.Column}, textPos{m.row, m.column}
+	if end.before(start) {
+		start, end = end, start
+	}
+	column := b.Column
+
+	// An exclusive motion leaves out the character it ends on. One that
+	// crosses lines and ends at the start of a later one, as w, } and /
+	// can, leaves out that line break too, and works on whole lines if it
+	// started before the first character of its line.
+	kind := EditVisual
+	switch {
+	case m.linewise:
+		kind = EditVisualLine
+	case m.inclusive:
+	case end.column == 0 && end.row > start.row && start.column <= b.firstNonBlank(start.row):
+		kind = EditVisualLine
+		end.row--
+	case end.column == 0 && end.row > start.row:
+		end = textPos{end.row - 1, len(b.Line(end.row-1)) - 1}
+	default:
+		end.column--
+	}
+	if kind == EditVisual && end.before(start) {
+		if operator == "change" {
+			e.editMode = EditInsert
+			b.BeginUndoGroup()
+		}
+		return
+	}
+
+	lastSelection, hasLastSelection := e.lastSelection, e.hasLastSelection
+	e.anchorRow, e.anchorColumn = end.row, end.column
+	b.Row, b.Column = start.row, start.column
+	e.editMode = kind
+	switch operator {
+	case "delete":
+		e.deleteSelection()
+	case "change":
+		e.changeSelection()
+	case "copy":
+		e.copySelection()
+		if kind == EditVisualLine {
+			b.Column = column
+			b.clampCursor()
+		}
+	}
+	e.lastSelection, e.hasLastSelection = lastSelection, hasLastSelection
+}
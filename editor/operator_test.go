@@ -0,0 +1,102 @@
+package editor
+
+import "testing"
+
+func TestLeftRightStayOnLine(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	e := NewEditor(NewMemoryScreen(80, 8))
+	b := newTestBuffer("ab\n\ncd")
+	e.buffers, e.window.buffer = []*Buffer{b}, b
+	right := Event{Type: EventKey, Key: KeyArrowRight}
+	left := Event{Type: EventKey, Key: KeyArrowLeft}
+
+	typeKeys(e, "5")
+	e.HandleEvent(right)
+	if b.Row != 0 || b.Column != 2 {
+		t.Errorf("after 5 Right, cursor at %d:%d, want 0:2", b.Row, b.Column)
+	}
+	b.Row, b.Column = 1, 0
+	typeKeys(e, "d")
+	e.HandleEvent(right)
+	if got, want := bufferText(b), "ab\n\ncd"; got != want {
+		t.Errorf("after d Right on an empty line, buffer = %q, want %q", got, want)
+	}
+	typeKeys(e, "d")
+	e.HandleEvent(left)
+	if got, want := bufferText(b), "ab\n\ncd"; got != want {
+		t.Errorf("after d Left on an empty line, buffer = %q, want %q", got, want)
+	}
+
+	// Insert mode still wraps.
+	typeKeys(e, "i")
+	e.HandleEvent(right)
+	if b.Row != 2 || b.Column != 0 {
+		t.Errorf("after Right in insert mode, cursor at %d:%d, want 2:0", b.Row, b.Column)
+	}
+}
+
+func TestMotionsAndOperators(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	useSettings(t, Settings{TabSize: 4, Theme: "one-dark", Clipboard: "none"})
+	const text = "one two three\nfour (five) six\n\nseven"
+	tests := []struct {
+		at       textPos
+		keys     string
+		want     string
+		cursor   textPos
+		register string
+	}{
+		{textPos{0, 0}, "e", text, textPos{0, 2}, ""},
+		{textPos{0, 0}, "2w", text, textPos{0, 8}, ""},
+		{textPos{0, 8}, "b", text, textPos{0, 4}, ""},
+		{textPos{0, 0}, "}", text, textPos{2, 0}, ""},
+		{textPos{0, 0}, "G", text, textPos{3, 0}, ""},
+		{textPos{3, 2}, "gg", text, textPos{0, 0}, ""},
+		{textPos{0, 0}, "2G", text, textPos{1, 0}, ""},
+		{textPos{0, 4}, "$", text, textPos{0, 13}, ""},
+		{textPos{1, 7}, "^", text, textPos{1, 0}, ""},
+		{textPos{0, 0}, "fe", text, textPos{0, 2}, ""},
+		{textPos{0, 0}, "fe;", text, textPos{0, 11}, ""},
+		{textPos{0, 0}, "te;", text, textPos{0, 10}, ""},
+		{textPos{0, 12}, "Fo;,", text, textPos{0, 6}, ""},
+		{textPos{0, 0}, "3fe", text, textPos{0, 12}, ""},
+		{textPos{1, 5}, "%", text, textPos{1, 10}, ""},
+		{textPos{1, 10}, "%", text, textPos{1, 5}, ""},
+
+		{textPos{0, 0}, "dw", "two three\nfour (five) six\n\nseven", textPos{0, 0}, "one "},
+		{textPos{0, 0}, "d2w", "three\nfour (five) six\n\nseven", textPos{0, 0}, "one two "},
+		{textPos{0, 0}, "2dw", "three\nfour (five) six\n\nseven", textPos{0, 0}, "one two "},
+		// dw on the last word of a line stops at its end.
+		{textPos{0, 8}, "dw", "one two \nfour (five) six\n\nseven", textPos{0, 8}, "three"},
+		{textPos{0, 0}, "cwX", "X two three\nfour (five) six\n\nseven", textPos{0, 1}, "one"},
+		{textPos{0, 4}, "d$", "one \nfour (five) six\n\nseven", textPos{0, 4}, "two three"},
+		{textPos{0, 0}, "dtt", "two three\nfour (five) six\n\nseven", textPos{0, 0}, "one "},
+		{textPos{0, 0}, "dft", "wo three\nfour (five) six\n\nseven", textPos{0, 0}, "one t"},
+		{textPos{1, 5}, "d%", "one two three\nfour  six\n\nseven", textPos{1, 5}, "(five)"},
+		{textPos{0, 4}, "d}", "one \n\nseven", textPos{0, 4}, "two three\nfour (five) six"},
+		{textPos{0, 0}, "dd", "four (five) six\n\nseven", textPos{0, 0}, "one two three\n"},
+		{textPos{0, 0}, "3dd", "seven", textPos{0, 0}, "one two three\nfour (five) six\n\n"},
+		{textPos{1, 0}, "dG", "one two three", textPos{0, 0}, "four (five) six\n\nseven\n"},
+		{textPos{0, 4}, "yw", text, textPos{0, 4}, "two "},
+		{textPos{0, 4}, "2yy", text, textPos{0, 4}, "one two three\nfour (five) six\n"},
+		// An operator with a motion that goes nowhere does nothing.
+		{textPos{0, 0}, "dfz", text, textPos{0, 0}, ""},
+	}
+	for _, tt := range tests {
+		e := NewEditor(NewMemoryScreen(80, 8))
+		b := newTestBuffer(text)
+		e.buffers, e.window.buffer = []*Buffer{b}, b
+		b.Row, b.Column = tt.at.row, tt.at.column
+		typeKeys(e, tt.keys)
+		pressKey(e, KeyEsc)
+		if got := bufferText(b); got != tt.want {
+			t.Errorf("%q at %v: buffer = %q, want %q", tt.keys, tt.at, got, tt.want)
+		}
+		if got := (textPos{b.Row, b.Column}); got != tt.cursor {
+			t.Errorf("%q at %v: cursor at %v, want %v", tt.keys, tt.at, got, tt.cursor)
+		}
+		if text, _ := e.registers.get(unnamedRegister); text.String() != tt.register {
+			t.Errorf("%q at %v: register holds %q, want %q", tt.keys, tt.at, text.String(), tt.register)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package editor
+
+import (
+	"strings"
+	"time"
+)
+
+// Bracketed paste mode makes the terminal surround pasted text with these
+// sequences, so it can be told apart from typing. Terminal libraries that
+// do not know them deliver Esc followed by the characters of the rest.
+const (
+	pasteModeOn  = "\x1b[?2004h"
+	pasteModeOff = "\x1b[?2004l"
+	pasteStart   = "[200~"
+	pasteEnd     = "[201~"
+)
+
+// pasteTimeout is how long the rest of a paste is waited for once it has
+// started.
+const pasteTimeout = time.Second
+
+// pasteReader turns the key events of a bracketed paste into a single
+// EventPaste. next reads the underlying events, blocking if timeout is
+// negative.
+type pasteReader struct {
+	next    func(timeout time.Duration) (Event, bool)
+	pending []Event
+}
+
+func (r *pasteReader) read(timeout time.Duration) (Event, bool) {
+	event, ok := r.take(timeout)
+	if !ok || event.Type != EventKey || event.Key != KeyEsc || !r.expect(pasteStart) {
+		return event, ok
+	}
+
+	var text strings.Builder
+	for {
+		event, ok := r.take(pasteTimeout)
+		if !ok {
+			break
+		}
+		if event.Key == KeyEsc && r.expect(pasteEnd) {
+			break
+		}
+		switch {
+		case event.Ch != 0:
+			text.WriteRune(event.Ch)
+		case event.Key == KeyEnter || event.Key == KeyCtrlJ:
+			text.WriteByte('\n')
+		case event.Key == KeyTab:
+			text.WriteByte('\t')
+		case event.Key == KeySpace:
+			text.WriteByte(' ')
+		case event.Key == KeyEsc:
+			text.WriteByte('\x1b')
+		}
+	}
+	return Event{Type: EventPaste, Text: text.String()}, true
+}
+
+func (r *pasteReader) take(timeout time.Duration) (Event, bool) {
+	if len(r.pending) > 0 {
+		event := r.pending[0]
+		r.pending = r.pending[1:]
+		return event, true
+	}
+	return r.next(timeout)
+}
+
+// expect reads the characters of seq that follow an Esc. If they do not
+// all arrive at once they are kept to be read as ordinary events.
+func (r *pasteReader) expect(seq string) bool {
+	var read []Event
+	for _, ch := range seq {
+		event, ok := r.take(0)
+		if ok {
+			read = append(read, event)
+		}
+		if !ok || event.Type != EventKey || event.Ch != ch {
+			r.pending = append(read, r.pending...)
+			return false
+		}
+	}
+	return true
+}
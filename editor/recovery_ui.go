@@ -0,0 +1,137 @@
+package editor
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/mattn/go-runewidth"
+)
+
+const (
+	recoverRestore = "Restore unsaved changes"
+	recoverDiff    = "Show differences"
+	recoverKeep    = "Keep swap file and open the file as it is"
+	recoverDiscard = "Discard swap file"
+)
+
+type recoveryView struct {
+	swap    *savedSwap
+	options []string
+	cursor  int
+	diff    diffView
+}
+
+// openRecovery asks what to do with a swap file left by an earlier session.
+// Keeping it, which Esc also does, leaves it for later, such as after the
+// file is brought back to the version the changes were made to.
+func (e *Editor) openRecovery(swap *savedSwap) {
+	options := []string{recoverKeep, recoverDiscard}
+	if swap.matchesDisk(e.Buffer()) {
+		options = []string{recoverRestore, recoverDiff, recoverKeep, recoverDiscard}
+	}
+	e.recovery = recoveryView{swap: swap, options: options}
+	e.mode = ModeRecovery
+}
+
+func (e *Editor) showRecovery() {
+	if e.recovery.diff.open {
+		e.showDiffView(&e.recovery.diff)
+		return
+	}
+	w, h := e.screen.Size()
+	view := &e.recovery
+	b := e.Buffer()
+
+	text := []string{
+		"Found a swap file with unsaved changes to " + b.Path,
+		fmt.Sprintf("written %s by process %d", view.swap.Time.Format("2006-01-02 15:04:05"), view.swap.PID),
+	}
+	if view.swap.running() {
+		text[1] += " (still running)"
+	}
+	if !view.swap.matchesDisk(b) {
+		text = append(text,
+			"The file has changed since, and the changes apply only to the old",
+			"version. Keep the swap file to restore them once it is back.")
+	} else if !view.swap.historyMatches(b) {
+		text = append(text, "The file has changed since; restoring puts your version in place.")
+	}
+
+	pw := 72
+	ph := len(text) + len(view.options) + 5
+	x := (w - pw) / 2
+	y := (h - ph) / 2
+
+	e.drawPopupFrame(x, y, pw, ph, "Swap File")
+
+	for i, line := range text {
+		e.printCell(x+2, y+1+i, ColorWhite, ColorBlack, runewidth.Truncate(line, pw-4, "..."))
+	}
+	for i, option := range view.options {
+		var fg, bg Attribute = ColorWhite, ColorBlack
+		if i == view.cursor {
+			fg, bg = ColorBlack, ColorWhite
+		}
+		e.printCell(x+2, y+2+len(text)+i, fg, bg, option)
+	}
+
+	footerText := "[↑/↓] Navigate  [Enter] Select  [Esc] Keep"
+	footerX := x + (pw-len(footerText))/2
+	e.printCell(footerX, y+ph-2, ColorBlue, ColorBlack, footerText)
+}
+
+func (e *Editor) processRecoveryEvent(event Event) {
+	view := &e.recovery
+	if view.diff.open {
+		view.diff.processEvent(event)
+		return
+	}
+
+	switch event.Key {
+	case KeyEsc:
+		e.selectRecoveryOption(recoverKeep)
+	case KeyArrowUp:
+		if view.cursor > 0 {
+			view.cursor--
+		}
+	case KeyArrowDown:
+		if view.cursor < len(view.options)-1 {
+			view.cursor++
+		}
+	case KeyEnter:
+		e.selectRecoveryOption(view.options[view.cursor])
+	}
+}
+
+func (e *Editor) selectRecoveryOption(option string) {
+	view := &e.recovery
+	b := e.Buffer()
+	switch option {
+	case recoverRestore:
+		if b.recoverSwap(view.swap) {
+			e.setMessage("Restored unsaved changes to " + b.Path)
+		} else {
+			e.setMessage("The swap file for " + b.Path + " could not be applied")
+		}
+		e.mode = ModeEditor
+	case recoverDiff:
+		recovered, err := OpenBuffer(b.Path)
+		if err != nil || !recovered.recoverSwap(view.swap) {
+			recovered.lines.close()
+			e.setMessage("The swap file for " + b.Path + " could not be applied")
+			return
+		}
+		view.diff.show("Unsaved Changes", diffBuffers(b, recovered))
+		// Close would delete the swap file the copy took over.
+		recovered.lines.close()
+	case recoverKeep:
+		b.keepSwap()
+		e.setMessage("Kept the swap file for " + b.Path + "; it is not updated while the file is open")
+		e.mode = ModeEditor
+	case recoverDiscard:
+		if err := b.discardSwap(); err != nil && !os.IsNotExist(err) {
+			e.setMessage("Error removing swap file: " + err.Error())
+		}
+		e.mode = ModeEditor
+	}
+}
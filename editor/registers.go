@@ -0,0 +1,283 @@
+package editor
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// copiedText is text taken from a buffer by copying or deleting. Its kind
+// says how it is pasted: characters are inserted at the cursor, with a line
+// break between each of lines; whole lines are inserted above the cursor's
+// line; and a block is inserted as a rectangle at the cursor's column.
+type copiedText struct {
+	kind  EditMode
+	lines [][]rune
+}
+
+// appendText returns text with more added after it. Characters continue
+// the last line of text; anything else of a different kind makes the
+// result whole lines.
+func (text copiedText) appendText(more copiedText) copiedText {
+	if len(text.lines) == 0 {
+		return more
+	}
+	lines := slices.Clone(text.lines)
+	if text.kind == EditVisual && more.kind == EditVisual {
+		last := len(lines) - 1
+		lines[last] = joinRunes(lines[last], more.lines[0])
+		return copiedText{kind: EditVisual, lines: append(lines, more.lines[1:]...)}
+	}
+	kind := text.kind
+	if kind != more.kind {
+		kind = EditVisualLine
+	}
+	return copiedText{kind: kind, lines: append(lines, more.lines...)}
+}
+
+// describe returns how the text is listed in the registers popup: its
+// first line and how many more there are.
+func (text copiedText) describe() string {
+	first := strings.ReplaceAll(string(text.lines[0]), "\t", "→")
+	switch {
+	case len(text.lines) == 2 && text.kind == EditVisual && len(text.lines[1]) == 0:
+		return first + "↵"
+	case len(text.lines) > 1:
+		return first + "↵ … (" + plural(len(text.lines), "line", "lines") + ")"
+	}
+	return first
+}
+
+// plural returns n followed by one or many, whichever fits.
+func plural(n int, one, many string) string {
+	if n == 1 {
+		return "1 " + one
+	}
+	return fmt.Sprintf("%d %s", n, many)
+}
+
+// Register names. Copies and deletions go to the unnamed register unless
+// another is chosen with '"' first, and also into the numbered history:
+// copyRegister holds the last copy, and '1' to '9' the last nine copies
+// and deletions, newest first. Named registers 'a' to 'z' are only written
+// when chosen; choosing 'A' to 'Z' appends to them instead.
+// clipboardRegister, or '*', stands for the system clipboard and keeps a
+// copy of what was last put there.
+const (
+	unnamedRegister   = '"'
+	copyRegister      = '0'
+	clipboardRegister = '+'
+)
+
+type registers map[rune]copiedText
+
+// validRegister reports whether name can be chosen with '"'.
+func validRegister(name rune) bool {
+	return name == unnamedRegister || name == clipboardRegister || name == '*' || (name >= '0' && name <= '9') ||
+		(name >= 'a' && name <= 'z') || (name >= 'A' && name <= 'Z')
+}
+
+// store records text copied or deleted into the register name, which is
+// unnamedRegister unless the user chose another.
+func (r registers) store(name rune, text copiedText, deleted bool) {
+	name = canonicalRegister(name)
+	if name >= 'A' && name <= 'Z' {
+		name += 'a' - 'A'
+		text = r[name].appendText(text)
+	}
+	r[unnamedRegister] = text
+	if name != unnamedRegister {
+		r[name] = text
+		return
+	}
+	if !deleted {
+		r[copyRegister] = text
+	}
+	for n := '9'; n > '1'; n-- {
+		if previous, ok := r[n-1]; ok {
+			r[n] = previous
+		}
+	}
+	r['1'] = text
+}
+
+// get returns the contents of the register name.
+func (r registers) get(name rune) (copiedText, bool) {
+	name = canonicalRegister(name)
+	if name >= 'A' && name <= 'Z' {
+		name += 'a' - 'A'
+	}
+	text, ok := r[name]
+	return text, ok && len(text.lines) > 0
+}
+
+// names returns the names of the registers that hold text, in the order the
+// popup lists them.
+func (r registers) names() []rune {
+	var names []rune
+	for _, name := range []rune(`"+0123456789abcdefghijklmnopqrstuvwxyz`) {
+		if _, ok := r.get(name); ok {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// canonicalRegister returns the name under which the register name is
+// kept; '*' is another name for the clipboard.
+func canonicalRegister(name rune) rune {
+	if name == '*' {
+		return clipboardRegister
+	}
+	return name
+}
+
+// String returns the text with its lines joined by \n. Whole lines end in
+// a line break too.
+func (text copiedText) String() string {
+	lines := make([]string, len(text.lines))
+	for i, line := range text.lines {
+		lines[i] = string(line)
+	}
+	s := strings.Join(lines, "\n")
+	if text.kind == EditVisualLine {
+		s += "\n"
+	}
+	return s
+}
+
+// parseCopiedText returns s as copied text: whole lines if it ends in a
+// line break, and characters otherwise.
+func parseCopiedText(s string) copiedText {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	if trimmed, ok := strings.CutSuffix(s, "\n"); ok {
+		return copiedText{kind: EditVisualLine, lines: splitRuneLines(trimmed)}
+	}
+	return copiedText{kind: EditVisual, lines: splitRuneLines(s)}
+}
+
+func splitRuneLines(s string) [][]rune {
+	parts := strings.Split(s, "\n")
+	lines := make([][]rune, len(parts))
+	for i, part := range parts {
+		lines[i] = []rune(part)
+	}
+	return lines
+}
+
+// The named registers are saved in ~/.gocodeeditor/registers.json, so that
+// they and the macros recorded into them survive a restart. The file may
+// hold copied text, so only the user can read it. JSON strings cannot hold
+// bytes that are not valid UTF-8, so text with such bytes, copied from a
+// file that has them, is saved as base64 in Bytes instead of Lines.
+
+type savedRegister struct {
+	Kind  string   `json:"kind"`
+	Lines []string `json:"lines,omitempty"`
+	Bytes [][]byte `json:"bytes,omitempty"`
+}
+
+var registerKinds = map[EditMode]string{
+	EditVisual:      "characters",
+	EditVisualLine:  "lines",
+	EditVisualBlock: "block",
+}
+
+func registersPath() (string, error) {
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "registers.json"), nil
+}
+
+// loadRegisters reads the saved named registers. There are none if the
+// file does not exist.
+func loadRegisters() (registers, error) {
+	r := registers{}
+	path, err := registersPath()
+	if err != nil {
+		return r, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return r, nil
+	}
+	if err != nil {
+		return r, err
+	}
+	var saved map[string]savedRegister
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return r, fmt.Errorf("%s: %w", path, err)
+	}
+	for name, register := range saved {
+		ch, size := utf8.DecodeRuneInString(name)
+		if size != len(name) || ch < 'a' || ch > 'z' {
+			return r, fmt.Errorf("%s: invalid register %q", path, name)
+		}
+		kind := EditMode(-1)
+		for mode, kindName := range registerKinds {
+			if kindName == register.Kind {
+				kind = mode
+			}
+		}
+		lines := register.Bytes
+		if lines == nil {
+			for _, line := range register.Lines {
+				lines = append(lines, []byte(line))
+			}
+		}
+		if kind < 0 || len(lines) == 0 {
+			return r, fmt.Errorf("%s: invalid register %s", path, name)
+		}
+		text := copiedText{kind: kind, lines: make([][]rune, len(lines))}
+		for i, line := range lines {
+			text.lines[i], _ = decodeLine(line)
+		}
+		r[ch] = text
+	}
+	return r, nil
+}
+
+// save writes the named registers over the saved ones.
+func (r registers) save() error {
+	path, err := registersPath()
+	if err != nil {
+		return err
+	}
+	saved := map[string]savedRegister{}
+	for name := 'a'; name <= 'z'; name++ {
+		text, ok := r.get(name)
+		if !ok {
+			continue
+		}
+		register := savedRegister{Kind: registerKinds[text.kind]}
+		valid := true
+		for _, line := range text.lines {
+			data := encodeLine(nil, line)
+			valid = valid && utf8.Valid(data)
+			register.Bytes = append(register.Bytes, data)
+		}
+		if valid {
+			for _, line := range register.Bytes {
+				register.Lines = append(register.Lines, string(line))
+			}
+			register.Bytes = nil
+		}
+		saved[string(name)] = register
+	}
+	data, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writePrivateFile(path, func(w *bufio.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
@@ -0,0 +1,95 @@
+package editor
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSaveRegistersWithInvalidBytes(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	latin1, _ := decodeLine([]byte("caf\xe9"))
+	r := registers{
+		'a': {kind: EditVisualLine, lines: [][]rune{latin1, []rune("plain")}},
+		'b': {kind: EditVisual, lines: [][]rune{[]rune("héllo"), {}}},
+	}
+	if err := r.save(); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := loadRegisters()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []rune("ab") {
+		got, want := loaded[name], r[name]
+		if got.kind != want.kind || !slices.EqualFunc(got.lines, want.lines, slices.Equal) {
+			t.Errorf("register %c = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestRegisterHistory(t *testing.T) {
+	r := registers{}
+	chars := func(s string) copiedText { return copiedText{kind: EditVisual, lines: [][]rune{[]rune(s)}} }
+	r.store(unnamedRegister, chars("first"), false)
+	r.store(unnamedRegister, chars("second"), true)
+	r.store('a', chars("named"), false)
+	r.store('A', copiedText{kind: EditVisualLine, lines: [][]rune{[]rune("more")}}, false)
+	r.store(unnamedRegister, chars("third"), true)
+
+	for _, tt := range []struct {
+		name rune
+		want string
+	}{
+		{unnamedRegister, "third"},
+		{copyRegister, "first"},
+		{'1', "third"},
+		{'2', "second"},
+		{'3', "first"},
+		// Appending lines to characters makes whole lines.
+		{'a', "named\nmore\n"},
+		{'A', "named\nmore\n"},
+	} {
+		if text, _ := r.get(tt.name); text.String() != tt.want {
+			t.Errorf("register %c = %q, want %q", tt.name, text.String(), tt.want)
+		}
+	}
+	// A named register stays out of the numbered history.
+	if _, ok := r.get('4'); ok {
+		t.Error("register 4 holds text")
+	}
+	if got, want := string(r.names()), `"0123a`; got != want {
+		t.Errorf("names = %q, want %q", got, want)
+	}
+}
+
+func TestPasteFromRegisters(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	useSettings(t, Settings{TabSize: 4, Theme: "one-dark", Clipboard: "none"})
+	e := NewEditor(NewMemoryScreen(80, 12))
+	b := newTestBuffer("one\ntwo\nthree")
+	e.buffers, e.window.buffer = []*Buffer{b}, b
+
+	typeKeys(e, `"ayy`)
+	pressKey(e, KeyArrowDown)
+	typeKeys(e, "dd")
+	// Whole lines go in above the cursor's line.
+	typeKeys(e, `"ap`)
+	if got, want := bufferText(b), "one\none\nthree"; got != want {
+		t.Fatalf("after \"ap, buffer = %q, want %q", got, want)
+	}
+
+	// The popup lists the unnamed register, the numbered ones and then a;
+	// the second entry, register 1, holds the deleted line.
+	typeKeys(e, "P")
+	if e.mode != ModeRegisters {
+		t.Fatalf("mode = %v, want the registers popup", e.mode)
+	}
+	pressKey(e, KeyArrowDown)
+	pressKey(e, KeyEnter)
+	if got, want := bufferText(b), "one\ntwo\none\nthree"; got != want {
+		t.Errorf("after pasting from the popup, buffer = %q, want %q", got, want)
+	}
+	if e.mode != ModeEditor {
+		t.Errorf("mode = %v, want the editor", e.mode)
+	}
+}
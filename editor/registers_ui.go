@@ -0,0 +1,192 @@
+package editor
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mattn/go-runewidth"
+)
+
+// registersView lists the registers holding text, to paste one of them.
+type registersView struct {
+	names  []rune
+	cursor int
+}
+
+func (e *Editor) openRegisters() {
+	names := e.registers.names()
+	if len(names) == 0 {
+		e.setMessage("All registers are empty")
+		return
+	}
+	e.registersView = registersView{names: names}
+	e.mode = ModeRegisters
+}
+
+// storeCopy puts text that was copied or deleted into the register chosen
+// for it. A named register is saved; any other register also puts the text
+// on the system clipboard.
+func (e *Editor) storeCopy(text copiedText, deleted bool) {
+	name := e.takeRegister()
+	e.registers.store(name, text, deleted)
+	if validMacro(name) {
+		if err := e.registers.save(); err != nil {
+			e.setMessage("Error saving registers: " + err.Error())
+		}
+	}
+	if name == unnamedRegister || canonicalRegister(name) == clipboardRegister {
+		e.copyToClipboard(text)
+	}
+}
+
+// systemClipboard returns the clipboard chosen by the clipboard setting, or
+// nil if there is none.
+func (e *Editor) systemClipboard() Clipboard {
+	if !e.clipboardFound || e.clipboardSetting != editSettings.Clipboard {
+		e.clipboard = findClipboard(editSettings.Clipboard, e.screen)
+		e.clipboardSetting = editSettings.Clipboard
+		e.clipboardFound = true
+	}
+	return e.clipboard
+}
+
+func (e *Editor) copyToClipboard(text copiedText) {
+	clipboard := e.systemClipboard()
+	if clipboard == nil {
+		return
+	}
+	e.registers[clipboardRegister] = text
+	if err := clipboard.Copy(text.String()); err != nil {
+		e.setMessage("Error copying to the clipboard with " + clipboard.Name() + ": " + err.Error())
+	}
+}
+
+// registerText returns the contents of the register name. The clipboard
+// register is read from the system clipboard if it can be, and otherwise
+// holds what the editor last put there.
+func (e *Editor) registerText(name rune) (copiedText, error) {
+	if canonicalRegister(name) == clipboardRegister {
+		if clipboard := e.systemClipboard(); clipboard != nil {
+			s, err := clipboard.Paste()
+			if err == nil && s != "" {
+				return parseCopiedText(s), nil
+			}
+			if _, ok := e.registers.get(clipboardRegister); !ok && err != nil {
+				return copiedText{}, err
+			}
+		}
+	}
+	text, ok := e.registers.get(name)
+	if !ok {
+		return copiedText{}, fmt.Errorf("register %c is empty", name)
+	}
+	return text, nil
+}
+
+// takeRegister returns the register chosen with '"' for the current
+// command, or the unnamed one, and clears the choice.
+func (e *Editor) takeRegister() rune {
+	name := e.register
+	e.register = 0
+	if name == 0 {
+		return unnamedRegister
+	}
+	return name
+}
+
+// paste inserts the contents of the chosen register at the cursor.
+func (e *Editor) paste() {
+	text, err := e.registerText(e.takeRegister())
+	if err != nil {
+		e.setMessage(err.Error())
+		return
+	}
+	e.pasteText(text)
+}
+
+// insertPaste inserts text pasted through the terminal: into the buffer at
+// the cursor as a single change, or into the command line or search prompt
+// with line breaks turned into spaces.
+func (e *Editor) insertPaste(text string) {
+	text = strings.ReplaceAll(strings.ReplaceAll(text, "\r\n", "\n"), "\r", "\n")
+	switch e.mode {
+	case ModeEditor:
+		e.endSelection()
+		e.Buffer().InsertText(text)
+	case ModeCommandLine:
+		for _, r := range strings.ReplaceAll(text, "\n", " ") {
+			e.commandLine.insert(r)
+		}
+	case ModeSearch:
+		e.search.input = append(e.search.input, []rune(strings.ReplaceAll(text, "\n", " "))...)
+		e.incrementalSearch()
+	}
+}
+
+func (e *Editor) showRegisters() {
+	w, h := e.screen.Size()
+	view := &e.registersView
+
+	pw := 72
+	ph := len(view.names) + 5
+	x := (w - pw) / 2
+	y := max((h-ph)/2, 0)
+
+	e.drawPopupFrame(x, y, pw, ph, "Registers")
+
+	kinds := map[EditMode]string{EditVisual: "chars", EditVisualLine: "lines", EditVisualBlock: "block"}
+	for i, name := range view.names {
+		text, _ := e.registers.get(name)
+		label := fmt.Sprintf("\"%c  %-5s  %s", name, kinds[text.kind], text.describe())
+		label = runewidth.FillRight(runewidth.Truncate(label, pw-4, "…"), pw-4)
+		var fg, bg Attribute = ColorWhite, ColorBlack
+		if i == view.cursor {
+			fg, bg = ColorBlack, ColorWhite
+		}
+		e.printCell(x+2, y+2+i, fg, bg, label)
+	}
+
+	footerText := "[Enter] or name: Paste  [Esc] Close"
+	footerX := x + (pw-len(footerText))/2
+	e.printCell(footerX, y+ph-2, ColorBlue, ColorBlack, footerText)
+}
+
+func (e *Editor) processRegistersEvent(event Event) {
+	view := &e.registersView
+	if event.Ch != 0 {
+		if _, ok := e.registers.get(event.Ch); ok {
+			e.pasteRegister(event.Ch)
+		}
+		return
+	}
+	switch event.Key {
+	case KeyEsc:
+		e.mode = ModeEditor
+	case KeyArrowUp:
+		if view.cursor > 0 {
+			view.cursor--
+		}
+	case KeyArrowDown:
+		if view.cursor < len(view.names)-1 {
+			view.cursor++
+		}
+	case KeyEnter:
+		e.pasteRegister(view.names[view.cursor])
+	}
+}
+
+func (e *Editor) pasteRegister(name rune) {
+	e.mode = ModeEditor
+	text, err := e.registerText(name)
+	if err != nil {
+		e.setMessage(err.Error())
+		return
+	}
+	e.pasteText(text)
+}
+
+// exRegisters opens the registers popup.
+func (e *Editor) exRegisters(args exArgs) error {
+	e.openRegisters()
+	return nil
+}
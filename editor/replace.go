@@ -0,0 +1,119 @@
+package editor
+
+import (
+	"bytes"
+	"regexp"
+	"unicode/utf8"
+)
+
+// Substitution replaces the matches of a regular expression in Go regexp
+// syntax. Replacement may refer to capture groups as $1 or ${name}, and
+// $$ stands for a literal $. Only the first match on each line is replaced
+// unless Global is set. Matching runs on the bytes of the lines, so bytes
+// that are not valid UTF-8 are kept as they are.
+type Substitution struct {
+	Pattern     *regexp.Regexp
+	Replacement string
+	Global      bool
+}
+
+// NewSubstitution compiles pattern. ignoreCase makes it match regardless
+// of case, and wholeWord only where it is not part of a longer word.
+func NewSubstitution(pattern, replacement string, ignoreCase, wholeWord bool) (*Substitution, error) {
+	if wholeWord {
+		pattern = `\b(?:` + pattern + `)\b`
+	}
+	if ignoreCase {
+		pattern = `(?i)` + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return &Substitution{Pattern: re, Replacement: replacement}, nil
+}
+
+// SubstitutionMatch is a match of a Substitution on one line, in runes,
+// together with the text it is replaced with.
+type SubstitutionMatch struct {
+	Row         int
+	Column      int
+	Length      int
+	Replacement []rune
+}
+
+// expand appends the replacement for the match at the byte offsets in loc
+// to dst.
+func (s *Substitution) expand(dst, line []byte, loc []int) []byte {
+	return s.Pattern.Expand(dst, []byte(s.Replacement), line, loc)
+}
+
+// Find returns the first match at or after row and column on the lines up
+// to last, or false if there is none. Matches are found on whole lines, so
+// ^ and \b see the text before column.
+func (b *Buffer) Find(s *Substitution, row, column, last int) (SubstitutionMatch, bool) {
+	for ; row <= last && row < b.LineCount(); row++ {
+		line := b.rawLine(row)
+		for _, loc := range s.Pattern.FindAllSubmatchIndex(line, -1) {
+			start := utf8.RuneCount(line[:loc[0]])
+			if start < column {
+				continue
+			}
+			replacement, _ := decodeLine(s.expand(nil, line, loc))
+			return SubstitutionMatch{
+				Row:         row,
+				Column:      start,
+				Length:      utf8.RuneCount(line[loc[0]:loc[1]]),
+				Replacement: replacement,
+			}, true
+		}
+		column = 0
+	}
+	return SubstitutionMatch{}, false
+}
+
+// Replace replaces the text of m, which Find returned, and leaves the
+// cursor after the replacement.
+func (b *Buffer) Replace(m SubstitutionMatch) {
+	b.edit(func() {
+		line := b.Line(m.Row)
+		b.replaceLines(m.Row, 1, [][]rune{joinRunes(line[:m.Column], m.Replacement, line[m.Column+m.Length:])})
+		b.Row, b.Column = m.Row, m.Column+len(m.Replacement)
+	})
+}
+
+// ReplaceAll replaces the matches on the lines from first to last as a
+// single undo step. It returns the number of replacements and of lines
+// changed, and leaves the cursor at the start of the last changed line.
+func (b *Buffer) ReplaceAll(s *Substitution, first, last int) (int, int) {
+	limit := 1
+	if s.Global {
+		limit = -1
+	}
+	count, lines := 0, 0
+	b.edit(func() {
+		for row := first; row <= last && row < b.LineCount(); row++ {
+			line := b.rawLine(row)
+			locs := s.Pattern.FindAllSubmatchIndex(line, limit)
+			if len(locs) == 0 {
+				continue
+			}
+			var replaced []byte
+			end := 0
+			for _, loc := range locs {
+				replaced = append(replaced, line[end:loc[0]]...)
+				replaced = s.expand(replaced, line, loc)
+				end = loc[1]
+			}
+			replaced = append(replaced, line[end:]...)
+			if !bytes.Equal(replaced, line) {
+				runes, _ := decodeLine(replaced)
+				b.replaceLines(row, 1, [][]rune{runes})
+			}
+			count += len(locs)
+			lines++
+			b.Row, b.Column = row, 0
+		}
+	})
+	return count, lines
+}
@@ -0,0 +1,170 @@
+package editor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSubstitute(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		command string
+		want    string
+	}{
+		{"first match only", "foo foo\nfoo", "%s/foo/bar/", "bar foo\nbar"},
+		{"every match with g", "foo foo\nfoo", "%s/foo/bar/g", "bar bar\nbar"},
+		{"current line", "foo\nfoo", "s/foo/bar/", "bar\nfoo"},
+		{"capture groups", "key=value", "s/(\\w+)=(\\w+)/$2=$1/", "value=key"},
+		{"trailing spaces kept", "a,b", "s/,/,  /", "a,  b"},
+		{"empty matches", "abc", "s/x*/-/g", "-a-b-c-"},
+		{"other delimiter", "/usr/bin", "s#/usr#/opt#", "/opt/bin"},
+		{"ignore case", "Foo foo", "s/foo/bar/gi", "bar bar"},
+		{"whole words", "foobar foo", "s/foo/x/gw", "foobar x"},
+	}
+	t.Setenv("HOME", t.TempDir())
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := NewEditor(NewMemoryScreen(80, 8))
+			b := newTestBuffer(tt.text)
+			e.buffers, e.window.buffer = []*Buffer{b}, b
+			if err := e.executeCommand(tt.command); err != nil {
+				t.Fatal(err)
+			}
+			if got := bufferText(b); got != tt.want {
+				t.Errorf(":%s gives %q, want %q", tt.command, got, tt.want)
+			}
+			b.Undo()
+			if got := bufferText(b); got != tt.text {
+				t.Errorf("undo gives %q, want %q", got, tt.text)
+			}
+		})
+	}
+}
+
+func TestSubstituteKeepsInvalidBytes(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	path := filepath.Join(t.TempDir(), "bad.txt")
+	if err := os.WriteFile(path, []byte("bad \xff foo \xfe\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	e := NewEditor(NewMemoryScreen(80, 8))
+	e.Open(path)
+	if err := e.executeCommand("s/foo (.)/bar$1/"); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Buffer().Save(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "bad \xff bar\xfe\n"; string(data) != want {
+		t.Errorf("saved %q, want %q", data, want)
+	}
+}
+
+func TestSubstituteConfirmFirstMatchOnly(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	e := NewEditor(NewMemoryScreen(80, 8))
+	b := newTestBuffer("a a\na a")
+	e.buffers, e.window.buffer = []*Buffer{b}, b
+	if err := e.executeCommand("%s/a/b/c"); err != nil {
+		t.Fatal(err)
+	}
+	typeKeys(e, "ya")
+	if got, want := bufferText(b), "b a\nb a"; got != want {
+		t.Errorf("buffer = %q, want %q", got, want)
+	}
+	if e.mode != ModeEditor {
+		t.Error("confirmation did not end after the first match of each line")
+	}
+}
+
+func TestSubstituteRanges(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	tests := []struct {
+		command string
+		want    string
+	}{
+		{"2s/x/y/", "x\ny\nx\nx"},
+		{"2,3s/x/y/", "x\ny\ny\nx"},
+		{"3,2s/x/y/", "x\ny\ny\nx"},
+		{".,$s/x/y/", "x\ny\ny\ny"},
+		{".+1,$-1s/x/y/", "x\nx\ny\nx"},
+		{"'<,'>s/x/y/", "y\ny\nx\nx"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			e := NewEditor(NewMemoryScreen(80, 8))
+			b := newTestBuffer("x\nx\nx\nx")
+			e.buffers, e.window.buffer = []*Buffer{b}, b
+			// Select the first two lines, leaving the cursor on the second.
+			typeKeys(e, "V")
+			e.HandleEvent(Event{Type: EventKey, Key: KeyArrowDown})
+			e.HandleEvent(Event{Type: EventKey, Key: KeyEsc})
+			if err := e.executeCommand(tt.command); err != nil {
+				t.Fatal(err)
+			}
+			if got := bufferText(b); got != tt.want {
+				t.Errorf(":%s gives %q, want %q", tt.command, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSubstituteErrors(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	e := NewEditor(NewMemoryScreen(80, 8))
+	b := newTestBuffer("abc")
+	e.buffers, e.window.buffer = []*Buffer{b}, b
+	for _, command := range []string{"s", "s/(/x/", "s/a/b/z", "s/x/y/", "sxaxbx", "s//y/", "'<s/a/b/"} {
+		if err := e.executeCommand(command); err == nil {
+			t.Errorf(":%s did not fail", command)
+		}
+	}
+	if got := bufferText(b); got != "abc" {
+		t.Errorf("failed commands changed the buffer to %q", got)
+	}
+	// An empty pattern is the last search, taken literally.
+	e.lastSearch = "b"
+	if err := e.executeCommand("s//./"); err != nil {
+		t.Fatal(err)
+	}
+	if got := bufferText(b); got != "a.c" {
+		t.Errorf(":s//./ gives %q, want %q", got, "a.c")
+	}
+}
+
+func TestSubstituteConfirm(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	tests := []struct {
+		keys string
+		want string
+	}{
+		{"yyyy", "b b\nb b"},
+		{"nyny", "a b\na b"},
+		{"na", "a b\nb b"},
+		{"yq", "b a\na a"},
+		{"nl", "a b\na a"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.keys, func(t *testing.T) {
+			e := NewEditor(NewMemoryScreen(80, 8))
+			b := newTestBuffer("a a\na a")
+			e.buffers, e.window.buffer = []*Buffer{b}, b
+			if err := e.executeCommand("%s/a/b/gc"); err != nil {
+				t.Fatal(err)
+			}
+			typeKeys(e, tt.keys)
+			if got := bufferText(b); got != tt.want {
+				t.Errorf("after %s, buffer = %q, want %q", tt.keys, got, tt.want)
+			}
+			if e.mode != ModeEditor {
+				t.Errorf("after %s, still confirming", tt.keys)
+			}
+		})
+	}
+}
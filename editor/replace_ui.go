@@ -0,0 +1,213 @@
+package editor
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/mattn/go-runewidth"
+)
+
+// replaceView steps through the matches of a substitution given the c flag,
+// showing each replacement in place until it is accepted or skipped. The
+// accepted ones are undone together.
+type replaceView struct {
+	sub   *Substitution
+	last  int
+	match SubstitutionMatch
+	count int
+}
+
+// exSubstitute runs :[range]s/pattern/replacement/[flags]. The first match
+// on each line of the range is replaced; the flags are g to replace every
+// match, i to ignore case, w to match whole words only and c to confirm
+// each replacement. An empty pattern searches for the last search.
+func (e *Editor) exSubstitute(args exArgs) error {
+	arg := args.arg
+	if arg == "" {
+		return errors.New("usage: s/pattern/replacement/[flags]")
+	}
+	delim := []rune(arg)[0]
+	if unicode.IsLetter(delim) || unicode.IsDigit(delim) || delim == '\\' || delim == ' ' {
+		return fmt.Errorf("invalid delimiter: %c", delim)
+	}
+	parts := splitDelimited(arg[len(string(delim)):], delim)
+	for len(parts) < 3 {
+		parts = append(parts, "")
+	}
+	pattern, replacement, flags := parts[0], parts[1], parts[2]
+
+	var global, ignoreCase, wholeWord, confirm bool
+	for _, flag := range flags {
+		switch flag {
+		case 'i':
+			ignoreCase = true
+		case 'w':
+			wholeWord = true
+		case 'c':
+			confirm = true
+		case 'g':
+			global = true
+		default:
+			return fmt.Errorf("unknown flag: %c", flag)
+		}
+	}
+	if pattern == "" {
+		if e.lastSearch == "" {
+			return errors.New("no previous search")
+		}
+		pattern = regexp.QuoteMeta(e.lastSearch)
+	}
+	sub, err := NewSubstitution(pattern, replacement, ignoreCase, wholeWord)
+	if err != nil {
+		return fmt.Errorf("invalid pattern: %w", err)
+	}
+	sub.Global = global
+
+	if confirm {
+		return e.openReplace(sub, args.first, args.last)
+	}
+	count, lines := e.Buffer().ReplaceAll(sub, args.first, args.last)
+	if count == 0 {
+		return errors.New("pattern not found: " + pattern)
+	}
+	e.setMessage("Replaced " + plural(count, "match", "matches") + " on " + plural(lines, "line", "lines"))
+	return nil
+}
+
+// splitDelimited splits s at the unescaped occurrences of delim into at
+// most three parts. A backslash before delim is dropped; other backslashes
+// are kept for the regexp and replacement.
+func splitDelimited(s string, delim rune) []string {
+	var parts []string
+	var part strings.Builder
+	escaped := false
+	for _, r := range s {
+		switch {
+		case escaped && r == delim:
+			part.WriteRune(r)
+		case escaped:
+			part.WriteRune('\\')
+			part.WriteRune(r)
+		case r == '\\':
+			escaped = true
+			continue
+		case r == delim && len(parts) < 2:
+			parts = append(parts, part.String())
+			part.Reset()
+		default:
+			part.WriteRune(r)
+		}
+		escaped = false
+	}
+	if escaped {
+		part.WriteRune('\\')
+	}
+	return append(parts, part.String())
+}
+
+func (e *Editor) openReplace(sub *Substitution, first, last int) error {
+	b := e.Buffer()
+	match, ok := b.Find(sub, first, 0, last)
+	if !ok {
+		return errors.New("pattern not found: " + sub.Pattern.String())
+	}
+	e.replace = replaceView{sub: sub, last: last, match: match}
+	b.BeginUndoGroup()
+	b.Row, b.Column = match.Row, match.Column
+	e.mode = ModeReplace
+	return nil
+}
+
+// replaceLine returns the line at row as displayText should show it, with
+// the pending replacement in place.
+func (e *Editor) replaceLine(row int) []rune {
+	line := e.Buffer().Line(row)
+	m := e.replace.match
+	if e.mode != ModeReplace || row != m.Row {
+		return line
+	}
+	return joinRunes(line[:m.Column], m.Replacement, line[m.Column+m.Length:])
+}
+
+func (e *Editor) displayReplace() {
+	prompt := fmt.Sprintf("Replace with %q? [y]es [n]o [a]ll [l]ast [q]uit", string(e.replace.match.Replacement))
+	e.printCell(0, e.rows, CurrentTheme.Foreground, CurrentTheme.Background, runewidth.FillRight(runewidth.Truncate(prompt, e.cols, "..."), e.cols))
+}
+
+func (e *Editor) processReplaceEvent(event Event) {
+	view := &e.replace
+	b := e.Buffer()
+	if event.Key == KeyEsc {
+		e.finishReplace()
+		return
+	}
+	switch event.Ch {
+	case 'y':
+		e.acceptReplacement()
+		e.nextReplacement()
+	case 'n':
+		m := view.match
+		e.findReplacement(m.Row, m.Column+max(m.Length, 1))
+	case 'a':
+		for e.mode == ModeReplace {
+			e.acceptReplacement()
+			e.nextReplacement()
+		}
+	case 'l':
+		e.acceptReplacement()
+		e.finishReplace()
+	case 'q':
+		e.finishReplace()
+	}
+	if e.mode == ModeReplace {
+		b.Row, b.Column = view.match.Row, view.match.Column
+	}
+}
+
+func (e *Editor) acceptReplacement() {
+	e.Buffer().Replace(e.replace.match)
+	e.replace.count++
+}
+
+// nextReplacement moves on from an accepted replacement. After an empty
+// match it skips a character so the same position is not matched again,
+// and like ReplaceAll it passes over an empty match right after the text
+// it replaced.
+func (e *Editor) nextReplacement() {
+	m := e.replace.match
+	column := m.Column + len(m.Replacement)
+	if m.Length == 0 {
+		column++
+	}
+	e.findReplacement(m.Row, column)
+	next := e.replace.match
+	if e.mode == ModeReplace && m.Length > 0 && next.Length == 0 && next.Row == m.Row && next.Column == column {
+		e.findReplacement(m.Row, column+1)
+	}
+}
+
+// findReplacement moves on to the next match at or after row and column,
+// or to the next line once the line's first match was dealt with if the
+// substitution is not global.
+func (e *Editor) findReplacement(row, column int) {
+	view := &e.replace
+	if !view.sub.Global && row == view.match.Row {
+		row, column = row+1, 0
+	}
+	match, ok := e.Buffer().Find(view.sub, row, column, view.last)
+	if !ok {
+		e.finishReplace()
+		return
+	}
+	view.match = match
+}
+
+func (e *Editor) finishReplace() {
+	b := e.Buffer()
+	b.EndUndoGroup()
+	e.mode = ModeEditor
+	e.setMessage("Replaced " + plural(e.replace.count, "match", "matches"))
+}
@@ -0,0 +1,190 @@
+package editor
+
+import (
+	"bufio"
+	"errors"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+)
+
+// writeFileAtomic writes a file by streaming write into a temporary file in
+// the same directory and renaming it over filename once it is safely on
+// disk, so a crash or a full disk never leaves a truncated file behind. If
+// filename is a symlink the file it points to is replaced and the link is
+// kept. The permissions, including the setuid, setgid and sticky bits, and
+// where allowed the owner, of an existing file are carried over to the new
+// one; a new file gets 0666 less the umask, as os.Create gives it. Extended
+// attributes and ACLs are not carried over.
+//
+// A file with other hard links, or in a directory the user cannot create
+// files in, is truncated and written in place instead, so the links keep
+// sharing it. detach is called first, to read whatever write still needs
+// from the file.
+func writeFileAtomic(filename string, write func(w *bufio.Writer) error, detach func() error) error {
+	target, err := filepath.EvalSymlinks(filename)
+	if os.IsNotExist(err) {
+		target = filename
+	} else if err != nil {
+		return err
+	}
+
+	mode := os.FileMode(0666)
+	exists := false
+	uid, gid := -1, -1
+	if info, err := os.Stat(target); err == nil {
+		exists = true
+		mode = info.Mode() & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky)
+		if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+			uid, gid = int(stat.Uid), int(stat.Gid)
+			if stat.Nlink > 1 {
+				return writeFileInPlace(target, mode, write, detach)
+			}
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	dir, base := filepath.Split(target)
+	if dir == "" {
+		dir = "."
+	}
+	// An existing file's copy stays private until it has that file's
+	// permissions; a new file is created with the umask applied.
+	tempMode := os.FileMode(0600)
+	if !exists {
+		tempMode = mode
+	}
+	temp, err := createTemp(dir, "."+base+".tmp-", tempMode)
+	if errors.Is(err, syscall.EACCES) {
+		return writeFileInPlace(target, mode, write, detach)
+	}
+	if err != nil {
+		return err
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			temp.Close()
+			os.Remove(temp.Name())
+		}
+	}()
+
+	writer := bufio.NewWriter(temp)
+	if err := write(writer); err != nil {
+		return err
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+	if exists {
+		// Only root can give a file away; keeping our own ownership is
+		// the best we can do otherwise. Changing the owner clears the
+		// setuid and setgid bits, so it comes before Chmod.
+		temp.Chown(uid, gid)
+		if err := temp.Chmod(mode); err != nil {
+			return err
+		}
+	}
+	if err := temp.Sync(); err != nil {
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(temp.Name(), target); err != nil {
+		return err
+	}
+	committed = true
+
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
+
+// createTemp creates a new file in dir, named prefix followed by a random
+// number, with perm less the umask.
+func createTemp(dir, prefix string, perm os.FileMode) (*os.File, error) {
+	for range 10000 {
+		name := filepath.Join(dir, prefix+strconv.FormatUint(uint64(rand.Uint32()), 10))
+		f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, perm)
+		if !os.IsExist(err) {
+			return f, err
+		}
+	}
+	return nil, errors.New("cannot create a temporary file in " + dir)
+}
+
+// writeFileInPlace truncates filename, or creates it with mode, and
+// streams write into it. A failure part way leaves the file truncated, so
+// it is only used when there is no room for a temporary file.
+func writeFileInPlace(filename string, mode os.FileMode, write func(w *bufio.Writer) error, detach func() error) error {
+	if err := detach(); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	writer := bufio.NewWriter(f)
+	if err := write(writer); err != nil {
+		return err
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// writePrivateFile writes a file that only the user can read, by streaming
+// write into a temporary file and renaming it over filename. Its directory
+// is created, or narrowed, to be private as well. The editor keeps the text
+// of the files it edits this way, and they may be private.
+func writePrivateFile(filename string, write func(w *bufio.Writer) error) error {
+	dir := filepath.Dir(filename)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	if err := os.Chmod(dir, 0700); err != nil {
+		return err
+	}
+	// CreateTemp makes the file with mode 0600.
+	temp, err := os.CreateTemp(dir, "."+filepath.Base(filename)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			temp.Close()
+			os.Remove(temp.Name())
+		}
+	}()
+
+	writer := bufio.NewWriter(temp)
+	if err := write(writer); err != nil {
+		return err
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+	if err := temp.Sync(); err != nil {
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(temp.Name(), filename); err != nil {
+		return err
+	}
+	committed = true
+	return nil
+}
@@ -0,0 +1,97 @@
+package editor
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func writeString(s string) func(w *bufio.Writer) error {
+	return func(w *bufio.Writer) error {
+		_, err := w.WriteString(s)
+		return err
+	}
+}
+
+func noDetach() error { return nil }
+
+func TestWriteFileAtomicKeepsSpecialBits(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "run.sh")
+	if err := os.WriteFile(path, []byte("old"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(path, 0755|os.ModeSetuid|os.ModeSetgid); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFileAtomic(path, writeString("new"), noDetach); err != nil {
+		t.Fatal(err)
+	}
+	checkMode(t, path, 0755|os.ModeSetuid|os.ModeSetgid)
+}
+
+func TestWriteFileAtomicInReadOnlyDir(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root can create files in any directory")
+	}
+	dir := t.TempDir()
+	path := filepath.Join(dir, "notes.txt")
+	if err := os.WriteFile(path, []byte("old text"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(dir, 0555); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chmod(dir, 0755) })
+
+	detached := false
+	detach := func() error {
+		detached = true
+		return nil
+	}
+	if err := writeFileAtomic(path, writeString("new"), detach); err != nil {
+		t.Fatal(err)
+	}
+	if !detached {
+		t.Error("detach was not called before writing in place")
+	}
+	if data, _ := os.ReadFile(path); string(data) != "new" {
+		t.Errorf("file holds %q, want %q", data, "new")
+	}
+}
+
+func TestWriteFileAtomicAppliesUmask(t *testing.T) {
+	old := syscall.Umask(077)
+	defer syscall.Umask(old)
+	path := filepath.Join(t.TempDir(), "new.txt")
+	if err := writeFileAtomic(path, writeString("new"), noDetach); err != nil {
+		t.Fatal(err)
+	}
+	checkMode(t, path, 0600)
+}
+
+func TestWriteFileAtomicKeepsHardLinks(t *testing.T) {
+	dir := t.TempDir()
+	path, link := filepath.Join(dir, "notes.txt"), filepath.Join(dir, "link.txt")
+	if err := os.WriteFile(path, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Link(path, link); err != nil {
+		t.Fatal(err)
+	}
+	detached := false
+	detach := func() error {
+		detached = true
+		return nil
+	}
+	if err := writeFileAtomic(path, writeString("new"), detach); err != nil {
+		t.Fatal(err)
+	}
+	if !detached {
+		t.Error("detach was not called before writing in place")
+	}
+	if data, _ := os.ReadFile(link); string(data) != "new" {
+		t.Errorf("the other link holds %q, want %q", data, "new")
+	}
+}
@@ -0,0 +1,126 @@
+package editor
+
+import "time"
+
+// Attribute is a foreground or background cell attribute. The values match
+// termbox2's so the terminal backend can pass them through unchanged.
+type Attribute uint16
+
+const (
+	ColorDefault Attribute = 0x0000
+	ColorBlack   Attribute = 0x0001
+	ColorRed     Attribute = 0x0002
+	ColorGreen   Attribute = 0x0003
+	ColorYellow  Attribute = 0x0004
+	ColorBlue    Attribute = 0x0005
+	ColorMagenta Attribute = 0x0006
+	ColorCyan    Attribute = 0x0007
+	ColorWhite   Attribute = 0x0008
+
+	AttrBold      Attribute = 0x0100
+	AttrUnderline Attribute = 0x0200
+	AttrReverse   Attribute = 0x0400
+)
+
+type EventType uint8
+
+const (
+	EventKey EventType = iota + 1
+	EventResize
+	EventMouse
+	EventPaste
+)
+
+// Key identifies a special key. Like Attribute, the values mirror termbox2.
+type Key uint16
+
+const (
+	KeyCtrlA      Key = 0x01
+	KeyCtrlB      Key = 0x02
+	KeyCtrlC      Key = 0x03
+	KeyCtrlD      Key = 0x04
+	KeyCtrlE      Key = 0x05
+	KeyCtrlF      Key = 0x06
+	KeyCtrlG      Key = 0x07
+	KeyBackspace  Key = 0x08
+	KeyTab        Key = 0x09
+	KeyCtrlJ      Key = 0x0a
+	KeyCtrlK      Key = 0x0b
+	KeyCtrlL      Key = 0x0c
+	KeyEnter      Key = 0x0d
+	KeyCtrlN      Key = 0x0e
+	KeyCtrlO      Key = 0x0f
+	KeyCtrlP      Key = 0x10
+	KeyCtrlQ      Key = 0x11
+	KeyCtrlR      Key = 0x12
+	KeyCtrlS      Key = 0x13
+	KeyCtrlT      Key = 0x14
+	KeyCtrlU      Key = 0x15
+	KeyCtrlV      Key = 0x16
+	KeyCtrlW      Key = 0x17
+	KeyCtrlX      Key = 0x18
+	KeyCtrlY      Key = 0x19
+	KeyCtrlZ      Key = 0x1a
+	KeyEsc        Key = 0x1b
+	KeySpace      Key = 0x20
+	KeyBackspace2 Key = 0x7f
+
+	KeyInsert       Key = 0xffff - 12
+	KeyDelete       Key = 0xffff - 13
+	KeyHome         Key = 0xffff - 14
+	KeyEnd          Key = 0xffff - 15
+	KeyPgUp         Key = 0xffff - 16
+	KeyPgDn         Key = 0xffff - 17
+	KeyArrowUp      Key = 0xffff - 18
+	KeyArrowDown    Key = 0xffff - 19
+	KeyArrowLeft    Key = 0xffff - 20
+	KeyArrowRight   Key = 0xffff - 21
+	KeyBackTab      Key = 0xffff - 22
+	KeyMouseLeft    Key = 0xffff - 23
+	KeyMouseRight   Key = 0xffff - 24
+	KeyMouseMiddle  Key = 0xffff - 25
+	KeyMouseRelease Key = 0xffff - 26
+	KeyWheelUp      Key = 0xffff - 27
+	KeyWheelDown    Key = 0xffff - 28
+)
+
+const (
+	ModAlt   uint8 = 0x01
+	ModCtrl  uint8 = 0x02
+	ModShift uint8 = 0x04
+)
+
+// Event is an input event delivered by a Screen. Key is set for special
+// keys and Ch for printable characters. Text holds the text of an
+// EventPaste, with line breaks as \n.
+type Event struct {
+	Type   EventType
+	Mod    uint8
+	Key    Key
+	Ch     rune
+	Width  int
+	Height int
+	X      int
+	Y      int
+	Text   string
+}
+
+// Screen is the drawing surface and input source the editor renders to.
+// Cursor coordinates of -1, -1 hide the cursor. PeekEvent waits at most
+// timeout for an event and reports false if none arrived.
+type Screen interface {
+	Size() (width, height int)
+	SetCell(x, y int, ch rune, fg, bg Attribute)
+	SetCursor(x, y int)
+	Clear()
+	Present()
+	PollEvent() Event
+	PeekEvent(timeout time.Duration) (Event, bool)
+	Close()
+}
+
+// escapeWriter is implemented by screens that can send escape sequences
+// straight to the terminal, such as the one that sets the clipboard.
+type escapeWriter interface {
+	WriteEscape(seq string)
+}
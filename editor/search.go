@@ -0,0 +1,141 @@
+package editor
+
+import (
+	"bytes"
+	"errors"
+	"slices"
+	"unicode/utf8"
+)
+
+// Match is an occurrence of a search pattern. Column and Length count runes.
+type Match struct {
+	Row    int
+	Column int
+	Length int
+}
+
+// FindAll returns the occurrences of pattern in the buffer in order, each
+// starting after the previous one ends. Lines of large files are scanned
+// without being kept in memory.
+func (b *Buffer) FindAll(pattern string) []Match {
+	if pattern == "" {
+		return nil
+	}
+	needle := encodeLine(nil, []rune(pattern))
+	length := utf8.RuneCountInString(pattern)
+	var matches []Match
+	b.lines.eachLineFrom(0, false, func(row int, line []byte) error {
+		matches = lineMatches(matches, line, needle, row, length)
+		return nil
+	})
+	return matches
+}
+
+// FindInRow returns the occurrences of pattern on row, as FindAll finds
+// them.
+func (b *Buffer) FindInRow(pattern string, row int) []Match {
+	if pattern == "" || row < 0 || row >= b.LineCount() {
+		return nil
+	}
+	needle := encodeLine(nil, []rune(pattern))
+	return lineMatches(nil, b.lines.line(row), needle, row, utf8.RuneCountInString(pattern))
+}
+
+// errStopScan ends the scan of FindNext early.
+var errStopScan = errors.New("scan stopped")
+
+// FindNext returns the match of pattern that nextMatch would choose among
+// those of FindAll, and whether the search wrapped around the end of the
+// buffer to reach it, but reads only the lines from row up to it. The last
+// result is false if there is no match at all.
+func (b *Buffer) FindNext(pattern string, row, column int, backward bool) (Match, bool, bool) {
+	if pattern == "" {
+		return Match{}, false, false
+	}
+	needle := encodeLine(nil, []rune(pattern))
+	length := utf8.RuneCountInString(pattern)
+	// ahead reports whether m lies past the cursor in the direction of the
+	// search.
+	ahead := func(m Match) bool {
+		if backward {
+			return m.Row < row || m.Column < column
+		}
+		return m.Row > row || m.Column > column
+	}
+	// scan goes through the lines from start to end in the direction of the
+	// search, and stops at the first match that counts.
+	var match Match
+	scan := func(start, end int, counts func(Match) bool) bool {
+		found := false
+		b.lines.eachLineFrom(start, backward, func(r int, line []byte) error {
+			if backward && r < end || !backward && r > end {
+				return errStopScan
+			}
+			matches := lineMatches(nil, line, needle, r, length)
+			if backward {
+				slices.Reverse(matches)
+			}
+			for _, m := range matches {
+				if counts(m) {
+					match, found = m, true
+					return errStopScan
+				}
+			}
+			return nil
+		})
+		return found
+	}
+	first := func(Match) bool { return true }
+	if backward {
+		if scan(row, 0, ahead) {
+			return match, false, true
+		}
+		found := scan(b.LineCount()-1, row, first)
+		return match, true, found
+	}
+	if scan(row, b.LineCount()-1, ahead) {
+		return match, false, true
+	}
+	found := scan(0, row, first)
+	return match, true, found
+}
+
+// lineMatches appends the occurrences of needle, a pattern length runes
+// long, in line, the bytes of row, to matches.
+func lineMatches(matches []Match, line, needle []byte, row, length int) []Match {
+	line = bytes.TrimSuffix(line, []byte("\r"))
+	column, offset := 0, 0
+	for {
+		i := bytes.Index(line[offset:], needle)
+		if i < 0 {
+			return matches
+		}
+		column += utf8.RuneCount(line[offset : offset+i])
+		matches = append(matches, Match{Row: row, Column: column, Length: length})
+		column += length
+		offset += i + len(needle)
+	}
+}
+
+// nextMatch returns the index of the first match after row and column, or
+// with backward the last one before them. When there is none it wraps
+// around to the other end of matches and reports that it did.
+func nextMatch(matches []Match, row, column int, backward bool) (int, bool) {
+	before := func(m Match) bool {
+		return m.Row < row || (m.Row == row && m.Column < column)
+	}
+	if backward {
+		for i := len(matches) - 1; i >= 0; i-- {
+			if before(matches[i]) {
+				return i, false
+			}
+		}
+		return len(matches) - 1, true
+	}
+	for i, m := range matches {
+		if !before(m) && (m.Row != row || m.Column != column) {
+			return i, false
+		}
+	}
+	return 0, true
+}
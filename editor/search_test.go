@@ -0,0 +1,67 @@
+package editor
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFindNextAgreesWithFindAll(t *testing.T) {
+	b := newTestBuffer("ab ab\nno\r\nxab\n\nab")
+	for _, pattern := range []string{"ab", "b", "no", "zz"} {
+		matches := b.FindAll(pattern)
+		for _, backward := range []bool{false, true} {
+			for row := range b.LineCount() {
+				for column := range len(b.Line(row)) + 1 {
+					m, wrapped, ok := b.FindNext(pattern, row, column, backward)
+					if len(matches) == 0 {
+						if ok {
+							t.Errorf("FindNext(%q) found %v, want none", pattern, m)
+						}
+						continue
+					}
+					i, wantWrapped := nextMatch(matches, row, column, backward)
+					if !ok || m != matches[i] || wrapped != wantWrapped {
+						t.Errorf("FindNext(%q, %d, %d, %v) = %v, %v, %v, want %v, %v",
+							pattern, row, column, backward, m, wrapped, ok, matches[i], wantWrapped)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestIncrementalSearchSkipsFullScan(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	path := filepath.Join(t.TempDir(), "large.txt")
+	lines := writeLargeFile(t, path, "line")
+	e := NewEditor(NewMemoryScreen(80, 8))
+	e.Open(path)
+	defer e.Buffer().Close()
+
+	typeKeys(e, "/line 12")
+	e.Draw()
+	if b := e.Buffer(); b.Row != 12 || b.Column != 0 {
+		t.Errorf("cursor at %d,%d while typing, want 12,0", b.Row, b.Column)
+	}
+	if e.searchMatches.pattern != "" {
+		t.Error("typing the pattern searched the whole buffer")
+	}
+	if got := e.Buffer().FindInRow("line 12", 120); len(got) != 1 || got[0].Column != 0 {
+		t.Errorf("FindInRow(120) = %v, want one match at column 0", got)
+	}
+
+	e.HandleEvent(Event{Type: EventKey, Key: KeyEnter})
+	if e.searchMatches.pattern != "line 12" {
+		t.Error("Enter did not find every match")
+	}
+	if !strings.HasPrefix(e.message, "match 1 of ") {
+		t.Errorf("message after Enter = %q, want the match count", e.message)
+	}
+
+	// Going back from the last line streams the leaves in reverse.
+	m, wrapped, ok := e.Buffer().FindNext("line 0", lines-1, 0, true)
+	if !ok || wrapped || m.Row != 0 {
+		t.Errorf("FindNext backward = %v, %v, %v, want row 0 without wrapping", m, wrapped, ok)
+	}
+}
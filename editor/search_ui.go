@@ -0,0 +1,203 @@
+package editor
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/mattn/go-runewidth"
+)
+
+// searchView is the pattern typed after '/' or '?' in the status bar row.
+// The cursor jumps to the nearest match as it is typed and returns to the
+// origin when the search is cancelled. Until Enter, only the matches on
+// screen are looked for, so typing stays fast in large files; Enter finds
+// them all to count them.
+type searchView struct {
+	input    []rune
+	backward bool
+
+	originRow, originColumn       int
+	originOffsetRow, originOffset int
+}
+
+// searchCache keeps the matches of a pattern until the buffer changes.
+type searchCache struct {
+	pattern string
+	lines   *lineStore
+	changes int
+	matches []Match
+}
+
+func (e *Editor) openSearch(backward bool) {
+	b := e.Buffer()
+	e.search = searchView{
+		backward:        backward,
+		originRow:       b.Row,
+		originColumn:    b.Column,
+		originOffsetRow: e.window.offsetRow,
+		originOffset:    e.window.offsetColumn,
+	}
+	e.mode = ModeSearch
+}
+
+// findMatches returns the matches of pattern in the current buffer.
+func (e *Editor) findMatches(pattern string) []Match {
+	b := e.Buffer()
+	cache := &e.searchMatches
+	if cache.pattern != pattern || cache.lines != b.lines || cache.changes != b.changes {
+		*cache = searchCache{pattern: pattern, lines: b.lines, changes: b.changes, matches: b.FindAll(pattern)}
+	}
+	return cache.matches
+}
+
+// highlightPattern returns the pattern whose matches displayText shows, or
+// "" if none are shown.
+func (e *Editor) highlightPattern() string {
+	if e.mode == ModeSearch {
+		return string(e.search.input)
+	}
+	if e.highlightSearch {
+		return e.lastSearch
+	}
+	return ""
+}
+
+// rowMatches returns the matches of the highlighted pattern on row, or the
+// pending replacement while replacements are being confirmed.
+func (e *Editor) rowMatches(row int) []Match {
+	if m := e.replace.match; e.mode == ModeReplace && m.Row == row {
+		return []Match{{Row: row, Column: m.Column, Length: len(m.Replacement)}}
+	}
+	pattern := e.highlightPattern()
+	if pattern == "" {
+		return nil
+	}
+	if e.mode == ModeSearch {
+		return e.Buffer().FindInRow(pattern, row)
+	}
+	matches := e.findMatches(pattern)
+	start := sort.Search(len(matches), func(i int) bool { return matches[i].Row >= row })
+	end := start
+	for end < len(matches) && matches[end].Row == row {
+		end++
+	}
+	return matches[start:end]
+}
+
+// jumpToMatch moves the cursor to the match of pattern after row and
+// column, or before them if backward, and reports which one it is.
+func (e *Editor) jumpToMatch(pattern string, backward bool, row, column int) bool {
+	matches := e.findMatches(pattern)
+	if len(matches) == 0 {
+		e.setMessage("Pattern not found: " + pattern)
+		return false
+	}
+	i, wrapped := nextMatch(matches, row, column, backward)
+	b := e.Buffer()
+	b.Row, b.Column = matches[i].Row, matches[i].Column
+	message := fmt.Sprintf("match %d of %d", i+1, len(matches))
+	if wrapped && backward {
+		message += " (wrapped to bottom)"
+	} else if wrapped {
+		message += " (wrapped to top)"
+	}
+	e.setMessage(message)
+	return true
+}
+
+// repeatSearch jumps to the next match of the last search, in the direction
+// it was made in or, with reverse, the other one.
+func (e *Editor) repeatSearch(reverse bool) {
+	if e.lastSearch == "" {
+		e.setMessage("No previous search")
+		return
+	}
+	b := e.Buffer()
+	e.highlightSearch = true
+	e.jumpToMatch(e.lastSearch, e.lastSearchBackward != reverse, b.Row, b.Column)
+}
+
+func (e *Editor) displaySearch() {
+	prompt := "/"
+	if e.search.backward {
+		prompt = "?"
+	}
+	e.printCell(0, e.rows, CurrentTheme.Foreground, CurrentTheme.Background, runewidth.FillRight(prompt+string(e.search.input), e.cols))
+	if e.message != "" {
+		e.printCell(e.cols-runewidth.StringWidth(e.message)-1, e.rows, CurrentTheme.StatusInfoFg, CurrentTheme.StatusInfoBg, e.message)
+	}
+}
+
+// searchCursor returns the screen column of the cursor in the search prompt.
+func (e *Editor) searchCursor() int {
+	return 1 + runewidth.StringWidth(string(e.search.input))
+}
+
+func (e *Editor) processSearchEvent(event Event) {
+	view := &e.search
+	switch {
+	case event.Key == KeyEsc:
+		e.cancelSearch()
+	case event.Key == KeyEnter:
+		pattern := string(view.input)
+		if pattern == "" {
+			pattern = e.lastSearch
+		}
+		e.cancelSearch()
+		if pattern == "" {
+			return
+		}
+		e.lastSearch = pattern
+		e.lastSearchBackward = view.backward
+		e.highlightSearch = true
+		e.jumpToMatch(pattern, view.backward, view.originRow, view.originColumn)
+	case event.Key == KeyBackspace || event.Key == KeyBackspace2:
+		if len(view.input) == 0 {
+			e.cancelSearch()
+			return
+		}
+		view.input = view.input[:len(view.input)-1]
+		e.incrementalSearch()
+	case event.Key == KeySpace:
+		view.input = append(view.input, ' ')
+		e.incrementalSearch()
+	case event.Ch != 0:
+		view.input = append(view.input, event.Ch)
+		e.incrementalSearch()
+	}
+}
+
+// incrementalSearch moves the cursor to the match nearest the origin of the
+// pattern typed so far, or back to the origin if there is none. Only the
+// lines up to that match are read.
+func (e *Editor) incrementalSearch() {
+	view := &e.search
+	b := e.Buffer()
+	b.Row, b.Column = view.originRow, view.originColumn
+	e.window.offsetRow, e.window.offsetColumn = view.originOffsetRow, view.originOffset
+	e.setMessage("")
+	pattern := string(view.input)
+	if pattern == "" {
+		return
+	}
+	m, wrapped, ok := b.FindNext(pattern, view.originRow, view.originColumn, view.backward)
+	switch {
+	case !ok:
+		e.setMessage("Pattern not found: " + pattern)
+		return
+	case wrapped && view.backward:
+		e.setMessage("wrapped to bottom")
+	case wrapped:
+		e.setMessage("wrapped to top")
+	}
+	b.Row, b.Column = m.Row, m.Column
+}
+
+// cancelSearch leaves the search prompt with the cursor where it started.
+func (e *Editor) cancelSearch() {
+	view := &e.search
+	b := e.Buffer()
+	b.Row, b.Column = view.originRow, view.originColumn
+	e.window.offsetRow, e.window.offsetColumn = view.originOffsetRow, view.originOffset
+	e.mode = ModeEditor
+}
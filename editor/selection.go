@@ -0,0 +1,306 @@
+package editor
+
+import (
+	"strings"
+	"unicode"
+)
+
+// selecting reports whether one of the visual modes is selecting text.
+func (e *Editor) selecting() bool {
+	return e.editMode == EditVisual || e.editMode == EditVisualLine || e.editMode == EditVisualBlock
+}
+
+// startSelection enters the visual mode, with the selection anchored at the
+// cursor. Switching from another visual mode keeps the anchor, and entering
+// the one already active leaves it.
+func (e *Editor) startSelection(mode EditMode) {
+	switch {
+	case e.editMode == mode:
+		e.endSelection()
+	case e.selecting():
+		e.editMode = mode
+	default:
+		b := e.Buffer()
+		e.anchorRow, e.anchorColumn = b.Row, b.Column
+		e.editMode = mode
+	}
+}
+
+// endSelection returns to normal mode and remembers the selected lines for
+// the '< and '> addresses of the command line.
+func (e *Editor) endSelection() {
+	if !e.selecting() {
+		return
+	}
+	first, last := e.selectedRows()
+	e.lastSelection = [2]int{first, last}
+	e.hasLastSelection = true
+	e.editMode = EditNormal
+}
+
+// selectedRows returns the first and last row of the selection.
+func (e *Editor) selectedRows() (int, int) {
+	b := e.Buffer()
+	first, last := min(e.anchorRow, b.Row), max(e.anchorRow, b.Row)
+	return first, min(last, b.LineCount()-1)
+}
+
+// selectionSpan is the part of one row that is selected, in runes. end is
+// past the end of the line when the line break is selected too.
+type selectionSpan struct {
+	row, start, end int
+}
+
+// selectedSpan returns the selected part of row, or false if none of it is
+// selected.
+func (e *Editor) selectedSpan(row int) (selectionSpan, bool) {
+	if !e.selecting() {
+		return selectionSpan{}, false
+	}
+	b := e.Buffer()
+	first, last := e.selectedRows()
+	if row < first || row > last {
+		return selectionSpan{}, false
+	}
+	length := len(b.Line(row))
+	span := selectionSpan{row: row, start: 0, end: length + 1}
+	switch e.editMode {
+	case EditVisual:
+		startRow, startColumn, endRow, endColumn := e.anchorRow, e.anchorColumn, b.Row, b.Column
+		if endRow < startRow || (endRow == startRow && endColumn < startColumn) {
+			startRow, startColumn, endRow, endColumn = endRow, endColumn, startRow, startColumn
+		}
+		if row == startRow {
+			span.start = startColumn
+		}
+		if row == endRow {
+			span.end = endColumn + 1
+		}
+	case EditVisualBlock:
+		anchorCol := e.runeIndexToDisplayCol(e.anchorRow, e.anchorColumn)
+		cursorCol := e.runeIndexToDisplayCol(b.Row, b.Column)
+		span.start = e.displayColToRuneIndex(row, min(anchorCol, cursorCol))
+		span.end = min(e.displayColToRuneIndex(row, max(anchorCol, cursorCol))+1, length)
+		if span.start >= span.end {
+			span.start, span.end = length, length
+		}
+	}
+	return span, true
+}
+
+// selectionSpans returns the selected part of every selected row.
+func (e *Editor) selectionSpans() []selectionSpan {
+	first, last := e.selectedRows()
+	spans := make([]selectionSpan, 0, last-first+1)
+	for row := first; row <= last; row++ {
+		if span, ok := e.selectedSpan(row); ok {
+			spans = append(spans, span)
+		}
+	}
+	return spans
+}
+
+// selectedText returns a copy of the selection.
+func (e *Editor) selectedText() copiedText {
+	b := e.Buffer()
+	text := copiedText{kind: e.editMode}
+	var current []rune
+	for _, span := range e.selectionSpans() {
+		line := b.Line(span.row)
+		part := line[min(span.start, len(line)):min(span.end, len(line))]
+		switch e.editMode {
+		case EditVisual:
+			current = joinRunes(current, part)
+			if span.end > len(line) {
+				text.lines = append(text.lines, current)
+				current = nil
+			}
+		default:
+			text.lines = append(text.lines, joinRunes(part))
+		}
+	}
+	if e.editMode == EditVisual {
+		text.lines = append(text.lines, joinRunes(current))
+	}
+	return text
+}
+
+// copySelection copies the selection and leaves visual mode with the cursor
+// at its start.
+func (e *Editor) copySelection() {
+	e.storeCopy(e.selectedText(), false)
+	e.moveToSelectionStart()
+	e.endSelection()
+}
+
+// deleteSelection copies the selection, removes it from the buffer and
+// leaves visual mode.
+func (e *Editor) deleteSelection() {
+	b := e.Buffer()
+	e.storeCopy(e.selectedText(), true)
+	spans := e.selectionSpans()
+	first, last := spans[0], spans[len(spans)-1]
+	b.edit(func() {
+		switch e.editMode {
+		case EditVisual:
+			endRow, endColumn := last.row, last.end
+			if endColumn > len(b.Line(endRow)) {
+				if endRow < b.LineCount()-1 {
+					endRow, endColumn = endRow+1, 0
+				} else {
+					endColumn = len(b.Line(endRow))
+				}
+			}
+			head := b.Line(first.row)[:first.start]
+			tail := b.Line(endRow)[endColumn:]
+			b.replaceLines(first.row, endRow-first.row+1, [][]rune{joinRunes(head, tail)})
+			b.Row, b.Column = first.row, first.start
+		case EditVisualLine:
+			if last.row-first.row+1 == b.LineCount() {
+				b.replaceLines(0, b.LineCount(), [][]rune{{}})
+			} else {
+				b.replaceLines(first.row, last.row-first.row+1, nil)
+			}
+			b.Row, b.Column = min(first.row, b.LineCount()-1), 0
+		case EditVisualBlock:
+			for _, span := range spans {
+				line := b.Line(span.row)
+				if span.start < len(line) {
+					b.replaceLines(span.row, 1, [][]rune{joinRunes(line[:span.start], line[span.end:])})
+				}
+			}
+			b.Row, b.Column = first.row, first.start
+		}
+	})
+	e.endSelection()
+	b.clampCursor()
+}
+
+// changeSelection deletes the selection and enters insert mode in its
+// place. Selected lines are replaced by an empty line, and the deletion
+// and what is typed are undone together.
+func (e *Editor) changeSelection() {
+	b := e.Buffer()
+	linewise := e.editMode == EditVisualLine
+	first, last := e.selectedRows()
+	whole := last-first+1 == b.LineCount()
+	b.BeginUndoGroup()
+	e.deleteSelection()
+	if linewise && !whole {
+		b.replaceLines(first, 0, [][]rune{{}})
+		b.Row, b.Column = first, 0
+	}
+	e.editMode = EditInsert
+}
+
+// changeSelectionCase applies convert to every selected character and
+// leaves visual mode.
+func (e *Editor) changeSelectionCase(convert func(rune) rune) {
+	b := e.Buffer()
+	b.edit(func() {
+		for _, span := range e.selectionSpans() {
+			line := b.Line(span.row)
+			changed := joinRunes(line)
+			for i := span.start; i < min(span.end, len(line)); i++ {
+				changed[i] = convert(line[i])
+			}
+			if string(changed) != string(line) {
+				b.replaceLines(span.row, 1, [][]rune{changed})
+			}
+		}
+	})
+	e.moveToSelectionStart()
+	e.endSelection()
+}
+
+// toggleCase returns the upper case of a lower case letter and the lower
+// case of anything else.
+func toggleCase(r rune) rune {
+	if unicode.IsLower(r) {
+		return unicode.ToUpper(r)
+	}
+	return unicode.ToLower(r)
+}
+
+// indentSelection adds a tab to the start of every selected line that is
+// not empty, or with outdent removes a tab or up to a tab's width of
+// spaces, and leaves visual mode.
+func (e *Editor) indentSelection(outdent bool) {
+	b := e.Buffer()
+	first, last := e.selectedRows()
+	b.edit(func() {
+		for row := first; row <= last; row++ {
+			line := b.Line(row)
+			switch {
+			case !outdent && len(line) > 0:
+				b.replaceLines(row, 1, [][]rune{joinRunes([]rune{'\t'}, line)})
+			case outdent && len(line) > 0 && line[0] == '\t':
+				b.replaceLines(row, 1, [][]rune{joinRunes(line[1:])})
+			case outdent:
+				spaces := 0
+				for spaces < len(line) && line[spaces] == ' ' {
+					spaces++
+				}
+				if n := min(spaces, editSettings.TabSize); n > 0 {
+					b.replaceLines(row, 1, [][]rune{joinRunes(line[n:])})
+				}
+			}
+		}
+		b.Row, b.Column = first, 0
+	})
+	e.endSelection()
+}
+
+// swapSelectionEnds moves the cursor to the anchor and the anchor to where
+// the cursor was, so the selection can be extended at its other end.
+func (e *Editor) swapSelectionEnds() {
+	b := e.Buffer()
+	b.Row, b.Column, e.anchorRow, e.anchorColumn = e.anchorRow, e.anchorColumn, b.Row, b.Column
+	b.clampCursor()
+}
+
+func (e *Editor) moveToSelectionStart() {
+	b := e.Buffer()
+	span := e.selectionSpans()[0]
+	b.Row, b.Column = span.row, min(span.start, len(b.Line(span.row)))
+}
+
+// pasteText inserts text at the cursor as its kind says.
+func (e *Editor) pasteText(text copiedText) {
+	b := e.Buffer()
+	b.edit(func() {
+		switch text.kind {
+		case EditVisual:
+			line := b.Line(b.Row)
+			lines := make([][]rune, len(text.lines))
+			for i, part := range text.lines {
+				lines[i] = joinRunes(part)
+			}
+			lines[0] = joinRunes(line[:b.Column], lines[0])
+			lines[len(lines)-1] = joinRunes(lines[len(lines)-1], line[b.Column:])
+			b.replaceLines(b.Row, 1, lines)
+		case EditVisualBlock:
+			col := e.runeIndexToDisplayCol(b.Row, b.Column)
+			for i, part := range text.lines {
+				row := b.Row + i
+				if row == b.LineCount() {
+					b.replaceLines(row, 0, [][]rune{{}})
+				}
+				line := b.Line(row)
+				index := e.displayColToRuneIndex(row, col)
+				var padding []rune
+				if width := e.runeIndexToDisplayCol(row, len(line)); width < col {
+					padding = []rune(strings.Repeat(" ", col-width))
+				}
+				b.replaceLines(row, 1, [][]rune{joinRunes(line[:index], padding, part, line[index:])})
+			}
+		default:
+			lines := make([][]rune, len(text.lines))
+			for i, line := range text.lines {
+				lines[i] = joinRunes(line)
+			}
+			b.replaceLines(b.Row, 0, lines)
+			b.Column = 0
+		}
+	})
+}
@@ -0,0 +1,85 @@
+package editor
+
+import "testing"
+
+func pressKey(e *Editor, key Key) {
+	e.HandleEvent(Event{Type: EventKey, Key: key})
+}
+
+func TestOutdentSelection(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	useSettings(t, Settings{TabSize: 4, Theme: "one-dark"})
+	e := NewEditor(NewMemoryScreen(80, 8))
+	b := newTestBuffer("  éé\n\tx\n      y\nz")
+	e.buffers, e.window.buffer = []*Buffer{b}, b
+	typeKeys(e, "VG<")
+	if got, want := bufferText(b), "éé\nx\n  y\nz"; got != want {
+		t.Errorf("buffer = %q, want %q", got, want)
+	}
+}
+
+func TestVisualModes(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	useSettings(t, Settings{TabSize: 4, Theme: "one-dark", Clipboard: "none"})
+	tests := []struct {
+		name     string
+		run      func(e *Editor)
+		want     string
+		register string
+	}{
+		{"copy characters", func(e *Editor) { typeKeys(e, "vey") }, "one two\nthree four\nfive", "one"},
+		{"delete characters to a word", func(e *Editor) { typeKeys(e, "vwd") }, "wo\nthree four\nfive", "one t"},
+		{"delete characters across lines", func(e *Editor) {
+			typeKeys(e, "wv")
+			pressKey(e, KeyArrowDown)
+			typeKeys(e, "d")
+		}, "one  four\nfive", "two\nthree"},
+		{"delete a line", func(e *Editor) { typeKeys(e, "Vd") }, "three four\nfive", "one two\n"},
+		{"delete every line", func(e *Editor) { typeKeys(e, "VGd") }, "", "one two\nthree four\nfive\n"},
+		{"delete a block", func(e *Editor) {
+			pressKey(e, KeyCtrlV)
+			pressKey(e, KeyArrowDown)
+			pressKey(e, KeyArrowRight)
+			pressKey(e, KeyArrowRight)
+			typeKeys(e, "d")
+		}, " two\nee four\nfive", "one\nthr"},
+		{"switch from lines to characters", func(e *Editor) { typeKeys(e, "Vevd") }, " two\nthree four\nfive", "one"},
+		{"other end", func(e *Editor) { typeKeys(e, "wveobd") }, "\nthree four\nfive", "one two"},
+		{"toggle case", func(e *Editor) { typeKeys(e, "v$~") }, "ONE TWO\nthree four\nfive", ""},
+		{"upper and lower case", func(e *Editor) { typeKeys(e, "VUveu") }, "one TWO\nthree four\nfive", ""},
+		{"change lines", func(e *Editor) {
+			typeKeys(e, "Vcnew")
+			pressKey(e, KeyEsc)
+		}, "new\nthree four\nfive", "one two\n"},
+		{"paste a block", func(e *Editor) {
+			pressKey(e, KeyCtrlV)
+			pressKey(e, KeyArrowDown)
+			typeKeys(e, "y")
+			typeKeys(e, "$p")
+		}, "one twoo\nthree ftour\nfive", "o\nt"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := NewEditor(NewMemoryScreen(80, 8))
+			b := newTestBuffer("one two\nthree four\nfive")
+			e.buffers, e.window.buffer = []*Buffer{b}, b
+			tt.run(e)
+			if got := bufferText(b); got != tt.want {
+				t.Errorf("buffer = %q, want %q", got, tt.want)
+			}
+			if e.selecting() {
+				t.Error("still selecting")
+			}
+			if tt.register == "" {
+				return
+			}
+			if text, _ := e.registers.get(unnamedRegister); text.String() != tt.register {
+				t.Errorf("register holds %q, want %q", text.String(), tt.register)
+			}
+			// Each of these is at most one undo step.
+			if b.Undo(); bufferText(b) != "one two\nthree four\nfive" {
+				t.Errorf("after undo, buffer = %q", bufferText(b))
+			}
+		})
+	}
+}
@@ -8,17 +8,37 @@ import (
 )
 
 type Settings struct {
-	TabSize int    `json:"tab_size"`
-	Theme   string `json:"theme"`
+	TabSize   int    `json:"tab_size"`
+	Theme     string `json:"theme"`
+	Clipboard string `json:"clipboard"`
+
+	// LineNumbers is one of lineNumberSettings. New settings files get
+	// absolute numbers; one written before the gutter existed, without
+	// the key, gets none, so the text does not move for its user.
+	LineNumbers string `json:"line_numbers"`
+
+	// Keymaps maps a mode to key sequences and the names of the actions
+	// they run, put over the default bindings.
+	Keymaps map[string]map[string]string `json:"keymaps,omitempty"`
 }
 
-func LoadSettings() (*Settings, error) {
+// configDir returns the directory holding settings.json and the other
+// files the editor keeps between sessions.
+func configDir() (string, error) {
 	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(homeDir, ".gocodeeditor"), nil
+}
+
+func LoadSettings() (*Settings, error) {
+	dir, err := configDir()
 	if err != nil {
 		return nil, err
 	}
 
-	configPath := filepath.Join(homeDir, ".gocodeeditor", "settings.json")
+	configPath := filepath.Join(dir, "settings.json")
 
 	if err := os.MkdirAll(filepath.Dir(configPath), 0755); err != nil {
 		return nil, err
@@ -26,8 +46,10 @@ func LoadSettings() (*Settings, error) {
 
 	if _, err := os.Stat(configPath); os.IsNotExist(err) {
 		defaultSettings := &Settings{
-			TabSize: 4,
-			Theme:   "one-dark",
+			TabSize:     4,
+			Theme:       "one-dark",
+			Clipboard:   "auto",
+			LineNumbers: "absolute",
 		}
 		return defaultSettings, SaveSettings(defaultSettings)
 	}
@@ -41,17 +63,20 @@ func LoadSettings() (*Settings, error) {
 	if err := json.Unmarshal(data, &settings); err != nil {
 		return nil, err
 	}
+	if settings.LineNumbers == "" {
+		settings.LineNumbers = "off"
+	}
 
 	return &settings, nil
 }
 
 func SaveSettings(settings *Settings) error {
-	homeDir, err := os.UserHomeDir()
+	dir, err := configDir()
 	if err != nil {
 		return err
 	}
 
-	configPath := filepath.Join(homeDir, ".gocodeeditor", "settings.json")
+	configPath := filepath.Join(dir, "settings.json")
 
 	if err := os.MkdirAll(filepath.Dir(configPath), 0755); err != nil {
 		return err
@@ -0,0 +1,242 @@
+package editor
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"syscall"
+	"time"
+)
+
+// Swap files protect unsaved changes against a crash. While a buffer is
+// modified its undo tree, the node it is at and the edits of an open insert
+// session are written under ~/.gocodeeditor/swap, named like the undo files
+// after a hash of the absolute path and, like them, readable only by the
+// user. The tree is stored relative to the file on disk, identified by its
+// content hash, so recovering reopens the file and replays the history
+// onto it. A buffer held in memory is also written whole, so its changes
+// can still be recovered when the file was changed by another program
+// after the crash. Large files read lazily are not copied; their changes
+// can only be restored onto the version they were made to. When no state
+// in the history matches the file on disk, because the user chose to keep
+// their changes over a newer version, only the whole buffer is written.
+
+// swapChangeCount is the number of changes after which the swap file is
+// written even while typing continues. Otherwise it waits for idleTime
+// without input.
+const swapChangeCount = 100
+
+type savedSwap struct {
+	PID     int              `json:"pid"`
+	Host    string           `json:"host"`
+	Time    time.Time        `json:"time"`
+	Row     int              `json:"row"`
+	Column  int              `json:"column"`
+	Target  int              `json:"target"`
+	History savedUndoHistory `json:"history"`
+
+	// Pending holds the changes of an undo group that was still open,
+	// which start from the cursor at PendingRow and PendingColumn.
+	Pending       []savedChange `json:"pending"`
+	PendingRow    int           `json:"pending_row"`
+	PendingColumn int           `json:"pending_column"`
+
+	// Format is how the buffer is to be saved. Its encoding is also the
+	// one History was recorded in. Lines holds the whole buffer if it was
+	// in memory or History could not be stored.
+	Format *FileFormat `json:"format,omitempty"`
+	Lines  [][]byte    `json:"lines,omitempty"`
+}
+
+func swapFilePath(path string) (string, string, error) {
+	return perFilePath("swap", path)
+}
+
+// updateSwap writes the swap file if the buffer has changed since it was
+// last written, and removes it once the buffer is no longer modified.
+// Unless idle is set, writing waits for swapChangeCount changes.
+func (b *Buffer) updateSwap(idle bool) error {
+	pending := b.changes - b.swapChanges
+	if pending == 0 {
+		return nil
+	}
+	if !b.Modified {
+		b.removeSwap()
+		return nil
+	}
+	if !idle && pending < swapChangeCount {
+		return nil
+	}
+	return b.writeSwap()
+}
+
+func (b *Buffer) writeSwap() error {
+	if b.swapKept {
+		return nil
+	}
+	swapPath, absPath, err := swapFilePath(b.Path)
+	if err != nil {
+		return err
+	}
+	b.history.init()
+	host, _ := os.Hostname()
+	swap := savedSwap{
+		PID:    os.Getpid(),
+		Host:   host,
+		Time:   time.Now(),
+		Row:    b.Row,
+		Column: b.Column,
+		Format: &b.Format,
+	}
+	if b.history.saved == nil || b.lines.inMemory() {
+		swap.Lines = [][]byte{}
+		b.lines.eachLine(func(line []byte) error {
+			swap.Lines = append(swap.Lines, bytes.Clone(line))
+			return nil
+		})
+	}
+	swap.History = savedUndoHistory{Path: absPath}
+	if b.history.saved != nil {
+		swap.History = b.encodeUndoHistory(absPath, b.disk.hash, b.history.saved)
+		swap.Target = b.history.current.seq
+	}
+	if open := b.history.open; open != nil && b.history.saved != nil {
+		swap.PendingRow, swap.PendingColumn = open.beforeRow, open.beforeColumn
+		for _, change := range open.changes {
+			swap.Pending = append(swap.Pending, savedChange{
+				Row: change.Row,
+				Old: encodeLines(change.Old),
+				New: encodeLines(change.New),
+			})
+		}
+	}
+
+	err = writePrivateFile(swapPath, func(w *bufio.Writer) error {
+		return json.NewEncoder(w).Encode(swap)
+	})
+	if err != nil {
+		return err
+	}
+	if b.swapPath != "" && b.swapPath != swapPath {
+		// The buffer was saved under a new name since.
+		os.Remove(b.swapPath)
+	}
+	b.swapChanges = b.changes
+	b.swapPath = swapPath
+	return nil
+}
+
+// keepSwap leaves the swap file found by findSwap alone. The buffer does
+// not write a swap file of its own over it.
+func (b *Buffer) keepSwap() {
+	b.swapKept = true
+	b.swapPath = ""
+}
+
+// removeSwap deletes the swap file if this buffer wrote it.
+func (b *Buffer) removeSwap() {
+	b.swapChanges = b.changes
+	if b.swapPath == "" {
+		return
+	}
+	os.Remove(b.swapPath)
+	b.swapPath = ""
+}
+
+// findSwap returns the swap file left for the buffer's file, or nil if
+// there is none.
+func (b *Buffer) findSwap() *savedSwap {
+	swapPath, absPath, err := swapFilePath(b.Path)
+	if err != nil {
+		return nil
+	}
+	data, err := os.ReadFile(swapPath)
+	if err != nil {
+		return nil
+	}
+	var swap savedSwap
+	if err := json.Unmarshal(data, &swap); err != nil || swap.History.Path != absPath {
+		return nil
+	}
+	return &swap
+}
+
+// discardSwap deletes the swap file found by findSwap.
+func (b *Buffer) discardSwap() error {
+	swapPath, _, err := swapFilePath(b.Path)
+	if err != nil {
+		return err
+	}
+	b.swapPath = ""
+	return os.Remove(swapPath)
+}
+
+// matchesDisk reports whether swap can be applied to the file as the
+// buffer read it: it holds the whole buffer, or a history written against
+// the same version.
+func (swap *savedSwap) matchesDisk(b *Buffer) bool {
+	return swap.Lines != nil || swap.historyMatches(b)
+}
+
+// historyMatches reports whether the history in swap was written against
+// the file as the buffer read it, so that undo can be restored too.
+func (swap *savedSwap) historyMatches(b *Buffer) bool {
+	return swap.History.Hash != "" && swap.History.Hash == b.disk.hash
+}
+
+// running reports whether the editor that wrote swap may still be running.
+func (swap *savedSwap) running() bool {
+	if host, _ := os.Hostname(); host != swap.Host || swap.PID == os.Getpid() {
+		return false
+	}
+	err := syscall.Kill(swap.PID, 0)
+	return err == nil || err == syscall.EPERM
+}
+
+// recoverSwap brings the buffer, freshly read from disk, to the state saved
+// in swap and takes over the swap file. It returns false if the swap file
+// does not apply to the buffer.
+func (b *Buffer) recoverSwap(swap *savedSwap) bool {
+	if !swap.matchesDisk(b) {
+		return false
+	}
+	if swap.Format != nil && swap.Format.Encoding != b.Format.Encoding {
+		if err := b.readFile(b.Path, swap.Format.Encoding); err != nil {
+			return false
+		}
+	}
+	if !swap.historyMatches(b) {
+		b.replaceLines(0, b.LineCount(), decodeLines(swap.Lines))
+		if swap.Format != nil {
+			b.Format = *swap.Format
+		}
+		b.markDiverged()
+		b.Row, b.Column = swap.Row, swap.Column
+		b.clampCursor()
+		b.swapPath, _, _ = swapFilePath(b.Path)
+		return true
+	}
+	bySeq := b.decodeUndoHistory(&swap.History)
+	if bySeq == nil {
+		return false
+	}
+	target, ok := bySeq[swap.Target]
+	if !ok {
+		return false
+	}
+	b.gotoUndoNode(target)
+	if len(swap.Pending) > 0 {
+		b.Row, b.Column = swap.PendingRow, swap.PendingColumn
+		b.BeginUndoGroup()
+		for _, change := range swap.Pending {
+			b.replaceLines(change.Row, len(change.Old), decodeLines(change.New))
+		}
+		b.Row, b.Column = swap.Row, swap.Column
+		b.EndUndoGroup()
+	}
+	b.Row, b.Column = swap.Row, swap.Column
+	b.clampCursor()
+	b.swapPath, _, _ = swapFilePath(b.Path)
+	return true
+}
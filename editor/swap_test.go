@@ -0,0 +1,134 @@
+package editor
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestSwapFileIsPrivate(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	path := filepath.Join(t.TempDir(), "secret.txt")
+	if err := os.WriteFile(path, []byte("password=hunter2\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	b, err := OpenBuffer(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	b.InsertRune('#')
+	if err := b.updateSwap(true); err != nil {
+		t.Fatal(err)
+	}
+	swapPath, _, err := swapFilePath(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkMode(t, swapPath, 0600)
+	checkMode(t, filepath.Dir(swapPath), 0700|os.ModeDir)
+}
+
+// crashWithSwap opens path, makes edit and leaves a swap file behind as a
+// crash would.
+func crashWithSwap(t *testing.T, path string, edit func(b *Buffer)) {
+	t.Helper()
+	b, err := OpenBuffer(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edit(b)
+	if err := b.updateSwap(true); err != nil {
+		t.Fatal(err)
+	}
+	b.lines.close()
+}
+
+func TestRecoverSwap(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	path := filepath.Join(t.TempDir(), "notes.txt")
+	if err := os.WriteFile(path, []byte("one\ntwo\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	crashWithSwap(t, path, func(b *Buffer) { b.InsertRune('#') })
+
+	e := NewEditor(NewMemoryScreen(80, 12))
+	e.Open(path)
+	if e.mode != ModeRecovery || e.recovery.options[0] != recoverRestore {
+		t.Fatalf("mode %v with options %v, want the recovery popup offering to restore", e.mode, e.recovery.options)
+	}
+	e.HandleEvent(Event{Type: EventKey, Key: KeyEnter})
+	b := e.Buffer()
+	if got := bufferText(b); got != "#one\ntwo" {
+		t.Errorf("restored %q, want %q", got, "#one\ntwo")
+	}
+	if !b.Undo() || bufferText(b) != "one\ntwo" {
+		t.Error("the restored change cannot be undone")
+	}
+}
+
+func TestRecoverSwapAfterDiskChange(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	path := filepath.Join(t.TempDir(), "notes.txt")
+	if err := os.WriteFile(path, []byte("one\ntwo\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	crashWithSwap(t, path, func(b *Buffer) { b.InsertRune('#') })
+	if err := os.WriteFile(path, []byte("changed by someone else\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	e := NewEditor(NewMemoryScreen(80, 12))
+	e.Open(path)
+	if e.mode != ModeRecovery || e.recovery.options[0] != recoverRestore {
+		t.Fatalf("mode %v with options %v, want the recovery popup offering to restore", e.mode, e.recovery.options)
+	}
+	e.HandleEvent(Event{Type: EventKey, Key: KeyEnter})
+	b := e.Buffer()
+	if got := bufferText(b); got != "#one\ntwo" {
+		t.Errorf("restored %q, want %q", got, "#one\ntwo")
+	}
+	if !b.Modified {
+		t.Error("the restored buffer is not marked modified")
+	}
+}
+
+func TestKeepSwapOfChangedLargeFile(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	path := filepath.Join(t.TempDir(), "large.txt")
+	writeLargeFile(t, path, "original")
+	crashWithSwap(t, path, func(b *Buffer) { b.InsertRune('#') })
+	writeLargeFile(t, path, "rewritten")
+	swapPath, _, err := swapFilePath(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved, err := os.ReadFile(swapPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := NewEditor(NewMemoryScreen(80, 12))
+	e.Open(path)
+	defer e.Buffer().Close()
+	if e.mode != ModeRecovery {
+		t.Fatal("no recovery popup")
+	}
+	if want := []string{recoverKeep, recoverDiscard}; !slices.Equal(e.recovery.options, want) {
+		t.Fatalf("options %v, want %v", e.recovery.options, want)
+	}
+	e.HandleEvent(Event{Type: EventKey, Key: KeyEsc})
+	if e.mode != ModeEditor {
+		t.Fatal("Esc did not close the popup")
+	}
+
+	// Edits in this session leave the kept swap file alone.
+	e.Buffer().InsertRune('!')
+	e.updateSwapFiles(true)
+	e.Buffer().Close()
+	if data, err := os.ReadFile(swapPath); err != nil || !bytes.Equal(data, saved) {
+		t.Errorf("the kept swap file was changed or removed (%v)", err)
+	}
+}
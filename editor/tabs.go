@@ -0,0 +1,279 @@
+package editor
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/mattn/go-runewidth"
+)
+
+// tabPage is a layout of windows of its own, and the window in it with the
+// focus. The current tab page's are held by the editor while it is shown,
+// and put back when another is. Once there is more than one tab page, a
+// tab bar above the text area lists them.
+type tabPage struct {
+	layout *split
+	window *window
+}
+
+// showTabBar reports whether the tab bar takes the top row of the screen.
+func (e *Editor) showTabBar() bool {
+	return len(e.tabs) > 1
+}
+
+// allWindows returns the windows of every tab page, the current one's
+// first.
+func (e *Editor) allWindows() []*window {
+	windows := e.layout.windows()
+	for i, tab := range e.tabs {
+		if i != e.tab {
+			windows = append(windows, tab.layout.windows()...)
+		}
+	}
+	return windows
+}
+
+// leaveWindow is called before the focused window loses the focus to
+// another tab page, leaving its cursor where it was.
+func (e *Editor) leaveWindow() {
+	e.endSelection()
+	e.cancelCommand()
+	old := e.window
+	old.row, old.column = old.buffer.Row, old.buffer.Column
+	old.buffer.offsetRow, old.buffer.offsetColumn = old.offsetRow, old.offsetColumn
+	e.hasLastSelection = false
+	e.tabs[e.tab] = &tabPage{layout: e.layout, window: e.window}
+}
+
+// enterTab shows the tab page at index i.
+func (e *Editor) enterTab(i int) {
+	e.tab = i
+	e.layout, e.window = e.tabs[i].layout, e.tabs[i].window
+	b := e.window.buffer
+	b.Row, b.Column = e.window.row, e.window.column
+	b.clampCursor()
+}
+
+// switchTab shows the tab page at index i.
+func (e *Editor) switchTab(i int) {
+	if i == e.tab {
+		return
+	}
+	e.leaveWindow()
+	e.enterTab(i)
+}
+
+// cycleTab shows the tab page count places after the current one, or
+// before it if count is negative, wrapping around.
+func (e *Editor) cycleTab(count int) {
+	n := len(e.tabs)
+	e.switchTab(((e.tab+count)%n + n) % n)
+}
+
+// nextTabAction shows the next tab page, or the one numbered by the count
+// typed before it.
+func (e *Editor) nextTabAction() {
+	if e.count > 0 {
+		e.switchTab(min(e.count, len(e.tabs)) - 1)
+		return
+	}
+	e.cycleTab(1)
+}
+
+// newTab opens a tab page after the current one, holding the single window
+// w, and shows it.
+func (e *Editor) newTab(w *window) {
+	e.leaveWindow()
+	e.tabs = slices.Insert(e.tabs, e.tab+1, &tabPage{layout: &split{window: w}, window: w})
+	e.enterTab(e.tab + 1)
+}
+
+// newTabWithBuffer opens a tab page showing the buffer being edited.
+func (e *Editor) newTabWithBuffer() {
+	b := e.Buffer()
+	w := &window{buffer: b, row: b.Row, column: b.Column, offsetRow: e.window.offsetRow, offsetColumn: e.window.offsetColumn}
+	e.newTab(w)
+}
+
+// moveWindowToTab closes the focused window and opens it again in a tab
+// page of its own.
+func (e *Editor) moveWindowToTab() {
+	if e.layout.window != nil {
+		e.setMessage("The window is the only one in its tab page")
+		return
+	}
+	w := e.window
+	w.row, w.column = w.buffer.Row, w.buffer.Column
+	e.closeWindow()
+	e.newTab(w)
+}
+
+// closeTab closes the current tab page and its windows, leaving their
+// buffers open. The last tab page cannot be closed.
+func (e *Editor) closeTab() bool {
+	if len(e.tabs) == 1 {
+		e.setMessage("Cannot close the last tab page")
+		return false
+	}
+	e.leaveWindow()
+	e.tabs = slices.Delete(e.tabs, e.tab, e.tab+1)
+	e.enterTab(min(e.tab, len(e.tabs)-1))
+	return true
+}
+
+// onlyTab closes every tab page but the current one.
+func (e *Editor) onlyTab() {
+	e.tabs = []*tabPage{{layout: e.layout, window: e.window}}
+	e.tab = 0
+}
+
+// moveTab moves the current tab page to index i.
+func (e *Editor) moveTab(i int) {
+	i = min(max(i, 0), len(e.tabs)-1)
+	tab := &tabPage{layout: e.layout, window: e.window}
+	e.tabs = slices.Insert(slices.Delete(e.tabs, e.tab, e.tab+1), i, tab)
+	e.tab = i
+}
+
+// tabLabel returns how the tab page at index i is listed in the tab bar:
+// its number, the buffer of its focused window, how many windows it has
+// if more than one, and + if any of their buffers has unsaved changes.
+func (e *Editor) tabLabel(i int) string {
+	tab := e.tabs[i]
+	if i == e.tab {
+		tab = &tabPage{layout: e.layout, window: e.window}
+	}
+	windows := tab.layout.windows()
+	label := fmt.Sprintf(" %d ", i+1)
+	if len(windows) > 1 {
+		label += fmt.Sprintf("(%d) ", len(windows))
+	}
+	label += runewidth.Truncate(filepath.Base(tab.window.buffer.Path), 24, "…")
+	if slices.ContainsFunc(windows, func(w *window) bool { return w.buffer.Modified }) {
+		label += " +"
+	}
+	return label + " "
+}
+
+// tabAt returns the index of the tab page whose label is at column x of
+// the tab bar, or -1.
+func (e *Editor) tabAt(x int) int {
+	col := 0
+	for i := range e.tabs {
+		col += runewidth.StringWidth(e.tabLabel(i))
+		if x < col {
+			return i
+		}
+	}
+	return -1
+}
+
+func (e *Editor) displayTabBar() {
+	col := 0
+	for i := range e.tabs {
+		fg, bg := CurrentTheme.StatusBarFg, CurrentTheme.StatusBarBg
+		if i == e.tab {
+			fg, bg = CurrentTheme.StatusModeFg, CurrentTheme.StatusModeBg
+		}
+		label := e.tabLabel(i)
+		e.printCell(col, 0, fg, bg, label)
+		col += runewidth.StringWidth(label)
+	}
+	if col < e.cols {
+		e.printCell(col, 0, CurrentTheme.StatusBarFg, CurrentTheme.StatusBarBg, strings.Repeat(" ", e.cols-col))
+	}
+}
+
+// processMouseEvent handles a click: on the tab bar it shows the tab page
+// clicked, and in a window it gives the window the focus and moves the
+// cursor to where the click was.
+func (e *Editor) processMouseEvent(event Event) {
+	if e.mode != ModeEditor || event.Key != KeyMouseLeft {
+		return
+	}
+	if e.showTabBar() && event.Y == 0 {
+		if i := e.tabAt(event.X); i >= 0 {
+			e.switchTab(i)
+		}
+		return
+	}
+	for _, w := range e.layout.windows() {
+		if !w.contains(event.X, event.Y) {
+			continue
+		}
+		e.focusWindow(w)
+		if event.Y < w.y+w.height {
+			b := w.buffer
+			b.Row = min(w.offsetRow+event.Y-w.y, b.LineCount()-1)
+			b.Column = b.displayColToRuneIndex(b.Row, w.offsetColumn+max(event.X-w.x-w.gutter, 0), editSettings.TabSize)
+			b.clampCursor()
+		}
+		return
+	}
+}
+
+// exTabNew opens a tab page showing the file given, or the buffer being
+// edited.
+func (e *Editor) exTabNew(args exArgs) error {
+	e.newTabWithBuffer()
+	if args.arg != "" {
+		e.Open(expandHome(args.arg))
+	}
+	return nil
+}
+
+func (e *Editor) exTabClose(args exArgs) error {
+	e.closeTab()
+	return nil
+}
+
+func (e *Editor) exTabOnly(args exArgs) error {
+	e.onlyTab()
+	return nil
+}
+
+// exTabNext shows the next tab page, or the one with the number given.
+func (e *Editor) exTabNext(args exArgs) error {
+	if args.arg == "" {
+		e.cycleTab(1)
+		return nil
+	}
+	n, err := strconv.Atoi(args.arg)
+	if err != nil || n < 1 || n > len(e.tabs) {
+		return fmt.Errorf("no tab page %s", args.arg)
+	}
+	e.switchTab(n - 1)
+	return nil
+}
+
+func (e *Editor) exTabPrevious(args exArgs) error {
+	e.cycleTab(-1)
+	return nil
+}
+
+// exTabMove moves the current tab page to after the tab page with the
+// number given, to the start for 0 and to the end without a number. +n and
+// -n move it n places right or left.
+func (e *Editor) exTabMove(args exArgs) error {
+	arg := args.arg
+	if arg == "" {
+		e.moveTab(len(e.tabs) - 1)
+		return nil
+	}
+	n, err := strconv.Atoi(arg)
+	if err != nil {
+		return fmt.Errorf("invalid tab page position: %s", arg)
+	}
+	if arg[0] == '+' || arg[0] == '-' {
+		e.moveTab(e.tab + n)
+		return nil
+	}
+	if n > e.tab {
+		n--
+	}
+	e.moveTab(n)
+	return nil
+}
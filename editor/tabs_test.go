@@ -0,0 +1,127 @@
+package editor
+
+import (
+	"os"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// tabLabels returns the labels of the tab pages, without their padding,
+// and the index of the current one.
+func tabLabels(e *Editor) ([]string, int) {
+	var labels []string
+	for i := range e.tabs {
+		labels = append(labels, strings.TrimSpace(e.tabLabel(i)))
+	}
+	return labels, e.tab
+}
+
+func checkTabs(t *testing.T, e *Editor, after string, want []string, current int) {
+	t.Helper()
+	if got, i := tabLabels(e); !slices.Equal(got, want) || i != current {
+		t.Errorf("after %s, tabs = %q showing %d, want %q showing %d", after, got, i, want, current)
+	}
+}
+
+func TestTabPages(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Chdir(t.TempDir())
+	useSettings(t, Settings{TabSize: 4, Theme: "one-dark", LineNumbers: "off"})
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		if err := os.WriteFile(name, []byte(name+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	screen := NewMemoryScreen(80, 12)
+	e := NewEditor(screen)
+	e.Open("a.txt")
+	e.Draw()
+	if e.window.y != 0 || e.window.height != 11 {
+		t.Errorf("without a tab bar, window at row %d with %d rows, want 0 and 11", e.window.y, e.window.height)
+	}
+
+	for _, command := range []string{"tabnew b.txt", "tabnew c.txt"} {
+		if err := e.executeCommand(command); err != nil {
+			t.Fatal(err)
+		}
+	}
+	e.Buffer().InsertRune('!')
+	checkTabs(t, e, ":tabnew", []string{"1 a.txt", "2 b.txt", "3 c.txt +"}, 2)
+	e.Draw()
+	if got, want := screen.Line(0), " 1 a.txt  2 b.txt  3 c.txt +"; got != want {
+		t.Errorf("tab bar = %q, want %q", got, want)
+	}
+	// The tab bar takes a row from the text area.
+	if e.window.y != 1 || e.window.height != 10 {
+		t.Errorf("below the tab bar, window at row %d with %d rows, want 1 and 10", e.window.y, e.window.height)
+	}
+	if got := screen.Line(1); got != "!c.txt" {
+		t.Errorf("first line of text = %q, want %q", got, "!c.txt")
+	}
+
+	typeKeys(e, "gt")
+	checkTabs(t, e, "gt on the last tab page", []string{"1 a.txt", "2 b.txt", "3 c.txt +"}, 0)
+	typeKeys(e, "gT")
+	checkTabs(t, e, "gT", []string{"1 a.txt", "2 b.txt", "3 c.txt +"}, 2)
+	typeKeys(e, "2gt")
+	checkTabs(t, e, "2gt", []string{"1 a.txt", "2 b.txt", "3 c.txt +"}, 1)
+
+	for _, tt := range []struct {
+		command string
+		want    []string
+		current int
+	}{
+		{"tabmove 0", []string{"1 b.txt", "2 a.txt", "3 c.txt +"}, 0},
+		{"tabmove", []string{"1 a.txt", "2 c.txt +", "3 b.txt"}, 2},
+		{"tabmove -1", []string{"1 a.txt", "2 b.txt", "3 c.txt +"}, 1},
+		{"tabmove 3", []string{"1 a.txt", "2 c.txt +", "3 b.txt"}, 2},
+		{"tabmove 1", []string{"1 a.txt", "2 b.txt", "3 c.txt +"}, 1},
+		{"tabnext 3", []string{"1 a.txt", "2 b.txt", "3 c.txt +"}, 2},
+	} {
+		if err := e.executeCommand(tt.command); err != nil {
+			t.Fatalf(":%s: %v", tt.command, err)
+		}
+		checkTabs(t, e, ":"+tt.command, tt.want, tt.current)
+	}
+	typeKeys(e, "g<")
+	checkTabs(t, e, "g<", []string{"1 a.txt", "2 c.txt +", "3 b.txt"}, 1)
+	typeKeys(e, "g>")
+	checkTabs(t, e, "g>", []string{"1 a.txt", "2 b.txt", "3 c.txt +"}, 2)
+
+	// Clicking a label shows its tab page.
+	e.Draw()
+	x := strings.Index(screen.Line(0), "b.txt")
+	e.HandleEvent(Event{Type: EventMouse, Key: KeyMouseLeft, X: x, Y: 0})
+	checkTabs(t, e, "clicking b.txt", []string{"1 a.txt", "2 b.txt", "3 c.txt +"}, 1)
+
+	// A window moved to a tab page of its own leaves its old one.
+	e.Draw()
+	windowKeys(e, "v")
+	checkTabs(t, e, "Ctrl+W v", []string{"1 a.txt", "2 (2) b.txt", "3 c.txt +"}, 1)
+	windowKeys(e, "T")
+	checkTabs(t, e, "Ctrl+W T", []string{"1 a.txt", "2 b.txt", "3 b.txt", "4 c.txt +"}, 2)
+
+	if err := e.executeCommand("tabclose"); err != nil {
+		t.Fatal(err)
+	}
+	checkTabs(t, e, ":tabclose", []string{"1 a.txt", "2 b.txt", "3 c.txt +"}, 2)
+	typeKeys(e, "gc")
+	checkTabs(t, e, "gc", []string{"1 a.txt", "2 b.txt"}, 1)
+	// Closing a tab page leaves its buffers open.
+	if len(e.buffers) != 3 {
+		t.Errorf("after closing tab pages, %d buffers are open, want 3", len(e.buffers))
+	}
+	if err := e.executeCommand("tabonly"); err != nil {
+		t.Fatal(err)
+	}
+	checkTabs(t, e, ":tabonly", []string{"1 b.txt"}, 0)
+	e.Draw()
+	if e.window.y != 0 {
+		t.Errorf("once the tab bar is gone, window at row %d, want 0", e.window.y)
+	}
+	typeKeys(e, "gc")
+	if e.message != "Cannot close the last tab page" {
+		t.Errorf("closing the last tab page: message = %q", e.message)
+	}
+}
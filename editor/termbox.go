@@ -0,0 +1,102 @@
+package editor
+
+/*
+#cgo CFLAGS: -I${SRCDIR}/termbox2
+#cgo LDFLAGS: ${SRCDIR}/termbox2/libtermbox2.a -lm -lc
+#include <stdlib.h>
+#include "termbox2.h"
+*/
+import "C"
+
+import (
+	"fmt"
+	"time"
+	"unsafe"
+)
+
+// termboxScreen draws to the real terminal through termbox2. Bracketed
+// paste is turned on, and pastes are delivered as EventPaste. Mouse clicks
+// are delivered as EventMouse.
+type termboxScreen struct {
+	event C.struct_tb_event
+	paste pasteReader
+}
+
+func newTermboxScreen() (*termboxScreen, error) {
+	if rc := C.tb_init(); rc != 0 {
+		return nil, fmt.Errorf("tb_init failed: %d", int(rc))
+	}
+	C.tb_set_input_mode(C.TB_INPUT_ESC | C.TB_INPUT_MOUSE)
+	s := &termboxScreen{}
+	s.paste.next = s.nextEvent
+	s.WriteEscape(pasteModeOn)
+	return s, nil
+}
+
+func (s *termboxScreen) Size() (int, int) {
+	return int(C.tb_width()), int(C.tb_height())
+}
+
+func (s *termboxScreen) SetCell(x, y int, ch rune, fg, bg Attribute) {
+	C.tb_set_cell(C.int(x), C.int(y), C.uint32_t(ch), C.uintattr_t(fg), C.uintattr_t(bg))
+}
+
+func (s *termboxScreen) SetCursor(x, y int) {
+	C.tb_set_cursor(C.int(x), C.int(y))
+}
+
+func (s *termboxScreen) Clear() {
+	C.tb_clear()
+}
+
+func (s *termboxScreen) Present() {
+	C.tb_present()
+}
+
+func (s *termboxScreen) PollEvent() Event {
+	event, _ := s.paste.read(-1)
+	return event
+}
+
+func (s *termboxScreen) PeekEvent(timeout time.Duration) (Event, bool) {
+	return s.paste.read(timeout)
+}
+
+// nextEvent reads an event from termbox2, waiting for it if timeout is
+// negative.
+func (s *termboxScreen) nextEvent(timeout time.Duration) (Event, bool) {
+	if timeout < 0 {
+		C.tb_poll_event(&s.event)
+		return s.lastEvent(), true
+	}
+	if C.tb_peek_event(&s.event, C.int(timeout.Milliseconds())) != C.TB_OK {
+		return Event{}, false
+	}
+	return s.lastEvent(), true
+}
+
+func (s *termboxScreen) lastEvent() Event {
+	return Event{
+		Type:   EventType(s.event._type),
+		Mod:    uint8(s.event.mod),
+		Key:    Key(s.event.key),
+		Ch:     rune(s.event.ch),
+		Width:  int(s.event.w),
+		Height: int(s.event.h),
+		X:      int(s.event.x),
+		Y:      int(s.event.y),
+	}
+}
+
+// WriteEscape queues seq to be sent with the next Present.
+func (s *termboxScreen) WriteEscape(seq string) {
+	cs := C.CString(seq)
+	defer C.free(unsafe.Pointer(cs))
+	C.tb_send(cs, C.size_t(len(seq)))
+}
+
+func (s *termboxScreen) Close() {
+	s.WriteEscape(pasteModeOff)
+	C.tb_present()
+	C.tb_shutdown()
+}
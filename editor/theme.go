@@ -1,48 +1,31 @@
 package editor
 
-/*
-#include "termbox2.h"
-*/
-import "C"
-
 type Theme struct {
 	Name            string
-	Background      C.uintattr_t
-	Foreground      C.uintattr_t
-	LineNumber      C.uintattr_t
-	StatusBarFg     C.uintattr_t
-	StatusBarBg     C.uintattr_t
-	StatusModeFg    C.uintattr_t
-	StatusModeBg    C.uintattr_t
-	StatusInfoFg    C.uintattr_t
-	StatusInfoBg    C.uintattr_t
-	PopupFg         C.uintattr_t
-	PopupBg         C.uintattr_t
-	PopupTitleFg    C.uintattr_t
-	PopupTitleBg    C.uintattr_t
-	SelectionBg     C.uintattr_t
-	SelectionFg     C.uintattr_t
-	KeywordColor    C.uintattr_t
-	TypeColor       C.uintattr_t
-	StringColor     C.uintattr_t
-	NumberColor     C.uintattr_t
-	CommentColor    C.uintattr_t
-	FunctionColor   C.uintattr_t
-	WhitespaceColor C.uintattr_t
+	Background      Attribute
+	Foreground      Attribute
+	LineNumber      Attribute
+	StatusBarFg     Attribute
+	StatusBarBg     Attribute
+	StatusModeFg    Attribute
+	StatusModeBg    Attribute
+	StatusInfoFg    Attribute
+	StatusInfoBg    Attribute
+	PopupFg         Attribute
+	PopupBg         Attribute
+	PopupTitleFg    Attribute
+	PopupTitleBg    Attribute
+	SelectionBg     Attribute
+	SelectionFg     Attribute
+	KeywordColor    Attribute
+	TypeColor       Attribute
+	StringColor     Attribute
+	NumberColor     Attribute
+	CommentColor    Attribute
+	FunctionColor   Attribute
+	WhitespaceColor Attribute
 }
 
-const (
-	ColorDefault = C.TB_DEFAULT
-	ColorBlack   = C.TB_BLACK
-	ColorRed     = C.TB_RED
-	ColorGreen   = C.TB_GREEN
-	ColorYellow  = C.TB_YELLOW
-	ColorBlue    = C.TB_BLUE
-	ColorMagenta = C.TB_MAGENTA
-	ColorCyan    = C.TB_CYAN
-	ColorWhite   = C.TB_WHITE
-)
-
 var OneDarkTheme = Theme{
 	Name:            "One Dark",
 	Background:      ColorDefault,
@@ -0,0 +1,264 @@
+package editor
+
+import (
+	"slices"
+	"time"
+)
+
+// lineChange records that the lines Old starting at Row were replaced by
+// New.
+type lineChange struct {
+	Row int
+	Old [][]rune
+	New [][]rune
+}
+
+// undoStep is a group of changes that are undone and redone together,
+// along with the cursor position before and after them.
+type undoStep struct {
+	changes      []lineChange
+	beforeRow    int
+	beforeColumn int
+	afterRow     int
+	afterColumn  int
+}
+
+// undoNode is a state in the undo tree. The root is the buffer as it was
+// loaded; every other node is reached from its parent by applying step.
+// Undoing and then making a different edit adds a sibling, so abandoned
+// branches stay reachable.
+type undoNode struct {
+	step     *undoStep
+	parent   *undoNode
+	children []*undoNode
+	seq      int
+	time     time.Time
+
+	// redoChild is the child Redo moves to: the one most recently undone
+	// from or created.
+	redoChild *undoNode
+}
+
+type undoHistory struct {
+	root    *undoNode
+	current *undoNode
+	nextSeq int
+	open    *undoStep
+	depth   int
+
+	// saved is the node matching the file on disk, so moving back to it
+	// clears the modified flag.
+	saved *undoNode
+}
+
+func (h *undoHistory) init() {
+	if h.root == nil {
+		h.root = &undoNode{time: time.Now()}
+		h.current = h.root
+		h.saved = h.root
+		h.nextSeq = 1
+	}
+}
+
+func (h *undoHistory) begin(row, column int) {
+	h.depth++
+	if h.depth > 1 {
+		return
+	}
+	h.open = &undoStep{beforeRow: row, beforeColumn: column}
+}
+
+func (h *undoHistory) end(row, column int) {
+	if h.depth == 0 {
+		return
+	}
+	h.depth--
+	if h.depth > 0 {
+		return
+	}
+	step := h.open
+	h.open = nil
+	if len(step.changes) == 0 {
+		return
+	}
+	step.afterRow, step.afterColumn = row, column
+	h.init()
+	node := &undoNode{step: step, parent: h.current, seq: h.nextSeq, time: time.Now()}
+	h.nextSeq++
+	h.current.children = append(h.current.children, node)
+	h.current.redoChild = node
+	h.current = node
+}
+
+func (h *undoHistory) record(change lineChange) {
+	step := h.open
+	if n := len(step.changes); n > 0 {
+		last := &step.changes[n-1]
+		// Successive edits to the same single line, such as typing, only
+		// need the line as it was before the first of them.
+		if len(last.New) == 1 && len(change.Old) == 1 && len(change.New) == 1 && last.Row == change.Row {
+			last.New = change.New
+			return
+		}
+	}
+	step.changes = append(step.changes, change)
+}
+
+// nodes returns every node of the tree ordered by creation.
+func (h *undoHistory) nodes() []*undoNode {
+	h.init()
+	var nodes []*undoNode
+	var walk func(n *undoNode)
+	walk = func(n *undoNode) {
+		nodes = append(nodes, n)
+		for _, child := range n.children {
+			walk(child)
+		}
+	}
+	walk(h.root)
+	slices.SortFunc(nodes, func(a, b *undoNode) int { return a.seq - b.seq })
+	return nodes
+}
+
+func (n *undoNode) depth() int {
+	depth := 0
+	for ; n.parent != nil; n = n.parent {
+		depth++
+	}
+	return depth
+}
+
+// BeginUndoGroup starts a group of edits that Undo reverts as one step. It
+// is used for a whole insert session. Groups nest; only the outermost
+// EndUndoGroup closes the step.
+func (b *Buffer) BeginUndoGroup() {
+	b.history.begin(b.Row, b.Column)
+}
+
+// EndUndoGroup closes the group started by BeginUndoGroup.
+func (b *Buffer) EndUndoGroup() {
+	b.history.end(b.Row, b.Column)
+}
+
+// edit runs fn as a single undo step, or as part of the open group.
+func (b *Buffer) edit(fn func()) {
+	b.BeginUndoGroup()
+	fn()
+	b.EndUndoGroup()
+}
+
+// replaceLines replaces count lines starting at row with lines and records
+// the change for undo. Every modification of the buffer goes through it.
+func (b *Buffer) replaceLines(row, count int, lines [][]rune) {
+	old := make([][]rune, count)
+	for i := range old {
+		old[i] = b.Line(row + i)
+	}
+	if b.history.open == nil {
+		b.history.begin(b.Row, b.Column)
+		defer func() { b.history.end(b.Row, b.Column) }()
+	}
+	b.history.record(lineChange{Row: row, Old: old, New: lines})
+	b.spliceLines(row, count, lines)
+	b.Modified = true
+	b.changes++
+}
+
+func (b *Buffer) undoStep() {
+	node := b.history.current
+	for i := len(node.step.changes) - 1; i >= 0; i-- {
+		change := node.step.changes[i]
+		b.spliceLines(change.Row, len(change.New), change.Old)
+	}
+	b.history.current = node.parent
+	node.parent.redoChild = node
+	b.Row, b.Column = node.step.beforeRow, node.step.beforeColumn
+}
+
+func (b *Buffer) redoStep(node *undoNode) {
+	for _, change := range node.step.changes {
+		b.spliceLines(change.Row, len(change.Old), change.New)
+	}
+	b.history.current = node
+	node.parent.redoChild = node
+	b.Row, b.Column = node.step.afterRow, node.step.afterColumn
+}
+
+// markDiverged records that no state in the undo history matches the file
+// on disk any more, so the buffer stays modified until it is saved.
+func (b *Buffer) markDiverged() {
+	b.history.init()
+	b.history.saved = nil
+	b.Modified = true
+	b.changes++
+}
+
+func (b *Buffer) afterHistoryMove() {
+	b.clampCursor()
+	b.Modified = b.history.current != b.history.saved
+	b.changes++
+}
+
+// Undo reverts the most recent step and returns false if there is none.
+func (b *Buffer) Undo() bool {
+	b.history.init()
+	if b.history.open != nil || b.history.current.parent == nil {
+		return false
+	}
+	b.undoStep()
+	b.afterHistoryMove()
+	return true
+}
+
+// Redo reapplies the most recently undone step and returns false if there
+// is none.
+func (b *Buffer) Redo() bool {
+	b.history.init()
+	next := b.history.current.redoChild
+	if b.history.open != nil || next == nil {
+		return false
+	}
+	b.redoStep(next)
+	b.afterHistoryMove()
+	return true
+}
+
+// gotoUndoNode moves the buffer to the state of target, undoing back to
+// the common ancestor and redoing down the target's branch.
+func (b *Buffer) gotoUndoNode(target *undoNode) {
+	if b.history.open != nil || target == nil {
+		return
+	}
+	onPath := map[*undoNode]bool{}
+	for n := target; n != nil; n = n.parent {
+		onPath[n] = true
+	}
+	for !onPath[b.history.current] {
+		b.undoStep()
+	}
+	var path []*undoNode
+	for n := target; n != b.history.current; n = n.parent {
+		path = append(path, n)
+	}
+	for i := len(path) - 1; i >= 0; i-- {
+		b.redoStep(path[i])
+	}
+	b.afterHistoryMove()
+}
+
+// UndoDepth returns the number of steps that can be undone.
+func (b *Buffer) UndoDepth() int {
+	b.history.init()
+	return b.history.current.depth()
+}
+
+// RedoDepth returns the number of steps Redo can reapply along the most
+// recently used branch.
+func (b *Buffer) RedoDepth() int {
+	b.history.init()
+	depth := 0
+	for n := b.history.current.redoChild; n != nil; n = n.redoChild {
+		depth++
+	}
+	return depth
+}
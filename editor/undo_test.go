@@ -0,0 +1,107 @@
+package editor
+
+import "testing"
+
+func TestUndoTreeKeepsBranches(t *testing.T) {
+	b := newTestBuffer("base")
+	b.Column = 4
+	b.InsertText(" one")
+	b.InsertText(" two")
+	two := b.history.current
+	b.Undo()
+	// A new edit after undoing starts a branch beside " two".
+	b.InsertText(" three")
+	three := b.history.current
+
+	if got := bufferText(b); got != "base one three" {
+		t.Fatalf("text = %q, want %q", got, "base one three")
+	}
+	if len(three.parent.children) != 2 || two.parent != three.parent {
+		t.Fatal("the abandoned step is not a sibling of the new one")
+	}
+	if b.RedoDepth() != 0 || b.UndoDepth() != 2 {
+		t.Errorf("depths = %d undo, %d redo, want 2 and 0", b.UndoDepth(), b.RedoDepth())
+	}
+
+	b.gotoUndoNode(two)
+	if got := bufferText(b); got != "base one two" {
+		t.Errorf("on the old branch, text = %q, want %q", got, "base one two")
+	}
+	b.Undo()
+	// Redo follows the branch most recently left.
+	b.Redo()
+	if b.history.current != two {
+		t.Error("Redo did not return to the branch it was undone from")
+	}
+	b.gotoUndoNode(b.history.root)
+	if got := bufferText(b); got != "base" || b.Modified {
+		t.Errorf("at the root, text = %q, modified %v, want %q unmodified", got, b.Modified, "base")
+	}
+	b.gotoUndoNode(three)
+	if got := bufferText(b); got != "base one three" {
+		t.Errorf("back on the new branch, text = %q, want %q", got, "base one three")
+	}
+}
+
+func TestUndoInsertSession(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	e := NewEditor(NewMemoryScreen(80, 8))
+	b := newTestBuffer("first\nsecond")
+	e.buffers, e.window.buffer = []*Buffer{b}, b
+	b.Row, b.Column = 1, 3
+
+	// Typing, a line break and a backspace in one insert session are one
+	// step, which puts the cursor back where the session started.
+	typeKeys(e, "iab")
+	e.HandleEvent(Event{Type: EventKey, Key: KeyEnter})
+	typeKeys(e, "cd")
+	e.HandleEvent(Event{Type: EventKey, Key: KeyBackspace2})
+	e.HandleEvent(Event{Type: EventKey, Key: KeyEsc})
+	if got, want := bufferText(b), "first\nsecab\ncond"; got != want {
+		t.Fatalf("text = %q, want %q", got, want)
+	}
+	if b.UndoDepth() != 1 {
+		t.Errorf("UndoDepth() = %d, want 1", b.UndoDepth())
+	}
+	typeKeys(e, "u")
+	if got, want := bufferText(b), "first\nsecond"; got != want {
+		t.Errorf("after u, text = %q, want %q", got, want)
+	}
+	if b.Row != 1 || b.Column != 3 {
+		t.Errorf("after u, cursor at %d:%d, want 1:3", b.Row, b.Column)
+	}
+	e.HandleEvent(Event{Type: EventKey, Key: KeyCtrlR})
+	if got, want := bufferText(b), "first\nsecab\ncond"; got != want {
+		t.Errorf("after Ctrl+R, text = %q, want %q", got, want)
+	}
+}
+
+func TestUndoTreePopup(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	e := NewEditor(NewMemoryScreen(80, 20))
+	b := newTestBuffer("x")
+	e.buffers, e.window.buffer = []*Buffer{b}, b
+	b.InsertText("1")
+	b.InsertText("2")
+
+	typeKeys(e, "U")
+	if e.mode != ModeUndoTree {
+		t.Fatalf("mode = %v, want the undo tree", e.mode)
+	}
+	// Moving through the list previews each state; Esc goes back.
+	e.HandleEvent(Event{Type: EventKey, Key: KeyArrowDown})
+	if got := bufferText(b); got != "1x" {
+		t.Errorf("previewing one step back, text = %q, want %q", got, "1x")
+	}
+	e.HandleEvent(Event{Type: EventKey, Key: KeyEsc})
+	if got := bufferText(b); got != "12x" {
+		t.Errorf("after Esc, text = %q, want %q", got, "12x")
+	}
+	typeKeys(e, "U")
+	e.HandleEvent(Event{Type: EventKey, Key: KeyArrowDown})
+	e.HandleEvent(Event{Type: EventKey, Key: KeyArrowDown})
+	e.HandleEvent(Event{Type: EventKey, Key: KeyEnter})
+	if got := bufferText(b); got != "x" || e.mode != ModeEditor {
+		t.Errorf("after choosing the original, text = %q, mode %v", got, e.mode)
+	}
+}
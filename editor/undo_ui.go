@@ -0,0 +1,112 @@
+package editor
+
+import (
+	"fmt"
+	"slices"
+)
+
+type undoTreeView struct {
+	nodes  []*undoNode
+	cursor int
+	scroll int
+	origin *undoNode
+}
+
+func (e *Editor) openUndoTree() {
+	b := e.Buffer()
+	nodes := b.history.nodes()
+	slices.Reverse(nodes)
+	e.undoTree = undoTreeView{nodes: nodes, origin: b.history.current}
+	for i, node := range nodes {
+		if node == b.history.current {
+			e.undoTree.cursor = i
+		}
+	}
+	e.mode = ModeUndoTree
+}
+
+func undoNodeLabel(node *undoNode, current *undoNode) string {
+	marker := " "
+	if node == current {
+		marker = "*"
+	} else {
+		for n := current.parent; n != nil; n = n.parent {
+			if n == node {
+				marker = "|"
+				break
+			}
+		}
+	}
+	if node.parent == nil {
+		return fmt.Sprintf("%s #%-4d %s  original", marker, node.seq, node.time.Format("15:04:05"))
+	}
+	label := fmt.Sprintf("%s #%-4d %s  line %-5d depth %d", marker, node.seq, node.time.Format("15:04:05"),
+		node.step.changes[0].Row+1, node.depth())
+	if siblings := len(node.parent.children); siblings > 1 {
+		label += fmt.Sprintf("  branch %d/%d", slices.Index(node.parent.children, node)+1, siblings)
+	}
+	return label
+}
+
+func (e *Editor) showUndoTree() {
+	w, h := e.screen.Size()
+	view := &e.undoTree
+
+	pw := 64
+	ph := len(view.nodes) + 5
+	if ph > h-4 {
+		ph = h - 4
+	}
+	x := (w - pw) / 2
+	y := (h - ph) / 2
+
+	e.drawPopupFrame(x, y, pw, ph, "Undo History")
+
+	visibleEntries := ph - 5
+	if view.cursor < view.scroll {
+		view.scroll = view.cursor
+	} else if view.cursor >= view.scroll+visibleEntries {
+		view.scroll = view.cursor - visibleEntries + 1
+	}
+
+	current := e.Buffer().history.current
+	endIdx := min(view.scroll+visibleEntries, len(view.nodes))
+	for i := view.scroll; i < endIdx; i++ {
+		label := undoNodeLabel(view.nodes[i], current)
+		if len(label) > pw-4 {
+			label = label[:pw-4]
+		}
+		var fg, bg Attribute = ColorWhite, ColorBlack
+		if i == view.cursor {
+			fg, bg = ColorBlack, ColorWhite
+		}
+		e.printCell(x+2, y+2+(i-view.scroll), fg, bg, label)
+	}
+
+	footerText := "[↑/↓] Preview  [Enter] Jump  [Esc] Cancel"
+	footerX := x + (pw-len(footerText))/2
+	e.printCell(footerX, y+ph-2, ColorBlue, ColorBlack, footerText)
+}
+
+func (e *Editor) processUndoTreeEvent(event Event) {
+	view := &e.undoTree
+	b := e.Buffer()
+	switch event.Key {
+	case KeyEsc:
+		b.gotoUndoNode(view.origin)
+		e.mode = ModeEditor
+	case KeyArrowUp:
+		if view.cursor > 0 {
+			view.cursor--
+			b.gotoUndoNode(view.nodes[view.cursor])
+		}
+	case KeyArrowDown:
+		if view.cursor < len(view.nodes)-1 {
+			view.cursor++
+			b.gotoUndoNode(view.nodes[view.cursor])
+		}
+	case KeyEnter:
+		b.gotoUndoNode(view.nodes[view.cursor])
+		e.mode = ModeEditor
+	}
+}
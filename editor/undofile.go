@@ -0,0 +1,245 @@
+package editor
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Undo trees are stored per file under ~/.gocodeeditor/undo, in a file named
+// after a hash of the absolute path. The stored content hash is the hash of
+// the file as it was written, so a file changed by another program since
+// then does not pick up a history that no longer applies to it. Neither does
+// the same file read in another encoding. They hold the text of the file,
+// so only the user can read them.
+
+type savedChange struct {
+	Row int      `json:"row"`
+	Old [][]byte `json:"old"`
+	New [][]byte `json:"new"`
+}
+
+type savedUndoNode struct {
+	Seq          int           `json:"seq"`
+	Parent       int           `json:"parent"`
+	RedoChild    int           `json:"redo_child"`
+	Time         time.Time     `json:"time"`
+	BeforeRow    int           `json:"before_row"`
+	BeforeColumn int           `json:"before_column"`
+	AfterRow     int           `json:"after_row"`
+	AfterColumn  int           `json:"after_column"`
+	Changes      []savedChange `json:"changes"`
+}
+
+type savedUndoHistory struct {
+	Path          string          `json:"path"`
+	Hash          string          `json:"hash"`
+	Encoding      Encoding        `json:"encoding"`
+	Current       int             `json:"current"`
+	NextSeq       int             `json:"next_seq"`
+	RootTime      time.Time       `json:"root_time"`
+	RootRedoChild int             `json:"root_redo_child"`
+	Nodes         []savedUndoNode `json:"nodes"`
+}
+
+// perFilePath returns the path under the subdirectory kind of the config
+// directory where state kept for path is stored, and the absolute path of
+// path.
+func perFilePath(kind, path string) (string, string, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", "", err
+	}
+	dir, err := configDir()
+	if err != nil {
+		return "", "", err
+	}
+	sum := sha256.Sum256([]byte(absPath))
+	return filepath.Join(dir, kind, hex.EncodeToString(sum[:16])+".json"), absPath, nil
+}
+
+func undoFilePath(path string) (string, string, error) {
+	return perFilePath("undo", path)
+}
+
+// checkUndoRows reports whether every change in the tree under root replaces
+// lines that exist in the state it applies to, given that the state of
+// known has count lines.
+func checkUndoRows(root, known *undoNode, count int) bool {
+	for n := known; n != root; n = n.parent {
+		for _, change := range n.step.changes {
+			count -= len(change.New) - len(change.Old)
+		}
+	}
+	var check func(n *undoNode, count int) bool
+	check = func(n *undoNode, count int) bool {
+		for _, child := range n.children {
+			lines := count
+			for _, change := range child.step.changes {
+				if change.Row < 0 || change.Row+len(change.Old) > lines {
+					return false
+				}
+				lines += len(change.New) - len(change.Old)
+			}
+			if !check(child, lines) {
+				return false
+			}
+		}
+		return true
+	}
+	return count >= 0 && check(root, count)
+}
+
+func encodeLines(lines [][]rune) [][]byte {
+	encoded := make([][]byte, len(lines))
+	for i, line := range lines {
+		encoded[i] = encodeLine(nil, line)
+	}
+	return encoded
+}
+
+func decodeLines(encoded [][]byte) [][]rune {
+	lines := make([][]rune, len(encoded))
+	for i, data := range encoded {
+		lines[i], _ = decodeLine(data)
+	}
+	return lines
+}
+
+// saveUndoHistory writes the undo tree of the buffer, whose file on disk
+// now has the given content hash.
+func (b *Buffer) saveUndoHistory(hash string) error {
+	undoPath, absPath, err := undoFilePath(b.Path)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(b.encodeUndoHistory(absPath, hash, b.history.current))
+	if err != nil {
+		return err
+	}
+	return writePrivateFile(undoPath, func(w *bufio.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
+
+// encodeUndoHistory converts the undo tree for storage. saved is the node
+// whose content has the given hash.
+func (b *Buffer) encodeUndoHistory(absPath, hash string, saved *undoNode) savedUndoHistory {
+	b.history.init()
+
+	seqOf := func(n *undoNode) int {
+		if n == nil {
+			return 0
+		}
+		return n.seq
+	}
+	history := savedUndoHistory{
+		Path:          absPath,
+		Hash:          hash,
+		Encoding:      b.Format.Encoding,
+		Current:       saved.seq,
+		NextSeq:       b.history.nextSeq,
+		RootTime:      b.history.root.time,
+		RootRedoChild: seqOf(b.history.root.redoChild),
+	}
+	for _, node := range b.history.nodes() {
+		if node.parent == nil {
+			continue
+		}
+		savedNode := savedUndoNode{
+			Seq:          node.seq,
+			Parent:       node.parent.seq,
+			RedoChild:    seqOf(node.redoChild),
+			Time:         node.time,
+			BeforeRow:    node.step.beforeRow,
+			BeforeColumn: node.step.beforeColumn,
+			AfterRow:     node.step.afterRow,
+			AfterColumn:  node.step.afterColumn,
+		}
+		for _, change := range node.step.changes {
+			savedNode.Changes = append(savedNode.Changes, savedChange{
+				Row: change.Row,
+				Old: encodeLines(change.Old),
+				New: encodeLines(change.New),
+			})
+		}
+		history.Nodes = append(history.Nodes, savedNode)
+	}
+	return history
+}
+
+// loadUndoHistory restores the undo tree saved for the buffer's file if it
+// was saved for content with the given hash. It returns false otherwise.
+func (b *Buffer) loadUndoHistory(hash string) bool {
+	undoPath, absPath, err := undoFilePath(b.Path)
+	if err != nil {
+		return false
+	}
+	data, err := os.ReadFile(undoPath)
+	if err != nil {
+		return false
+	}
+	var saved savedUndoHistory
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return false
+	}
+	if saved.Path != absPath || saved.Hash != hash || saved.Encoding != b.Format.Encoding {
+		return false
+	}
+	return b.decodeUndoHistory(&saved) != nil
+}
+
+// decodeUndoHistory replaces the undo tree of the buffer, whose content must
+// be that of the saved node, with a stored one. It returns the nodes by
+// sequence number, or nil if the stored tree is inconsistent: a node has no
+// changes, or changes lines that the state it applies to does not have.
+func (b *Buffer) decodeUndoHistory(saved *savedUndoHistory) map[int]*undoNode {
+	root := &undoNode{time: saved.RootTime}
+	bySeq := map[int]*undoNode{0: root}
+	redoChildren := map[*undoNode]int{root: saved.RootRedoChild}
+	for _, savedNode := range saved.Nodes {
+		parent, ok := bySeq[savedNode.Parent]
+		if !ok || len(savedNode.Changes) == 0 {
+			return nil
+		}
+		step := &undoStep{
+			beforeRow:    savedNode.BeforeRow,
+			beforeColumn: savedNode.BeforeColumn,
+			afterRow:     savedNode.AfterRow,
+			afterColumn:  savedNode.AfterColumn,
+		}
+		for _, change := range savedNode.Changes {
+			step.changes = append(step.changes, lineChange{
+				Row: change.Row,
+				Old: decodeLines(change.Old),
+				New: decodeLines(change.New),
+			})
+		}
+		node := &undoNode{step: step, parent: parent, seq: savedNode.Seq, time: savedNode.Time}
+		parent.children = append(parent.children, node)
+		bySeq[node.seq] = node
+		redoChildren[node] = savedNode.RedoChild
+	}
+	current, ok := bySeq[saved.Current]
+	if !ok || !checkUndoRows(root, current, b.LineCount()) {
+		return nil
+	}
+	for node, seq := range redoChildren {
+		if seq != 0 {
+			node.redoChild = bySeq[seq]
+		}
+	}
+
+	b.history = undoHistory{
+		root:    root,
+		current: current,
+		saved:   current,
+		nextSeq: saved.NextSeq,
+	}
+	return bySeq
+}
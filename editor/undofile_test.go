@@ -0,0 +1,123 @@
+package editor
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUndoFileIsPrivate(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	path := filepath.Join(t.TempDir(), "secret.txt")
+	if err := os.WriteFile(path, []byte("password=hunter2\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	b, err := OpenBuffer(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	b.InsertRune('#')
+	if err := b.Save(); err != nil {
+		t.Fatal(err)
+	}
+	undoPath, _, err := undoFilePath(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkMode(t, undoPath, 0600)
+	checkMode(t, filepath.Dir(undoPath), 0700|os.ModeDir)
+}
+
+func TestSaveReportsUndoHistoryError(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Chdir(t.TempDir())
+	if err := os.WriteFile("notes.txt", []byte("text\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	e := NewEditor(NewMemoryScreen(80, 8))
+	e.Open("notes.txt")
+	// A file where the undo directory should be stops the history from
+	// being saved.
+	if err := os.MkdirAll(filepath.Join(home, ".gocodeeditor"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(home, ".gocodeeditor", "undo"), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	b := e.Buffer()
+	b.InsertRune('!')
+	if err := b.Save(); !errors.As(err, new(undoHistoryError)) {
+		t.Fatalf("Save() = %v, want an undoHistoryError", err)
+	}
+	if data, _ := os.ReadFile("notes.txt"); string(data) != "!text\n" {
+		t.Errorf("file holds %q, want it saved", data)
+	}
+	if b.Modified {
+		t.Error("buffer still modified after the file was saved")
+	}
+
+	b.InsertRune('?')
+	if !e.save() {
+		t.Error("save() reported failure when only the undo history was not saved")
+	}
+	if !strings.HasPrefix(e.message, "Saved notes.txt") || !strings.Contains(e.message, "undo history") {
+		t.Errorf("message = %q, want the save and the undo history error", e.message)
+	}
+}
+
+func checkMode(t *testing.T, path string, want os.FileMode) {
+	t.Helper()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode() != want {
+		t.Errorf("%s has mode %v, want %v", path, info.Mode(), want)
+	}
+}
+
+func TestDecodeUndoHistoryRejectsBadNodes(t *testing.T) {
+	line := func(s string) [][]byte { return [][]byte{[]byte(s)} }
+	tests := []struct {
+		name  string
+		nodes []savedUndoNode
+		ok    bool
+	}{
+		{"valid", []savedUndoNode{
+			{Seq: 1, Changes: []savedChange{{Row: 1, Old: line("two"), New: line("2")}}},
+			{Seq: 2, Parent: 1, Changes: []savedChange{{Row: 2, New: line("three")}}},
+		}, true},
+		{"no changes", []savedUndoNode{
+			{Seq: 1, Changes: []savedChange{{Row: 1, Old: line("two"), New: line("2")}}},
+			{Seq: 2, Parent: 1},
+		}, false},
+		{"row past the end", []savedUndoNode{
+			{Seq: 1, Changes: []savedChange{{Row: 1, Old: line("two"), New: line("2")}}},
+			{Seq: 2, Parent: 1, Changes: []savedChange{{Row: 5, Old: line("six"), New: line("6")}}},
+		}, false},
+		{"negative row", []savedUndoNode{
+			{Seq: 1, Changes: []savedChange{{Row: -1, New: line("zero")}}},
+		}, false},
+		{"row past the end of a branch", []savedUndoNode{
+			{Seq: 2, Changes: []savedChange{{Row: 2, Old: line("three")}}},
+			{Seq: 1, Changes: []savedChange{{Row: 1, Old: line("two"), New: line("2")}}},
+		}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The buffer holds the state of the last node listed.
+			b := newTestBuffer("one\n2")
+			if tt.ok {
+				b = newTestBuffer("one\n2\nthree")
+			}
+			saved := &savedUndoHistory{Current: tt.nodes[len(tt.nodes)-1].Seq, NextSeq: len(tt.nodes) + 1, Nodes: tt.nodes}
+			if got := b.decodeUndoHistory(saved) != nil; got != tt.ok {
+				t.Errorf("decodeUndoHistory() != nil is %v, want %v", got, tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package editor
+
+import (
+	"os"
+	"testing"
+)
+
+func TestConfirmUnsaved(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Chdir(t.TempDir())
+	for _, name := range []string{"a.txt", "b.txt"} {
+		if err := os.WriteFile(name, []byte(name+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	e := NewEditor(NewMemoryScreen(80, 12))
+	e.Open("a.txt")
+	a := e.Buffer()
+	a.InsertRune('!')
+	e.Open("b.txt")
+	enter := Event{Type: EventKey, Key: KeyEnter}
+	down := Event{Type: EventKey, Key: KeyArrowDown}
+
+	// q asks about the modified buffer, even though another is shown.
+	typeKeys(e, "q")
+	if e.mode != ModeUnsaved || len(e.unsaved.buffers) != 1 || e.unsaved.buffers[0] != a {
+		t.Fatalf("mode = %v, want the popup asking about a.txt", e.mode)
+	}
+	e.HandleEvent(Event{Type: EventKey, Key: KeyEsc})
+	if e.mode != ModeEditor || !a.Modified {
+		t.Fatalf("after Esc, mode = %v, a.txt modified %v", e.mode, a.Modified)
+	}
+
+	proceeded := 0
+	proceed := func() { proceeded++ }
+	e.confirmUnsaved("close", e.buffers, proceed)
+	e.HandleEvent(down)
+	e.HandleEvent(down)
+	e.HandleEvent(enter)
+	if proceeded != 0 || !a.Modified {
+		t.Errorf("Cancel went ahead (%d) or lost the changes", proceeded)
+	}
+
+	e.confirmUnsaved("close", e.buffers, proceed)
+	e.HandleEvent(down)
+	e.HandleEvent(enter)
+	if data, _ := os.ReadFile("a.txt"); proceeded != 1 || string(data) != "a.txt\n" {
+		t.Errorf("Discard: proceeded %d times, file holds %q", proceeded, data)
+	}
+
+	e.confirmUnsaved("close", e.buffers, proceed)
+	e.HandleEvent(enter)
+	if data, _ := os.ReadFile("a.txt"); proceeded != 2 || string(data) != "!a.txt\n" || a.Modified {
+		t.Errorf("Save: proceeded %d times, file holds %q, modified %v", proceeded, data, a.Modified)
+	}
+
+	// Without unsaved changes there is nothing to ask.
+	e.confirmUnsaved("close", e.buffers, proceed)
+	if proceeded != 3 || e.mode != ModeEditor {
+		t.Errorf("with nothing unsaved, proceeded %d times in mode %v", proceeded, e.mode)
+	}
+}
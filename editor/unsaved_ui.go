@@ -0,0 +1,123 @@
+package editor
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/mattn/go-runewidth"
+)
+
+// unsavedView asks what to do with unsaved changes before an action that
+// would lose them, such as quitting or opening another file.
+type unsavedView struct {
+	verb    string
+	buffers []*Buffer
+	proceed func()
+	cursor  int
+}
+
+// The choices of unsavedView, in the order options lists them.
+const (
+	unsavedSave = iota
+	unsavedDiscard
+	unsavedCancel
+)
+
+func (v *unsavedView) options() []string {
+	return []string{"Save and " + v.verb, "Discard changes and " + v.verb, "Cancel"}
+}
+
+// confirmUnsaved runs proceed at once if none of buffers has unsaved
+// changes. Otherwise it asks whether to save them first, discard them or
+// cancel; verb names the action in the choices, as in "Save and quit".
+func (e *Editor) confirmUnsaved(verb string, buffers []*Buffer, proceed func()) {
+	buffers = slices.DeleteFunc(slices.Clone(buffers), func(b *Buffer) bool { return !b.Modified })
+	if len(buffers) == 0 {
+		proceed()
+		return
+	}
+	e.unsaved = unsavedView{verb: verb, buffers: buffers, proceed: proceed}
+	e.mode = ModeUnsaved
+}
+
+// confirmQuit quits, asking first about unsaved changes in any buffer.
+func (e *Editor) confirmQuit() {
+	e.confirmUnsaved("quit", e.buffers, e.quit)
+}
+
+// saveUnsaved saves each of the buffers the popup asked about, showing it
+// while it is saved, and returns false as soon as one cannot be.
+func (e *Editor) saveUnsaved() bool {
+	for _, b := range e.unsaved.buffers {
+		if i := slices.Index(e.buffers, b); i >= 0 {
+			e.switchBuffer(i)
+			if !e.save() {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (e *Editor) showUnsaved() {
+	w, h := e.screen.Size()
+	view := &e.unsaved
+	options := view.options()
+
+	text := filepath.Base(view.buffers[0].Path) + " has unsaved changes."
+	if len(view.buffers) > 1 {
+		names := make([]string, len(view.buffers))
+		for i, b := range view.buffers {
+			names[i] = filepath.Base(b.Path)
+		}
+		text = fmt.Sprintf("%d files have unsaved changes: %s", len(names), strings.Join(names, ", "))
+	}
+
+	pw := 56
+	ph := len(options) + 6
+	x := (w - pw) / 2
+	y := (h - ph) / 2
+
+	e.drawPopupFrame(x, y, pw, ph, "Unsaved Changes")
+
+	e.printCell(x+2, y+1, ColorWhite, ColorBlack, runewidth.Truncate(text, pw-4, "..."))
+	for i, option := range options {
+		var fg, bg Attribute = ColorWhite, ColorBlack
+		if i == view.cursor {
+			fg, bg = ColorBlack, ColorWhite
+		}
+		e.printCell(x+2, y+3+i, fg, bg, runewidth.Truncate(option, pw-4, "..."))
+	}
+
+	footerText := "[↑/↓] Navigate  [Enter] Select  [Esc] Cancel"
+	footerX := x + (pw-len(footerText))/2
+	e.printCell(footerX, y+ph-2, ColorBlue, ColorBlack, footerText)
+}
+
+func (e *Editor) processUnsavedEvent(event Event) {
+	view := &e.unsaved
+	switch event.Key {
+	case KeyEsc:
+		e.mode = ModeEditor
+	case KeyArrowUp:
+		if view.cursor > 0 {
+			view.cursor--
+		}
+	case KeyArrowDown:
+		if view.cursor < len(view.options())-1 {
+			view.cursor++
+		}
+	case KeyEnter:
+		e.mode = ModeEditor
+		switch view.cursor {
+		case unsavedSave:
+			if e.saveUnsaved() {
+				view.proceed()
+			}
+		case unsavedDiscard:
+			view.proceed()
+		}
+	}
+}
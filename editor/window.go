@@ -0,0 +1,399 @@
+package editor
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+
+	"github.com/mattn/go-runewidth"
+)
+
+// window shows a buffer in part of the text area. Each window keeps its
+// own scroll position, and the cursor it had in its buffer while another
+// window has the focus. x, y, width and height are where the last layout
+// put it, and statusLine is set when a line below the text names its
+// buffer, as it does once the text area is split. The first gutter columns
+// hold line numbers, and the text follows them.
+type window struct {
+	buffer                  *Buffer
+	row, column             int
+	offsetRow, offsetColumn int
+
+	x, y, width, height int
+	gutter              int
+	statusLine          bool
+}
+
+// show makes the window show b, at the cursor and scroll position b had
+// when it was last shown.
+func (w *window) show(b *Buffer) {
+	w.buffer = b
+	w.row, w.column = b.Row, b.Column
+	w.offsetRow, w.offsetColumn = b.offsetRow, b.offsetColumn
+}
+
+// textWidth returns how many columns of text the window shows beside its
+// gutter.
+func (w *window) textWidth() int {
+	return w.width - w.gutter
+}
+
+// contains reports whether the screen cell x, y is in the window or its
+// status line.
+func (w *window) contains(x, y int) bool {
+	height := w.height
+	if w.statusLine {
+		height++
+	}
+	return x >= w.x && x < w.x+w.width && y >= w.y && y < w.y+height
+}
+
+// split divides part of the text area between windows, or holds a single
+// window. The children of a vertical split sit side by side, separated by a
+// column, and those of a horizontal one are stacked. size is the width or
+// height the split was last given in its parent, with its status line.
+type split struct {
+	window   *window
+	vertical bool
+	children []*split
+	parent   *split
+	size     int
+
+	x, y, width, height int
+}
+
+// The smallest windows a split or resize makes: one line of text with its
+// status line, and a few columns.
+const (
+	minWindowHeight = 2
+	minWindowWidth  = 8
+)
+
+// windows returns the windows of s in order, left to right and top to
+// bottom.
+func (s *split) windows() []*window {
+	if s.window != nil {
+		return []*window{s.window}
+	}
+	var windows []*window
+	for _, child := range s.children {
+		windows = append(windows, child.windows()...)
+	}
+	return windows
+}
+
+// find returns the split holding w alone, or nil.
+func (s *split) find(w *window) *split {
+	if s.window == w {
+		return s
+	}
+	for _, child := range s.children {
+		if found := child.find(w); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// place lays s out in the given part of the screen. Its children keep the
+// proportions of their sizes.
+func (s *split) place(x, y, width, height int, statusLines bool) {
+	s.x, s.y, s.width, s.height = x, y, width, height
+	if w := s.window; w != nil {
+		w.x, w.y, w.width, w.height = x, y, width, height
+		w.statusLine = statusLines
+		if statusLines {
+			w.height = max(height-1, 1)
+		}
+		return
+	}
+	total := height
+	if s.vertical {
+		total = width - (len(s.children) - 1)
+	}
+	sizes := make([]int, len(s.children))
+	for i, child := range s.children {
+		sizes[i] = child.size
+	}
+	fitSizes(sizes, total)
+	for i, child := range s.children {
+		child.size = sizes[i]
+		if s.vertical {
+			child.place(x, y, sizes[i], height, statusLines)
+			x += sizes[i] + 1
+		} else {
+			child.place(x, y, width, sizes[i], statusLines)
+			y += sizes[i]
+		}
+	}
+}
+
+// fitSizes scales sizes to add up to total, keeping their proportions. If
+// they are all zero, they share total equally.
+func fitSizes(sizes []int, total int) {
+	sum := 0
+	for _, size := range sizes {
+		sum += size
+	}
+	if sum == total {
+		return
+	}
+	remaining := total
+	for i := range sizes {
+		if i == len(sizes)-1 {
+			sizes[i] = remaining
+			break
+		}
+		size := total / len(sizes)
+		if sum > 0 {
+			size = sizes[i] * total / sum
+		}
+		sizes[i] = max(size, 1)
+		remaining -= sizes[i]
+	}
+}
+
+// layoutWindows lays the windows out over the text area, below the tab bar
+// if it is shown. A window scrolled past the end of its buffer, which may
+// have lost lines through another window, is scrolled back to its last
+// line.
+func (e *Editor) layoutWindows() {
+	top := 0
+	if e.showTabBar() {
+		top = 1
+	}
+	e.layout.place(0, top, e.cols, e.rows-top, e.layout.window == nil)
+	for _, w := range e.layout.windows() {
+		w.gutter = min(gutterWidth(w.buffer), w.width/2)
+		w.offsetRow = min(w.offsetRow, w.buffer.LineCount()-1)
+	}
+}
+
+// focusWindow moves the focus to w, leaving the cursor of the window that
+// had it where it was.
+func (e *Editor) focusWindow(w *window) {
+	old := e.window
+	if w == old {
+		return
+	}
+	e.endSelection()
+	e.cancelCommand()
+	old.row, old.column = old.buffer.Row, old.buffer.Column
+	if w.buffer != old.buffer {
+		e.hasLastSelection = false
+		old.buffer.offsetRow, old.buffer.offsetColumn = old.offsetRow, old.offsetColumn
+	}
+	e.window = w
+	b := w.buffer
+	b.Row, b.Column = w.row, w.column
+	b.clampCursor()
+}
+
+// splitWindow divides the focused window in two, side by side if vertical
+// and stacked otherwise. The new window, above or left of the old one,
+// shows the same buffer and takes the focus.
+func (e *Editor) splitWindow(vertical bool) bool {
+	old := e.window
+	height := old.height
+	if old.statusLine {
+		height++
+	}
+	if vertical && old.width < 2*minWindowWidth+1 || !vertical && height < 2*minWindowHeight {
+		e.setMessage("Not enough room to split the window")
+		return false
+	}
+	b := old.buffer
+	old.row, old.column = b.Row, b.Column
+	w := &window{}
+	*w = *old
+
+	node := e.layout.find(old)
+	added := &split{window: w}
+	if parent := node.parent; parent != nil && parent.vertical == vertical {
+		added.parent = parent
+		added.size = node.size / 2
+		node.size -= added.size
+		i := slices.Index(parent.children, node)
+		parent.children = slices.Insert(parent.children, i, added)
+	} else {
+		// The window's place becomes a split holding both.
+		moved := &split{window: old, parent: node}
+		added.parent = node
+		node.window, node.vertical, node.children = nil, vertical, []*split{added, moved}
+	}
+	e.window = w
+	return true
+}
+
+// closeWindow closes the focused window, giving its room to a neighbor,
+// which takes the focus. Closing the last window of a tab page closes the
+// tab page, and the last window of the last one cannot be closed.
+func (e *Editor) closeWindow() bool {
+	node := e.layout.find(e.window)
+	parent := node.parent
+	if parent == nil && len(e.tabs) > 1 {
+		return e.closeTab()
+	}
+	if parent == nil {
+		e.setMessage("Cannot close the last window")
+		return false
+	}
+	i := slices.Index(parent.children, node)
+	parent.children = slices.Delete(parent.children, i, i+1)
+	neighbor := parent.children[max(i-1, 0)]
+	neighbor.size += node.size
+	if parent.vertical {
+		neighbor.size++
+	}
+	if len(parent.children) == 1 {
+		// A split holding one child is replaced by it.
+		only := parent.children[0]
+		parent.window, parent.vertical, parent.children = only.window, only.vertical, only.children
+		for _, child := range parent.children {
+			child.parent = parent
+		}
+		neighbor = parent
+	}
+	next := neighbor.windows()[0]
+	if i > 0 {
+		windows := neighbor.windows()
+		next = windows[len(windows)-1]
+	}
+	e.focusWindow(next)
+	return true
+}
+
+// onlyWindow closes every window but the focused one.
+func (e *Editor) onlyWindow() {
+	e.layout = &split{window: e.window}
+}
+
+// cycleWindow moves the focus count windows on, or back if count is
+// negative, wrapping around.
+func (e *Editor) cycleWindow(count int) {
+	windows := e.layout.windows()
+	n := len(windows)
+	i := slices.Index(windows, e.window)
+	e.focusWindow(windows[((i+count)%n+n)%n])
+}
+
+// focusNeighbor moves the focus to the window next to the focused one in
+// the direction dx, dy, next to the cursor, count times.
+func (e *Editor) focusNeighbor(dx, dy, count int) {
+	for range count {
+		w := e.window
+		b := w.buffer
+		x := min(max(w.x+w.gutter+b.runeIndexToDisplayCol(b.Row, b.Column, editSettings.TabSize)-w.offsetColumn, w.x), w.x+w.width-1)
+		y := min(max(w.y+b.Row-w.offsetRow, w.y), w.y+w.height-1)
+		switch {
+		case dx < 0:
+			x = w.x - 2
+		case dx > 0:
+			x = w.x + w.width + 1
+		case dy < 0:
+			y = w.y - 1
+		case dy > 0:
+			y = w.y + w.height
+			if w.statusLine {
+				y++
+			}
+		}
+		var found *window
+		for _, other := range e.layout.windows() {
+			if other != w && other.contains(x, y) {
+				found = other
+			}
+		}
+		if found == nil {
+			return
+		}
+		e.focusWindow(found)
+	}
+}
+
+// resizeWindow makes the focused window delta columns wider if vertical,
+// or delta lines taller otherwise, taking the room from the window next to
+// it. A negative delta makes it smaller.
+func (e *Editor) resizeWindow(vertical bool, delta int) {
+	node := e.layout.find(e.window)
+	for node.parent != nil && node.parent.vertical != vertical {
+		node = node.parent
+	}
+	parent := node.parent
+	if parent == nil {
+		return
+	}
+	i := slices.Index(parent.children, node)
+	sibling := i + 1
+	if sibling == len(parent.children) {
+		sibling = i - 1
+	}
+	other := parent.children[sibling]
+	minSize := minWindowHeight
+	if vertical {
+		minSize = minWindowWidth
+	}
+	delta = max(min(delta, other.size-minSize), minSize-node.size)
+	node.size += delta
+	other.size -= delta
+}
+
+// equalizeWindows gives every window the same share of its split.
+func (e *Editor) equalizeWindows() {
+	var equalize func(s *split)
+	equalize = func(s *split) {
+		for _, child := range s.children {
+			child.size = 0
+			equalize(child)
+		}
+	}
+	equalize(e.layout)
+}
+
+// displayText draws the tab bar and every window, with the separators
+// between windows side by side.
+func (e *Editor) displayText() {
+	if e.showTabBar() {
+		e.displayTabBar()
+	}
+	for _, w := range e.layout.windows() {
+		e.displayGutter(w)
+		e.displayWindow(w)
+		if w.statusLine {
+			e.displayWindowStatus(w)
+		}
+	}
+	e.displaySeparators(e.layout)
+}
+
+func (e *Editor) displaySeparators(s *split) {
+	for i, child := range s.children {
+		if s.vertical && i > 0 {
+			x := child.x - 1
+			for y := child.y; y < child.y+child.height; y++ {
+				e.screen.SetCell(x, y, '│', CurrentTheme.StatusBarFg, CurrentTheme.StatusBarBg)
+			}
+		}
+		e.displaySeparators(child)
+	}
+}
+
+// displayWindowStatus draws the line below a window, naming its buffer and
+// where its cursor is, in the mode colors for the focused window.
+func (e *Editor) displayWindowStatus(w *window) {
+	b := w.buffer
+	row, column := w.row, w.column
+	fg, bg := CurrentTheme.StatusBarFg, CurrentTheme.StatusBarBg
+	if w == e.window {
+		row, column = b.Row, b.Column
+		fg, bg = CurrentTheme.StatusModeFg, CurrentTheme.StatusModeBg
+	}
+	name := " " + filepath.Base(b.Path)
+	if b.Modified {
+		name += " [+]"
+	}
+	position := fmt.Sprintf("Ln %d, Col %d ", row+1, b.runeIndexToDisplayCol(row, min(column, len(b.Line(row))), editSettings.TabSize)+1)
+	text := runewidth.Truncate(name, max(w.width-len(position)-1, 0), "…")
+	text = runewidth.FillRight(text, max(w.width-len(position), 0)) + position
+	e.printCell(w.x, w.y+w.height, fg, bg, runewidth.Truncate(text, w.width, ""))
+}
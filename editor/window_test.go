@@ -0,0 +1,106 @@
+package editor
+
+import (
+	"strings"
+	"testing"
+)
+
+// windowKeys sends Ctrl+W followed by keys.
+func windowKeys(e *Editor, keys string) {
+	pressKey(e, KeyCtrlW)
+	typeKeys(e, keys)
+}
+
+// checkPlace checks where the last layout put w.
+func checkPlace(t *testing.T, name string, w *window, x, y, width, height int) {
+	t.Helper()
+	if w.x != x || w.y != y || w.width != width || w.height != height {
+		t.Errorf("%s window at %d,%d size %dx%d, want %d,%d size %dx%d",
+			name, w.x, w.y, w.width, w.height, x, y, width, height)
+	}
+}
+
+func TestSplitWindows(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	useSettings(t, Settings{TabSize: 4, Theme: "one-dark", LineNumbers: "off"})
+	screen := NewMemoryScreen(81, 21)
+	e := NewEditor(screen)
+	b := newTestBuffer(numberedLines(50))
+	e.buffers, e.window.buffer = []*Buffer{b}, b
+	e.Draw()
+	pressKey(e, KeyArrowDown)
+	pressKey(e, KeyArrowDown)
+	bottom := e.window
+
+	// The new window goes above the old one and takes the focus.
+	windowKeys(e, "s")
+	e.Draw()
+	top := e.window
+	if windows := e.layout.windows(); len(windows) != 2 || windows[0] != top || windows[1] != bottom {
+		t.Fatalf("after Ctrl+W s, windows = %v", windows)
+	}
+	checkPlace(t, "top", top, 0, 0, 81, 9)
+	checkPlace(t, "bottom", bottom, 0, 10, 81, 9)
+	if got := screen.Line(9); !strings.HasPrefix(got, " untitled") || !strings.HasSuffix(got, "Ln 3, Col 1") {
+		t.Errorf("status line of the top window = %q", got)
+	}
+
+	// Each window keeps its own cursor.
+	pressKey(e, KeyArrowDown)
+	windowKeys(e, "j")
+	if e.window != bottom || b.Row != 2 {
+		t.Errorf("after Ctrl+W j, focus on %p row %d, want %p row 2", e.window, b.Row, bottom)
+	}
+	windowKeys(e, "k")
+	if e.window != top || b.Row != 3 {
+		t.Errorf("after Ctrl+W k, focus on %p row %d, want %p row 3", e.window, b.Row, top)
+	}
+
+	windowKeys(e, "v")
+	e.Draw()
+	left := e.window
+	checkPlace(t, "left", left, 0, 0, 40, 9)
+	checkPlace(t, "right", top, 41, 0, 40, 9)
+	windowKeys(e, "l")
+	if e.window != top {
+		t.Error("Ctrl+W l did not focus the right window")
+	}
+	windowKeys(e, "w")
+	if e.window != bottom {
+		t.Error("Ctrl+W w did not focus the next window")
+	}
+
+	// Resizing takes room from the neighbor, down to a line and a status
+	// line.
+	windowKeys(e, "+")
+	e.Draw()
+	checkPlace(t, "grown bottom", bottom, 0, 9, 81, 10)
+	for range 20 {
+		windowKeys(e, "+")
+	}
+	e.Draw()
+	checkPlace(t, "largest bottom", bottom, 0, 2, 81, 17)
+	checkPlace(t, "smallest left", left, 0, 0, 40, 1)
+	windowKeys(e, "=")
+	e.Draw()
+	checkPlace(t, "equal bottom", bottom, 0, 10, 81, 9)
+
+	// Closing a window gives its room to its neighbor.
+	windowKeys(e, "c")
+	e.Draw()
+	if e.window != top {
+		t.Error("after closing the bottom window, the right one does not have the focus")
+	}
+	checkPlace(t, "right", top, 41, 0, 40, 19)
+	windowKeys(e, "o")
+	e.Draw()
+	if windows := e.layout.windows(); len(windows) != 1 || windows[0] != top {
+		t.Fatalf("after Ctrl+W o, windows = %v", windows)
+	}
+	// A single window has no status line of its own.
+	checkPlace(t, "only", top, 0, 0, 81, 20)
+	windowKeys(e, "c")
+	if e.message != "Cannot close the last window" {
+		t.Errorf("closing the last window: message = %q", e.message)
+	}
+}